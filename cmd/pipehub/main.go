@@ -15,6 +15,7 @@ import (
 	"github.com/pipehub/pipehub/internal/application/generator"
 	"github.com/pipehub/pipehub/internal/application/server"
 	"github.com/pipehub/pipehub/internal/infra/config"
+	"github.com/pipehub/pipehub/internal/infra/log"
 )
 
 // nolint: gochecknoglobals
@@ -22,6 +23,7 @@ var (
 	version string
 	builtAt string
 	done    = make(chan os.Signal, 1)
+	logger  *log.Logger
 )
 
 func main() {
@@ -58,6 +60,7 @@ func cmdStartRun(configPath *string) func(*cobra.Command, []string) {
 			err = errors.Wrap(err, "config initialization error")
 			fatal(err)
 		}
+		initLogger(ccfg)
 
 		cfg, err := ccfg.ToServer()
 		if err != nil {
@@ -65,12 +68,37 @@ func cmdStartRun(configPath *string) func(*cobra.Command, []string) {
 			fatal(err)
 		}
 		cfg.Transport.HTTP.AsyncErrorHandler = asyncErrHandler
+		cfg.Logger = logger
 
 		c := server.NewClient(cfg)
 		if err := c.Start(); err != nil {
 			err = errors.Wrap(err, "pipehub start error")
 			fatal(err)
 		}
+		reopen(func() error {
+			if err := logger.Reopen(); err != nil {
+				return errors.Wrap(err, "logger reopen error")
+			}
+			return c.Reopen()
+		})
+		reload(func() error {
+			payload, err := ioutil.ReadFile(*configPath)
+			if err != nil {
+				return errors.Wrap(err, "load file error")
+			}
+
+			ccfg, err := config.NewConfig(payload)
+			if err != nil {
+				return errors.Wrap(err, "config initialization error")
+			}
+
+			cfg, err := ccfg.ToServer()
+			if err != nil {
+				return errors.Wrap(err, "invalid config load")
+			}
+			return c.Reload(cfg.Pipe)
+		})
+		logger.Info("pipehub started")
 
 		wait()
 
@@ -86,7 +114,7 @@ func cmdStartRun(configPath *string) func(*cobra.Command, []string) {
 			if ctxShutdown.Err() == context.Canceled {
 				return
 			}
-			fmt.Println("pipehub did not gracefully stopped")
+			logger.Error("pipehub did not gracefully stopped")
 			os.Exit(1)
 		}()
 
@@ -94,7 +122,10 @@ func cmdStartRun(configPath *string) func(*cobra.Command, []string) {
 			err = errors.Wrap(err, "pipehub stop error")
 			fatal(err)
 		}
-		fmt.Println("pipehub stopped")
+		logger.Info("pipehub stopped")
+		if err := logger.Close(); err != nil {
+			fmt.Println(errors.Wrap(err, "logger close error").Error())
+		}
 	}
 }
 
@@ -125,10 +156,12 @@ func cmdGenerateRun(configPath, workspacePath *string) func(*cobra.Command, []st
 			err = errors.Wrap(err, "config initialization error")
 			fatal(err)
 		}
+		initLogger(ccfg)
 
 		cfg := ccfg.ToGenerator()
 		fs := afero.NewBasePathFs(afero.NewOsFs(), *workspacePath)
 		cfg.Filesystem = fs
+		cfg.Logger = logger
 
 		g, err := generator.NewClient(cfg)
 		if err != nil {
@@ -7,10 +7,28 @@ import (
 	"syscall"
 
 	"github.com/pkg/errors"
+
+	"github.com/pipehub/pipehub/internal/infra/config"
+	"github.com/pipehub/pipehub/internal/infra/log"
 )
 
+func initLogger(cfg config.Config) {
+	var err error
+	logger, err = log.NewLogger(cfg.ToLogger())
+	if err != nil {
+		err = errors.Wrap(err, "logger initialization error")
+		fatal(err)
+	}
+}
+
+// fatal use the logger if it's already initialized, otherwise, the error is printed at the standard
+// output.
 func fatal(err error) {
-	fmt.Println(err.Error())
+	if logger == nil {
+		fmt.Println(err.Error())
+	} else {
+		logger.Error("fatal error", "error", err)
+	}
 	os.Exit(1)
 }
 
@@ -20,6 +38,6 @@ func wait() {
 }
 
 func asyncErrHandler(err error) {
-	fmt.Println(errors.Wrap(err, "async error occurred").Error())
+	logger.Error("async error occurred", "error", err)
 	done <- syscall.SIGTERM
 }
@@ -1,16 +1,69 @@
 core {
   graceful-shutdown = "10s"
 
+  log {
+    level  = "info"
+    format = "logfmt"
+    output = "stdout"
+  }
+
+  admin {
+    listen {
+      address = "127.0.0.1"
+      port    = 8081
+    }
+
+    debug = false
+  }
+
+  store {
+    driver           = "disk"
+    path             = "/var/lib/pipehub/store.db"
+    sync             = false
+    cleanup-interval = "1m"
+  }
+
   http {
     server {
+      trusted-proxies = ["10.0.0.0/8", "172.16.0.0/12"]
+
+      https-redirect {
+        port   = 80
+        status = 308
+      }
+
       listen {
-        port = 80
+        port = 443
+
+        tls {
+          cert        = "/etc/pipehub/server.pem"
+          key         = "/etc/pipehub/server-key.pem"
+          client-ca   = "/etc/pipehub/client-ca.pem"
+          client-auth = "verify-if-given"
+          min-version = "1.2"
+        }
       }
 
       action {
         not-found = "base.NotFound"
         panic     = "base.Panic"
       }
+
+      access-log {
+        format = "combined"
+        output = "stdout"
+        fields = ["host", "handler", "upstream", "latency", "request-id"]
+      }
+
+      request-id {
+        header = "X-Request-ID"
+        format = "uuid"
+      }
+
+      recovery {
+        disable-after = 5
+        window        = "1m"
+      }
     }
 
     client {
@@ -22,12 +75,161 @@ core {
       idle-conn-timeout       = "90s"
       tls-handshake-timeout   = "10s"
       expect-continue-timeout = "1s"
+
+      tls {
+        ca          = "/etc/pipehub/upstream-ca.pem"
+        cert        = "/etc/pipehub/client.pem"
+        key         = "/etc/pipehub/client-key.pem"
+        min-version = "1.2"
+      }
     }
   }
 }
 
 http "google" {
-  handler = "base.Default"
+  handler          = "base.Default"
+  max-request-body = 10485760
+
+  rate-limit {
+    algorithm = "token-bucket"
+    limit     = 100
+    burst     = 20
+    window    = "1s"
+    key       = "ip"
+  }
+
+  cache {
+    store          = "memory"
+    max-size       = 104857600
+    max-entry-size = 1048576
+    status-header  = "X-Cache"
+  }
+
+  compression {
+    algorithms        = ["br", "gzip", "deflate"]
+    types             = ["text/*", "application/json"]
+    min-size          = 1024
+    identity-upstream = true
+  }
+
+  request-buffering {
+    memory = 1048576
+    path   = "/tmp"
+  }
+
+  access-control {
+    allow   = ["10.0.0.0/8", "192.168.0.0/16"]
+    deny    = ["10.0.0.1"]
+    file    = "/etc/pipehub/access-control"
+    handler = "base.Forbidden"
+  }
+
+  cors {
+    origins         = ["https://example.com", "https://*.example.com"]
+    methods         = ["GET", "POST", "PUT", "DELETE"]
+    headers         = ["Authorization", "Content-Type"]
+    exposed-headers = ["X-Request-ID"]
+    credentials     = true
+    max-age         = "10m"
+  }
+
+  redirect {
+    match  = "^/blog/(.*)$"
+    target = "https://blog.example.com/$1"
+    status = 301
+  }
+
+  rewrite {
+    match        = "^/api/"
+    strip-prefix = "/api"
+    add-prefix   = "/v1"
+    host         = "api.internal"
+
+    request-header {
+      set    = { "X-Forwarded-Proto" = "https" }
+      remove = ["Cookie"]
+    }
+
+    response-header {
+      add    = { "X-Frame-Options" = "DENY" }
+      remove = ["Server"]
+    }
+
+    query {
+      remove = ["debug"]
+    }
+  }
+
+  mirror {
+    upstream      = "http://shadow.internal:8080"
+    percentage    = 5
+    max-body-size = 1048576
+    timeout       = "5s"
+    concurrency   = 16
+  }
+
+  rewrite {
+    path {
+      regex       = "^/users/([0-9]+)$"
+      replacement = "/v1/users/$1"
+    }
+  }
+
+  auth {
+    basic {
+      htpasswd = "/etc/pipehub/htpasswd"
+      realm    = "pipehub"
+    }
+
+    api-key {
+      file   = "/etc/pipehub/api-keys"
+      header = "X-API-Key"
+    }
+
+    jwt {
+      jwks-url     = "https://auth.example.com/.well-known/jwks.json"
+      jwks-refresh = "1h"
+      issuer       = "https://auth.example.com/"
+      audience     = "pipehub"
+    }
+  }
+}
+
+http "canary.example.com" {
+  split {
+    cookie          = "pipehub-variant"
+    header          = "X-User-ID"
+    override-header = "X-Pipehub-Variant"
+
+    variant {
+      name    = "stable"
+      handler = "base.Default"
+      weight  = 95
+    }
+
+    variant {
+      name     = "canary"
+      upstream = ["https://canary-1.internal", "https://canary-2.internal"]
+      weight   = 5
+    }
+  }
+}
+
+http "static.example.com" {
+  static {
+    root          = "/var/www/app"
+    index         = ["index.html"]
+    spa-fallback  = "index.html"
+    cache-control = "public, max-age=3600"
+    precompressed = true
+  }
+
+  maintenance {
+    page        = "/var/www/maintenance.html"
+    status      = 503
+    retry-after = "5m"
+    enabled     = false
+  }
 }
 
 pipe "github.com/pipehub/sample" {
@@ -37,4 +239,32 @@ pipe "github.com/pipehub/sample" {
   config {
     host = "https://www.google.com"
   }
+
+  lifecycle {
+    start-timeout = "30s"
+    start-failure = "abort"
+    depends-on    = []
+  }
+
+  timeout "Default" {
+    duration = "2s"
+    fallback = "base.Timeout"
+  }
+}
+
+pipe "github.com/pipehub/auth" {
+  version = "v0.2.0"
+  alias   = "auth"
+
+  instance "internal" {
+    config {
+      realm = "internal"
+    }
+  }
+
+  instance "public" {
+    config {
+      realm = "public"
+    }
+  }
 }
@@ -0,0 +1,23 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// reload the pipes configuration every time a SIGHUP is received.
+func reload(fn func() error) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			if err := fn(); err != nil {
+				logger.Error("reload error", "error", err)
+			}
+		}
+	}()
+}
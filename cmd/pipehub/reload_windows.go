@@ -0,0 +1,4 @@
+package main
+
+// reload is not supported on Windows as there is no SIGHUP.
+func reload(fn func() error) {}
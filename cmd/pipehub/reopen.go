@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// reopen the log files every time a SIGUSR1 is received, this is the signal sent by tools like
+// logrotate after the files are moved.
+func reopen(fn func() error) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1)
+	go func() {
+		for range ch {
+			if err := fn(); err != nil {
+				logger.Error("reopen error", "error", err)
+			}
+		}
+	}()
+}
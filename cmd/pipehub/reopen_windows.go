@@ -0,0 +1,4 @@
+package main
+
+// reopen is not supported on Windows as there is no SIGUSR1.
+func reopen(fn func() error) {}
@@ -3,8 +3,10 @@ module github.com/pipehub/pipehub
 go 1.15
 
 require (
+	github.com/andybalholm/brotli v1.0.4
 	github.com/go-chi/chi v4.1.2+incompatible
 	github.com/go-chi/hostrouter v0.0.0-20180220162504-7bff2694dfd9
+	github.com/golang-jwt/jwt/v4 v4.4.3
 	github.com/hashicorp/hcl v1.0.0
 	github.com/mitchellh/mapstructure v1.3.3
 	github.com/pkg/errors v0.9.1
@@ -12,4 +14,5 @@ require (
 	github.com/spf13/cobra v1.0.0
 	github.com/spf13/pflag v1.0.5 // indirect
 	github.com/stretchr/testify v1.6.1
+	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
 )
@@ -26,6 +26,8 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/spf13/afero"
+
+	"github.com/pipehub/pipehub/internal/infra/log"
 )
 
 // Place where the 'dynamic.go' file need to be written.
@@ -36,6 +38,7 @@ type ClientConfig struct {
 	// The filesystem should point to the root folder of the project.
 	Filesystem afero.Fs
 	Pipes      []Pipe
+	Logger     *log.Logger
 }
 
 // Client is used to dynamic generate files that allows pipes to be included at the final build.
@@ -61,12 +64,15 @@ func (c Client) Do() error {
 	if err := c.execDynamicTemplate(tmpl, tmplContent); err != nil {
 		return errors.Wrap(err, "template 'dynamic.go' execution error")
 	}
+	c.config.Logger.Debug("file generated", "file", "dynamic.go")
 
 	// Generate the 'go.mod' file.
 	if err := c.execGoModTemplate(tmpl, tmplContent); err != nil {
 		return errors.Wrap(err, "template 'go.mod' execution error")
 	}
+	c.config.Logger.Debug("file generated", "file", "go.mod")
 
+	c.config.Logger.Info("pipes generated", "count", len(tmplContent.Pipe))
 	return nil
 }
 
@@ -131,6 +137,7 @@ func (c Client) genTemplateContent() templateContent {
 			Alias:      pipe.Alias,
 			Revision:   pipe.Version,
 			Module:     pipe.Module,
+			Instances:  pipe.Instances,
 		}
 
 		pathFragments := strings.Split(pipe.ImportPath, "/")
@@ -164,6 +164,32 @@ func TestClientDo(t *testing.T) {
 			},
 			err: require.NoError,
 		},
+		{
+			name: "pipe with instances",
+			pipes: []Pipe{
+				{
+					ImportPath: "github.com/pipehub/auth",
+					Version:    "0.2.0",
+					Alias:      "auth",
+					Instances:  []string{"internal", "public"},
+				},
+				{
+					ImportPath: "github.com/pipehub/pipehub",
+					Version:    "0.1.0",
+					Alias:      "base",
+				},
+			},
+			templates: []string{
+				"template/go.mod.tmpl",
+				"template/dynamic.go.tmpl",
+			},
+			goMod: "testdata/go.mod.1.input",
+			output: map[string]string{
+				"go.mod":     "testdata/go.mod.7.output",
+				"dynamic.go": "testdata/dynamic.go.7.output",
+			},
+			err: require.NoError,
+		},
 	}
 
 	for _, tt := range tests {
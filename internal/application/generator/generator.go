@@ -10,6 +10,9 @@ type Pipe struct {
 	Module     string
 	Version    string
 	Alias      string
+
+	// Instances are the names of the pipe instances, if empty, a single unnamed instance is created.
+	Instances []string
 }
 
 type templateContent struct {
@@ -23,6 +26,7 @@ type templateContentPipe struct {
 	Alias           string // Overwrite the above path alias value.
 	Revision        string
 	Module          string
+	Instances       []string
 }
 
 type templateContentPipeSlice []templateContentPipe
@@ -7,18 +7,22 @@ import (
 
 	"github.com/pipehub/pipehub/internal"
 	"github.com/pipehub/pipehub/internal/application/server/service/pipe"
+	"github.com/pipehub/pipehub/internal/application/server/service/store"
 	transportHTTP "github.com/pipehub/pipehub/internal/application/server/transport/http"
+	"github.com/pipehub/pipehub/internal/infra/log"
 )
 
 // ClientConfig is used to initialize the server.
 type ClientConfig struct {
+	Logger    *log.Logger
 	Pipe      []internal.Pipe
 	Service   ClientConfigService
 	Transport ClientConfigTransport
 }
 
 type ClientConfigService struct {
-	Pipe ClientConfigServicePipe
+	Pipe  ClientConfigServicePipe
+	Store store.Config
 }
 
 type ClientConfigServicePipe struct {
@@ -34,6 +38,7 @@ type Client struct {
 	service struct {
 		manager pipe.Manager
 		http    pipe.HTTP
+		store   store.Store
 	}
 
 	transport struct {
@@ -43,21 +48,56 @@ type Client struct {
 	config ClientConfig
 }
 
-// Start the server.
-func (c *Client) Start() error {
-	var err error
-	c.service.manager, err = pipe.NewManager(c.config.Pipe)
+// Start the server. When the start fails, the services already initialized are closed.
+func (c *Client) Start() (err error) {
+	c.config.Service.Store.Logger = c.config.Logger
+	c.service.store, err = store.New(c.config.Service.Store)
+	if err != nil {
+		return errors.Wrap(err, "store service initialization error")
+	}
+
+	var closeManager bool
+	defer func() {
+		if err == nil {
+			return
+		}
+		if closeManager {
+			if closeErr := c.service.manager.Close(context.Background()); closeErr != nil {
+				c.config.Logger.Error("manager service close error", "error", closeErr)
+			}
+		}
+		if closeErr := c.service.store.Close(); closeErr != nil {
+			c.config.Logger.Error("store service close error", "error", closeErr)
+		}
+	}()
+
+	c.service.manager, err = pipe.NewManager(pipe.ManagerConfig{
+		Pipe:   c.config.Pipe,
+		Logger: c.config.Logger,
+		Store:  c.service.store,
+	})
 	if err != nil {
 		return errors.Wrap(err, "manager service initialization error")
 	}
+	closeManager = true
+
+	if err := c.service.manager.Start(context.Background()); err != nil {
+		// The manager close the pipes by itself when the start is aborted.
+		closeManager = false
+		return errors.Wrap(err, "manager service start error")
+	}
 
 	c.config.Service.Pipe.HTTP.Instance = c.service.manager
+	c.config.Service.Pipe.HTTP.Logger = c.config.Logger
 	c.service.http, err = pipe.NewHTTP(c.config.Service.Pipe.HTTP)
 	if err != nil {
 		return errors.Wrap(err, "http service initialization error")
 	}
 
 	c.config.Transport.HTTP.HandlerFetcher = &c.service.http
+	c.config.Transport.HTTP.PipeHealth = &c.service.manager
+	c.config.Transport.HTTP.Store = c.service.store
+	c.config.Transport.HTTP.Logger = c.config.Logger
 	c.transport.http, err = transportHTTP.NewServer(c.config.Transport.HTTP)
 	if err != nil {
 		return errors.Wrap(err, "transport http initialization error")
@@ -80,9 +120,23 @@ func (c *Client) Stop(ctx context.Context) error {
 		return errors.Wrap(err, "manager service stop error")
 	}
 
+	if err := c.service.store.Close(); err != nil {
+		return errors.Wrap(err, "store service stop error")
+	}
+
 	return nil
 }
 
+// Reopen the log files, this is used to support log rotation.
+func (c *Client) Reopen() error {
+	return errors.Wrap(c.transport.http.Reopen(), "transport http reopen error")
+}
+
+// Reload send the new configuration to the pipes that support it.
+func (c *Client) Reload(pipes []internal.Pipe) error {
+	return errors.Wrap(c.service.manager.Reload(pipes), "manager service reload error")
+}
+
 // NewClient initialize the client.
 // nolint: gocritic
 func NewClient(config ClientConfig) Client {
@@ -0,0 +1,183 @@
+package pipe
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Error is the failure of a single pipe.
+type Error struct {
+	// Pipe is the import path alias of the pipe.
+	Pipe string
+
+	// Timeout is true if the pipe didn't finish before the context deadline.
+	Timeout bool
+
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Timeout {
+		return fmt.Sprintf("pipe '%s' timeout: %s", e.Pipe, e.Err)
+	}
+	return fmt.Sprintf("pipe '%s': %s", e.Pipe, e.Err)
+}
+
+// Unwrap return the pipe error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// MultiError holds the errors of many pipes, ordered by the pipe alias.
+type MultiError struct {
+	Errors []*Error
+}
+
+func (e *MultiError) Error() string {
+	values := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		values = append(values, err.Error())
+	}
+	return fmt.Sprintf("%d pipe errors: %s", len(e.Errors), strings.Join(values, "; "))
+}
+
+// Timeouts return the alias of the pipes that timed out.
+func (e *MultiError) Timeouts() []string {
+	var pipes []string
+	for _, err := range e.Errors {
+		if err.Timeout {
+			pipes = append(pipes, err.Pipe)
+		}
+	}
+	return pipes
+}
+
+// Close the initialized pipes concurrently. A pipe is only closed after the pipes that depend on it
+// are closed. The error, if any, is a *MultiError.
+func (m *Manager) Close(ctx context.Context) error {
+	m.mutex.RLock()
+	dependents := m.dependents()
+	m.mutex.RUnlock()
+
+	done := make(map[string]chan struct{}, len(m.instances))
+	for importPathAlias := range m.instances {
+		done[importPathAlias] = make(chan struct{})
+	}
+
+	var (
+		mutex sync.Mutex
+		wg    sync.WaitGroup
+		errs  []*Error
+	)
+	for importPathAlias, pipe := range m.instances {
+		wg.Add(1)
+		go func(importPathAlias string, pipe instance) {
+			defer wg.Done()
+			defer close(done[importPathAlias])
+
+			err := m.close(ctx, pipe, dependents[importPathAlias], done)
+			if err == nil {
+				return
+			}
+			err.Pipe = importPathAlias
+
+			mutex.Lock()
+			errs = append(errs, err)
+			mutex.Unlock()
+		}(importPathAlias, pipe)
+	}
+	wg.Wait()
+
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Pipe < errs[j].Pipe })
+	return &MultiError{Errors: errs}
+}
+
+// close wait for the dependents to be closed and then close the pipe, the wait and the close are
+// limited by the context deadline.
+func (Manager) close(
+	ctx context.Context, instance instance, dependents []string, done map[string]chan struct{},
+) *Error {
+	for _, dependent := range dependents {
+		select {
+		case <-done[dependent]:
+		case <-ctx.Done():
+			err := errors.Wrapf(ctx.Err(), "waiting for pipe '%s' to close", dependent)
+			return &Error{Timeout: true, Err: err}
+		}
+	}
+
+	result := make(chan error, 1)
+	go func() { result <- instance.Close(ctx) }()
+
+	select {
+	case err := <-result:
+		if err == nil {
+			return nil
+		}
+		return &Error{Timeout: errors.Is(err, context.DeadlineExceeded), Err: err}
+	case <-ctx.Done():
+		return &Error{Timeout: true, Err: ctx.Err()}
+	}
+}
+
+// dependents return, by pipe, the pipes that depend on it.
+func (m Manager) dependents() map[string][]string {
+	dependents := make(map[string][]string)
+	for importPathAlias, instance := range m.instances {
+		for _, dependency := range m.lifecycle(instance).DependsOn {
+			dependents[dependency] = append(dependents[dependency], importPathAlias)
+		}
+	}
+	return dependents
+}
+
+// validDependencies check if the dependencies exist and if there is no cycle between them, a cycle
+// would block the close until the deadline.
+func (m Manager) validDependencies() error {
+	for importPathAlias, instance := range m.instances {
+		for _, dependency := range m.lifecycle(instance).DependsOn {
+			if _, ok := m.instances[dependency]; !ok {
+				return fmt.Errorf("pipe '%s' depends on the unknown pipe '%s'", importPathAlias, dependency)
+			}
+		}
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(m.instances))
+	var visit func(string) error
+	visit = func(importPathAlias string) error {
+		switch state[importPathAlias] {
+		case visiting:
+			return fmt.Errorf("dependency cycle detected at pipe '%s'", importPathAlias)
+		case visited:
+			return nil
+		}
+
+		state[importPathAlias] = visiting
+		for _, dependency := range m.lifecycle(m.instances[importPathAlias]).DependsOn {
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+		state[importPathAlias] = visited
+		return nil
+	}
+
+	for _, importPathAlias := range m.order() {
+		if err := visit(importPathAlias); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package pipe
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+type closeClient struct {
+	name   string
+	mutex  *sync.Mutex
+	closed *[]string
+	delay  time.Duration
+	err    error
+}
+
+func (cc closeClient) Close(ctx context.Context) error {
+	select {
+	case <-time.After(cc.delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	cc.mutex.Lock()
+	*cc.closed = append(*cc.closed, cc.name)
+	cc.mutex.Unlock()
+	return cc.err
+}
+
+func TestManagerClose(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name             string
+		delay            time.Duration
+		err              error
+		expectedClosed   []string
+		expectedErrors   []string
+		expectedTimeouts []string
+	}{
+		{
+			name:           "dependency order",
+			expectedClosed: []string{"api", "cache", "db"},
+		},
+		{
+			name:           "error",
+			err:            errors.New("failed"),
+			expectedClosed: []string{"api", "cache", "db"},
+			expectedErrors: []string{"api"},
+		},
+		{
+			name:             "timeout",
+			delay:            time.Second,
+			expectedErrors:   []string{"api", "cache", "db"},
+			expectedTimeouts: []string{"api", "cache", "db"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				mutex  sync.Mutex
+				closed []string
+			)
+			client := func(name string, delay time.Duration, err error) instance {
+				return instance{
+					id:         "github.com/pipehub/" + name,
+					importPath: "github.com/pipehub/" + name,
+					instancer:  closeClient{name: name, mutex: &mutex, closed: &closed, delay: delay, err: err},
+				}
+			}
+
+			m := Manager{
+				settings: ManagerConfig{
+					Pipe: []internal.Pipe{
+						{ImportPath: "github.com/pipehub/db"},
+						{
+							ImportPath: "github.com/pipehub/cache",
+							Lifecycle:  internal.PipeLifecycle{DependsOn: []string{"db"}},
+						},
+						{
+							ImportPath: "github.com/pipehub/api",
+							Lifecycle:  internal.PipeLifecycle{DependsOn: []string{"cache", "db"}},
+						},
+					},
+				},
+				instances: map[string]instance{
+					"db":    client("db", 0, nil),
+					"cache": client("cache", 0, nil),
+					"api":   client("api", tt.delay, tt.err),
+				},
+				mutex: &sync.RWMutex{},
+			}
+			require.NoError(t, m.validDependencies())
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			err := m.Close(ctx)
+			require.Equal(t, tt.expectedClosed, closed)
+			if tt.expectedErrors == nil {
+				require.NoError(t, err)
+				return
+			}
+
+			var multiErr *MultiError
+			require.True(t, errors.As(err, &multiErr))
+			var pipes []string
+			for _, pipeErr := range multiErr.Errors {
+				pipes = append(pipes, pipeErr.Pipe)
+			}
+			require.Equal(t, tt.expectedErrors, pipes)
+			require.Equal(t, tt.expectedTimeouts, multiErr.Timeouts())
+		})
+	}
+}
+
+func TestManagerValidDependencies(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		dependsOn  map[string][]string
+		shouldFail bool
+	}{
+		{"valid", map[string][]string{"api": {"db"}}, false},
+		{"unknown", map[string][]string{"api": {"queue"}}, true},
+		{"cycle", map[string][]string{"api": {"db"}, "db": {"api"}}, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var m Manager
+			m.instances = make(map[string]instance)
+			for _, name := range []string{"api", "db"} {
+				m.settings.Pipe = append(m.settings.Pipe, internal.Pipe{
+					ImportPath: "github.com/pipehub/" + name,
+					Lifecycle:  internal.PipeLifecycle{DependsOn: tt.dependsOn[name]},
+				})
+				m.instances[name] = instance{id: "github.com/pipehub/" + name, importPath: "github.com/pipehub/" + name}
+			}
+			require.Equal(t, tt.shouldFail, m.validDependencies() != nil)
+		})
+	}
+}
+
+func TestManagerResolveDependencies(t *testing.T) {
+	t.Parallel()
+
+	var m Manager
+	m.instances = make(map[string]instance)
+	for _, name := range []string{"auth@internal", "auth@public"} {
+		m.instances[name] = instance{}
+	}
+	m.settings.Pipe = []internal.Pipe{
+		{ImportPath: "github.com/pipehub/api", Lifecycle: internal.PipeLifecycle{DependsOn: []string{"auth"}}},
+	}
+	m.instances["api"] = instance{id: "github.com/pipehub/api", importPath: "github.com/pipehub/api"}
+
+	require.Equal(
+		t,
+		[]string{"auth@internal", "auth@public", "api", "queue"},
+		m.resolveDependencies([]string{"auth", "api", "queue"}),
+	)
+	require.NoError(t, m.validDependencies())
+	require.Equal(t, []string{"auth@internal", "auth@public"}, m.lifecycle(m.instances["api"]).DependsOn)
+}
@@ -0,0 +1,146 @@
+package pipe
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+// configTagName is the struct tag used by the pipes to name the configuration keys.
+const configTagName = "config"
+
+// configValidator is implemented by the configuration structs that need more validation than the
+// types and the unknown keys.
+type configValidator interface {
+	Validate() error
+}
+
+// decodeConfig convert the pipe configuration into the struct, or pointer to a struct, the pipe
+// constructor expect. The keys are named by the 'config' tag, the default values by the 'default'
+// tag and durations can be used as strings, for example:
+//
+//	type Config struct {
+//		Host    string        `config:"host"`
+//		Timeout time.Duration `config:"timeout" default:"5s"`
+//	}
+//
+// Unknown keys are reported as errors with the path of the field.
+func decodeConfig(cfg map[string]interface{}, target reflect.Type) (reflect.Value, error) {
+	structType := target
+	if structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+	value := reflect.New(structType)
+
+	if defaults := configDefaults(structType); len(defaults) > 0 {
+		decoder, err := configDecoder(value.Interface(), true)
+		if err != nil {
+			return reflect.Value{}, errors.Wrap(err, "decoder initialization error")
+		}
+		if err := decoder.Decode(defaults); err != nil {
+			return reflect.Value{}, errors.Wrap(err, "default values decode error")
+		}
+	}
+
+	decoder, err := configDecoder(value.Interface(), false)
+	if err != nil {
+		return reflect.Value{}, errors.Wrap(err, "decoder initialization error")
+	}
+	if err := decoder.Decode(cfg); err != nil {
+		return reflect.Value{}, err
+	}
+
+	if validator, ok := value.Interface().(configValidator); ok {
+		if err := validator.Validate(); err != nil {
+			return reflect.Value{}, errors.Wrap(err, "validation error")
+		}
+	}
+
+	if target.Kind() == reflect.Ptr {
+		return value, nil
+	}
+	return value.Elem(), nil
+}
+
+// configStruct check if the constructor configuration parameter should be decoded.
+func configStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// configDecoder create the decoder. The default values are decoded with weakly typed input as they
+// are always strings.
+func configDecoder(result interface{}, weak bool) (*mapstructure.Decoder, error) {
+	return mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			configBlockHook,
+			mapstructure.StringToTimeDurationHookFunc(),
+		),
+		ErrorUnused:      true,
+		WeaklyTypedInput: weak,
+		TagName:          configTagName,
+		Result:           result,
+	})
+}
+
+// configBlockHook unwrap the HCL blocks, they are decoded as a slice of maps even if there is only
+// one block.
+func configBlockHook(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if (to.Kind() != reflect.Struct) && (to.Kind() != reflect.Map) {
+		return data, nil
+	}
+
+	blocks, ok := data.([]map[string]interface{})
+	if !ok {
+		return data, nil
+	}
+	switch len(blocks) {
+	case 0:
+		return map[string]interface{}{}, nil
+	case 1:
+		return blocks[0], nil
+	default:
+		return nil, errors.New("more then one block found, only one is allowed")
+	}
+}
+
+// configDefaults extract the 'default' tag values by the configuration key.
+func configDefaults(structType reflect.Type) map[string]interface{} {
+	defaults := make(map[string]interface{})
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		name := configFieldName(field)
+		if (field.PkgPath != "") || (name == "-") {
+			continue
+		}
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if (fieldType.Kind() == reflect.Struct) && (fieldType != reflect.TypeOf(time.Time{})) {
+			if nested := configDefaults(fieldType); len(nested) > 0 {
+				defaults[name] = nested
+			}
+			continue
+		}
+
+		if value, ok := field.Tag.Lookup("default"); ok {
+			defaults[name] = value
+		}
+	}
+	return defaults
+}
+
+func configFieldName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get(configTagName), ",")[0]
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
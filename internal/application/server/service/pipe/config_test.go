@@ -0,0 +1,96 @@
+package pipe
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type configTest struct {
+	Host    string        `config:"host"`
+	Timeout time.Duration `config:"timeout" default:"5s"`
+	Retries int           `config:"retries" default:"3"`
+	Server  struct {
+		Port int    `config:"port" default:"8080"`
+		Name string `config:"name"`
+	} `config:"server"`
+}
+
+func (c configTest) Validate() error {
+	if c.Host == "" {
+		return errors.New("missing host")
+	}
+	return nil
+}
+
+func TestDecodeConfig(t *testing.T) {
+	t.Parallel()
+
+	expected := func(fn func(*configTest)) configTest {
+		c := configTest{Host: "example.com", Timeout: 5 * time.Second, Retries: 3}
+		c.Server.Port = 8080
+		fn(&c)
+		return c
+	}
+
+	tests := []struct {
+		name       string
+		cfg        map[string]interface{}
+		expected   configTest
+		shouldFail bool
+	}{
+		{
+			name:     "defaults",
+			cfg:      map[string]interface{}{"host": "example.com"},
+			expected: expected(func(*configTest) {}),
+		},
+		{
+			name: "values",
+			cfg: map[string]interface{}{
+				"host":    "example.com",
+				"timeout": "1m",
+				"server":  []map[string]interface{}{{"name": "api"}},
+			},
+			expected: expected(func(c *configTest) {
+				c.Timeout = time.Minute
+				c.Server.Name = "api"
+			}),
+		},
+		{
+			name:       "unknown key",
+			cfg:        map[string]interface{}{"host": "example.com", "server": map[string]interface{}{"address": ":80"}},
+			shouldFail: true,
+		},
+		{
+			name:       "invalid duration",
+			cfg:        map[string]interface{}{"host": "example.com", "timeout": "soon"},
+			shouldFail: true,
+		},
+		{
+			name:       "validation",
+			cfg:        map[string]interface{}{},
+			shouldFail: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			value, err := decodeConfig(tt.cfg, reflect.TypeOf(configTest{}))
+			require.Equal(t, tt.shouldFail, err != nil)
+			if tt.shouldFail {
+				return
+			}
+			require.Equal(t, tt.expected, value.Interface())
+
+			value, err = decodeConfig(tt.cfg, reflect.TypeOf(&configTest{}))
+			require.NoError(t, err)
+			require.Equal(t, &tt.expected, value.Interface())
+		})
+	}
+}
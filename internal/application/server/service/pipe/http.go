@@ -6,6 +6,18 @@ import (
 	"reflect"
 
 	"github.com/pkg/errors"
+
+	"github.com/pipehub/pipehub/internal/infra/log"
+)
+
+// httpContextKeyRequestID is the key the transport use to store the request ID at the request
+// context, it's a plain string as it's also read by the pipes.
+const httpContextKeyRequestID = "pipehub.request-id"
+
+const (
+	httpMiddlewareSignatures = "'func(http.Handler) http.Handler'"
+	httpHandlerSignatures    = "'func(http.ResponseWriter, *http.Request)', " +
+		"'func(http.ResponseWriter, *http.Request) error', 'func() http.Handler' or 'func() http.HandlerFunc'"
 )
 
 type httpInstance interface {
@@ -17,6 +29,10 @@ type HTTPConfig struct {
 	Entry         []HTTPConfigEntry
 	DefaultAction HTTPConfigDefaultAction
 	Instance      httpInstance
+	Logger        *log.Logger
+
+	// Timeout by handler, like 'base.Default'.
+	Timeout map[string]HTTPConfigTimeout
 }
 
 // HTTPConfigDefaultAction set the HTTP default actions.
@@ -31,76 +47,228 @@ type HTTPConfigEntry struct {
 	Handler  string
 }
 
+// httpFunc is a pipe method already converted to the type used by the transport, only one of the
+// fields is set.
+type httpFunc struct {
+	middleware func(http.Handler) http.Handler
+	handler    func(http.ResponseWriter, *http.Request)
+	signature  reflect.Type
+}
+
 // HTTP is used to extract all the missing information from the HTTP transport.
 type HTTP struct {
 	config    HTTPConfig
 	instances map[string]instance
+	fns       map[string]httpFunc
 }
 
 // Middleware returns a middleware entry.
 func (h *HTTP) Middleware(id string) (func(http.Handler) http.Handler, error) {
-	rawFn, err := h.extractFn(id)
+	fn, err := h.fetchFn(id)
 	if err != nil {
 		return nil, err
 	}
 
-	fn, ok := rawFn.(func(http.Handler) http.Handler)
-	if !ok {
-		return nil, errors.New("could not cast the function into 'func(http.Handler) http.Handler'")
+	if fn.middleware == nil {
+		return nil, fmt.Errorf(
+			"'%s' has the signature '%s', a middleware is expected, the accepted signature is %s",
+			id, fn.signature, httpMiddlewareSignatures,
+		)
 	}
-
-	return fn, nil
+	return fn.middleware, nil
 }
 
 // Handler return a handler entry.
 func (h *HTTP) Handler(id string) (func(http.ResponseWriter, *http.Request), error) {
-	rawFn, err := h.extractFn(id)
+	fn, err := h.fetchFn(id)
 	if err != nil {
 		return nil, err
 	}
 
-	fn, ok := rawFn.(func(http.ResponseWriter, *http.Request))
-	if !ok {
-		return nil, errors.New("could not cast the function into 'func(http.Handler) http.Handler'")
+	if fn.handler == nil {
+		return nil, fmt.Errorf(
+			"'%s' has the signature '%s', a handler is expected, the accepted signatures are %s",
+			id, fn.signature, httpHandlerSignatures,
+		)
 	}
+	return fn.handler, nil
+}
 
+func (h *HTTP) fetchFn(id string) (httpFunc, error) {
+	fn, ok := h.fns[id]
+	if !ok {
+		return httpFunc{}, fmt.Errorf("'%s' was not resolved at the initialization, it's not at the configuration", id)
+	}
 	return fn, nil
 }
 
-// init fetch all the pipe instances using the path import alias.
+// init fetch all the pipe instances using the path import alias and resolve the functions referenced
+// at the configuration, this way the reflection is only used once and invalid signatures are found
+// at the start.
 func (h *HTTP) init() error {
+	ids := []string{h.config.DefaultAction.NotFound, h.config.DefaultAction.Panic}
 	for _, entry := range h.config.Entry {
-		importPathAlias, _, err := extractPipeHandler(entry.Handler)
+		ids = append(ids, entry.Handler)
+	}
+
+	for _, id := range ids {
+		// The entries served by the static handler may not have a handler.
+		if id == "" {
+			continue
+		}
+		if _, ok := h.fns[id]; ok {
+			continue
+		}
+
+		fn, err := h.resolveFn(id)
 		if err != nil {
-			return errors.Wrap(err, "could not extract import path alias and function entry")
+			return errors.Wrapf(err, "resolve '%s' error", id)
+		}
+		h.fns[id] = fn
+	}
+
+	for id, config := range h.config.Timeout {
+		fn, ok := h.fns[id]
+		if !ok {
+			// A handler not used by the hosts don't need the timeout, but it should exist, otherwise a
+			// typo would disable the timeout without notice. It happen with the named instances, the
+			// timeout is set to the handlers of all the instances.
+			if _, err := h.resolveFn(id); err != nil {
+				return errors.Wrapf(err, "timeout of unknown handler '%s'", id)
+			}
+			continue
 		}
 
-		instance, err := h.config.Instance.Fetch(importPathAlias)
+		timeout, err := h.timeout(id, config)
 		if err != nil {
-			return errors.Wrapf(err, "failed to fetch instance of '%s'", importPathAlias)
+			return errors.Wrapf(err, "timeout of '%s' error", id)
 		}
-		h.instances[importPathAlias] = instance
+		if fn.middleware != nil {
+			fn.middleware = timeout.middleware(fn.middleware)
+		} else {
+			fn.handler = timeout.handler(fn.handler)
+		}
+		h.fns[id] = fn
 	}
 	return nil
 }
 
-func (h *HTTP) extractFn(id string) (interface{}, error) {
+func (h *HTTP) timeout(id string, config HTTPConfigTimeout) (httpTimeout, error) {
+	if config.Duration <= 0 {
+		return httpTimeout{}, fmt.Errorf("invalid duration '%s', it should be bigger then zero", config.Duration)
+	}
+
+	timeout := httpTimeout{id: id, duration: config.Duration, logger: h.config.Logger}
+	if config.Fallback == "" {
+		return timeout, nil
+	}
+
+	fallback, err := h.resolveFn(config.Fallback)
+	if err != nil {
+		return httpTimeout{}, errors.Wrapf(err, "resolve fallback '%s' error", config.Fallback)
+	}
+	if fallback.handler == nil {
+		return httpTimeout{}, fmt.Errorf(
+			"fallback '%s' has the signature '%s', a handler is expected, the accepted signatures are %s",
+			config.Fallback, fallback.signature, httpHandlerSignatures,
+		)
+	}
+	timeout.fallback = fallback.handler
+	return timeout, nil
+}
+
+func (h *HTTP) resolveFn(id string) (httpFunc, error) {
 	importPathAlias, fnName, err := extractPipeHandler(id)
 	if err != nil {
-		return nil, errors.Wrap(err, "could not extract import path alias and function entry")
+		return httpFunc{}, errors.Wrap(err, "could not extract import path alias and function entry")
 	}
 
 	instance, ok := h.instances[importPathAlias]
 	if !ok {
-		return nil, fmt.Errorf("no instance is associated with '%s'", importPathAlias)
+		instance, err = h.config.Instance.Fetch(importPathAlias)
+		if err != nil {
+			return httpFunc{}, errors.Wrapf(err, "failed to fetch instance of '%s'", importPathAlias)
+		}
+		h.instances[importPathAlias] = instance
 	}
 
 	rawFn := reflect.ValueOf(instance.instancer).MethodByName(fnName)
 	if !rawFn.IsValid() {
-		return nil, fmt.Errorf("invalid method '%s'", fnName)
+		return httpFunc{}, fmt.Errorf("pipe '%s' don't have the method '%s'", importPathAlias, fnName)
 	}
 
-	return rawFn.Interface(), nil
+	fn := httpFunc{signature: rawFn.Type()}
+	switch raw := rawFn.Interface().(type) {
+	case func(http.Handler) http.Handler:
+		fn.middleware = raw
+	case func(http.ResponseWriter, *http.Request):
+		fn.handler = raw
+	case func(http.ResponseWriter, *http.Request) error:
+		fn.handler = h.errorHandler(id, raw)
+	case func() http.Handler:
+		handler := raw()
+		if handler == nil {
+			return httpFunc{}, errors.New("the method returned a nil handler")
+		}
+		fn.handler = handler.ServeHTTP
+	case func() http.HandlerFunc:
+		handler := raw()
+		if handler == nil {
+			return httpFunc{}, errors.New("the method returned a nil handler")
+		}
+		fn.handler = handler
+	default:
+		return httpFunc{}, fmt.Errorf(
+			"unsupported signature '%s', the accepted signatures are %s for middlewares and %s for handlers",
+			fn.signature, httpMiddlewareSignatures, httpHandlerSignatures,
+		)
+	}
+	return fn, nil
+}
+
+// errorHandler convert a handler that return a error. The error is logged and, if nothing was
+// written yet, a internal server error is returned.
+func (h *HTTP) errorHandler(
+	id string, fn func(http.ResponseWriter, *http.Request) error,
+) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ew := &httpErrorWriter{ResponseWriter: w}
+		if err := fn(ew, r); err != nil {
+			h.config.Logger.Error("pipe handler error", "handler", id, "error", err, "request_id", requestID(r))
+			if !ew.wroteHeader {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+		}
+	}
+}
+
+// httpErrorWriter track if the response was already started.
+type httpErrorWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (ew *httpErrorWriter) WriteHeader(status int) {
+	ew.wroteHeader = true
+	ew.ResponseWriter.WriteHeader(status)
+}
+
+func (ew *httpErrorWriter) Write(p []byte) (int, error) {
+	ew.wroteHeader = true
+	return ew.ResponseWriter.Write(p)
+}
+
+func (ew *httpErrorWriter) Flush() {
+	if f, ok := ew.ResponseWriter.(http.Flusher); ok {
+		ew.wroteHeader = true
+		f.Flush()
+	}
+}
+
+// requestID return the request ID, it's empty if the request ID is disabled.
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(httpContextKeyRequestID).(string) // nolint: errcheck
+	return id
 }
 
 // NewHTTP return a configured HTTP struct.
@@ -108,6 +276,7 @@ func NewHTTP(config HTTPConfig) (HTTP, error) {
 	h := HTTP{
 		config:    config,
 		instances: make(map[string]instance),
+		fns:       make(map[string]httpFunc),
 	}
 	if err := h.init(); err != nil {
 		return h, errors.Wrap(err, "initialization error")
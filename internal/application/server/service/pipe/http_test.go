@@ -0,0 +1,123 @@
+package pipe
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type httpFetcher map[string]instance
+
+func (hf httpFetcher) Fetch(importPathAlias string) (instance, error) {
+	i, ok := hf[importPathAlias]
+	if !ok {
+		return i, errors.New("instance not found")
+	}
+	return i, nil
+}
+
+type httpClient struct{}
+
+func (httpClient) Close(context.Context) error { return nil }
+
+func (httpClient) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Middleware", "true")
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (httpClient) Default(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (httpClient) Failure(http.ResponseWriter, *http.Request) error {
+	return errors.New("failed")
+}
+
+func (httpClient) Handler() http.Handler {
+	return http.NotFoundHandler()
+}
+
+func (httpClient) HandlerFunc() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusNoContent) }
+}
+
+func (httpClient) Invalid(string) {}
+
+func TestHTTP(t *testing.T) {
+	t.Parallel()
+
+	h, err := NewHTTP(HTTPConfig{
+		Entry: []HTTPConfigEntry{
+			{Endpoint: "a", Handler: "base.Middleware"},
+			{Endpoint: "b", Handler: "base.Default"},
+			{Endpoint: "c", Handler: "base.Failure"},
+			{Endpoint: "d", Handler: "base.Handler"},
+			{Endpoint: "e", Handler: "base.HandlerFunc"},
+			{Endpoint: "f"},
+		},
+		Instance: httpFetcher{"base": {instancer: httpClient{}}},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		id         string
+		middleware bool
+		status     int
+		shouldFail bool
+	}{
+		{"middleware", "base.Middleware", true, http.StatusOK, false},
+		{"handler as middleware", "base.Default", true, 0, true},
+		{"middleware as handler", "base.Middleware", false, 0, true},
+		{"handler", "base.Default", false, http.StatusAccepted, false},
+		{"error handler", "base.Failure", false, http.StatusInternalServerError, false},
+		{"http.Handler", "base.Handler", false, http.StatusNotFound, false},
+		{"http.HandlerFunc", "base.HandlerFunc", false, http.StatusNoContent, false},
+		{"not at the configuration", "base.Other", false, 0, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var handler http.Handler
+			if tt.middleware {
+				middleware, err := h.Middleware(tt.id)
+				require.Equal(t, tt.shouldFail, err != nil)
+				if tt.shouldFail {
+					return
+				}
+				handler = middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+			} else {
+				fn, err := h.Handler(tt.id)
+				require.Equal(t, tt.shouldFail, err != nil)
+				if tt.shouldFail {
+					return
+				}
+				handler = http.HandlerFunc(fn)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			require.Equal(t, tt.status, w.Code)
+		})
+	}
+}
+
+func TestHTTPInvalidSignature(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewHTTP(HTTPConfig{
+		Entry:    []HTTPConfigEntry{{Endpoint: "a", Handler: "base.Invalid"}},
+		Instance: httpFetcher{"base": {instancer: httpClient{}}},
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unsupported signature 'func(string)'")
+}
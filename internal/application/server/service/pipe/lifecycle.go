@@ -0,0 +1,331 @@
+package pipe
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+const (
+	lifecycleStartFailureAbort    = "abort"
+	lifecycleStartFailureContinue = "continue"
+	lifecycleDefaultStartTimeout  = 30 * time.Second
+)
+
+// The lifecycle interfaces are optional, the manager detect them at the pipe client. As the pipes
+// can't import PipeHub packages, the pipes only need to have the methods.
+
+// starter is implemented by the pipes that need to do some work before receive requests, like warm
+// caches or open connections.
+type starter interface {
+	Start(ctx context.Context) error
+}
+
+// healthChecker is implemented by the pipes that can report their health.
+type healthChecker interface {
+	Health(ctx context.Context) error
+}
+
+// reloadMethod return the 'Reload' method of the pipes that can apply a new configuration without a
+// restart. Like the constructor, the method receive the configuration as a map or as a struct:
+//
+//	func (c Client) Reload(cfg map[string]interface{}) error
+//	func (c Client) Reload(cfg Config) error
+func reloadMethod(client instancer) (reflect.Value, bool) {
+	method := reflect.ValueOf(client).MethodByName("Reload")
+	if !method.IsValid() {
+		return reflect.Value{}, false
+	}
+
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+	if t := method.Type(); (t.NumIn() != 1) || (t.NumOut() != 1) || (t.Out(0) != errorType) {
+		return reflect.Value{}, false
+	}
+	return method, true
+}
+
+// Start call the 'Start' method of the pipes, the dependencies of a pipe are started before it,
+// otherwise, the pipes are started in the order they are declared at the configuration. Each pipe has
+// a deadline to start, if the pipe don't return in time, it's considered a failure. When the start is
+// aborted, all the pipes are closed in the reverse order, this way the pipes already started are
+// closed before their dependencies, and the manager should not be closed again.
+func (m *Manager) Start(ctx context.Context) error {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	order := m.startOrder()
+	for _, importPathAlias := range order {
+		instance := m.instances[importPathAlias]
+		s, ok := instance.instancer.(starter)
+		if !ok {
+			continue
+		}
+
+		lifecycle := m.lifecycle(instance)
+		if err := m.start(ctx, s, lifecycle.StartTimeout); err != nil {
+			err = errors.Wrapf(err, "pipe '%s' start error", importPathAlias)
+			if lifecycle.StartFailure == lifecycleStartFailureAbort {
+				m.abort(ctx, order)
+				return err
+			}
+			m.settings.Logger.Error("pipe start failed, continuing", "pipe", importPathAlias, "error", err)
+			continue
+		}
+		m.settings.Logger.Debug("pipe started", "pipe", importPathAlias)
+	}
+	return nil
+}
+
+// abort close the pipes in the reverse order. The errors are only logged as the start error is the
+// one returned.
+func (m *Manager) abort(ctx context.Context, order []string) {
+	for i := len(order) - 1; i >= 0; i-- {
+		if err := m.close(ctx, m.instances[order[i]], nil, nil); err != nil {
+			m.settings.Logger.Error("pipe close error", "pipe", order[i], "error", err.Err)
+		}
+	}
+}
+
+// start run the pipe 'Start' method, the method is not trusted to respect the context deadline.
+func (Manager) start(ctx context.Context, s starter, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result := make(chan error, 1)
+	go func() { result <- s.Start(ctx) }()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return errors.Wrapf(ctx.Err(), "timeout after %s", timeout)
+	}
+}
+
+// Health return the health of the pipes that can report it. A nil error means the pipe is healthy.
+func (m *Manager) Health(ctx context.Context) map[string]error {
+	result := make(map[string]error)
+	for importPathAlias, instance := range m.instances {
+		if h, ok := instance.instancer.(healthChecker); ok {
+			result[importPathAlias] = h.Health(ctx)
+		}
+	}
+	return result
+}
+
+// Reload send the new configuration to the pipes that support it. Only the pipe configuration can be
+// changed, other changes, like the version, require a new build. The configuration of all the pipes
+// is decoded and validated, like at the initialization, before any pipe is reloaded, if one of them
+// is invalid, nothing change. The new configuration is kept even if some pipes fail to reload, this
+// way it match what the other pipes received, the error, a *MultiError, report the pipes that failed.
+func (m *Manager) Reload(pipes []internal.Pipe) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	type reload struct {
+		importPathAlias string
+		method          reflect.Value
+		cfg             reflect.Value
+	}
+	var reloads []reload
+	for _, importPathAlias := range m.order() {
+		instance := m.instances[importPathAlias]
+		method, ok := reloadMethod(instance.instancer)
+		if !ok {
+			continue
+		}
+
+		cfg, err := m.reloadConfig(importPathAlias, method.Type().In(0), pipeConfig(pipes, instance))
+		if err != nil {
+			return errors.Wrapf(err, "pipe '%s' configuration error", importPathAlias)
+		}
+		reloads = append(reloads, reload{importPathAlias, method, cfg})
+	}
+
+	m.settings.Pipe = pipes
+	var errs []*Error
+	for _, r := range reloads {
+		if err, _ := r.method.Call([]reflect.Value{r.cfg})[0].Interface().(error); err != nil { // nolint: errcheck
+			errs = append(errs, &Error{Pipe: r.importPathAlias, Err: err})
+			continue
+		}
+		m.settings.Logger.Info("pipe reloaded", "pipe", r.importPathAlias)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Pipe < errs[j].Pipe })
+	return &MultiError{Errors: errs}
+}
+
+// reloadConfig decode the configuration into the type the pipe constructor received, this way the
+// configuration is checked like at the initialization. The decoded value is returned if the 'Reload'
+// method ask for it, otherwise, the map is returned.
+func (m Manager) reloadConfig(
+	importPathAlias string, param reflect.Type, cfg map[string]interface{},
+) (reflect.Value, error) {
+	cfgType := m.configTypes[importPathAlias]
+	if (cfgType == nil) && configStruct(param) {
+		cfgType = param
+	}
+
+	if cfgType != nil {
+		value, err := decodeConfig(cfg, cfgType)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if value.Type().AssignableTo(param) {
+			return value, nil
+		}
+	}
+
+	value := reflect.ValueOf(cfg)
+	if !value.Type().AssignableTo(param) {
+		return reflect.Value{}, fmt.Errorf(
+			"reload configuration parameter should be '%s' or the constructor configuration type", value.Type(),
+		)
+	}
+	return value, nil
+}
+
+// startOrder return the pipes import path alias with the dependencies of each pipe before it, the
+// pipes without dependencies between them keep the declaration order.
+func (m Manager) startOrder() []string {
+	var (
+		aliases = make([]string, 0, len(m.instances))
+		visited = make(map[string]bool, len(m.instances))
+		visit   func(string)
+	)
+	visit = func(importPathAlias string) {
+		instance, ok := m.instances[importPathAlias]
+		if !ok || visited[importPathAlias] {
+			return
+		}
+		visited[importPathAlias] = true
+
+		for _, dependency := range m.lifecycle(instance).DependsOn {
+			visit(dependency)
+		}
+		aliases = append(aliases, importPathAlias)
+	}
+
+	for _, importPathAlias := range m.order() {
+		visit(importPathAlias)
+	}
+	return aliases
+}
+
+// order return the pipes import path alias in the order they are declared at the configuration.
+func (m Manager) order() []string {
+	aliases := make([]string, 0, len(m.instances))
+	for importPathAlias := range m.instances {
+		aliases = append(aliases, importPathAlias)
+	}
+
+	sort.SliceStable(aliases, func(i, j int) bool {
+		x, y := m.index(m.instances[aliases[i]]), m.index(m.instances[aliases[j]])
+		if x != y {
+			return (x >= 0) && ((y < 0) || (x < y))
+		}
+		return aliases[i] < aliases[j]
+	})
+	return aliases
+}
+
+// index return the position of the instance pipe at the configuration, or -1 if it's not found.
+func (m Manager) index(instance instance) int {
+	return pipeIndex(m.settings.Pipe, instance)
+}
+
+func pipeIndex(pipes []internal.Pipe, instance instance) int {
+	for i, pipe := range pipes {
+		if pipe.ImportPath != instance.importPath {
+			continue
+		}
+		if (pipe.Module == "") || (pipe.Module == instance.id) {
+			return i
+		}
+	}
+	return -1
+}
+
+// pipeConfig return the configuration of the instance, it's never nil.
+func pipeConfig(pipes []internal.Pipe, instance instance) map[string]interface{} {
+	var cfg map[string]interface{}
+	if i := pipeIndex(pipes, instance); i >= 0 {
+		cfg = pipes[i].Config
+		if instance.name != "" {
+			cfg = instanceConfig(pipes[i], instance.name)
+		}
+	}
+	if cfg == nil {
+		cfg = make(map[string]interface{})
+	}
+	return cfg
+}
+
+func (m Manager) lifecycle(instance instance) internal.PipeLifecycle {
+	var lifecycle internal.PipeLifecycle
+	if i := m.index(instance); i >= 0 {
+		lifecycle = m.settings.Pipe[i].Lifecycle
+	}
+
+	if lifecycle.StartTimeout == 0 {
+		lifecycle.StartTimeout = lifecycleDefaultStartTimeout
+	}
+	if lifecycle.StartFailure == "" {
+		lifecycle.StartFailure = lifecycleStartFailureAbort
+	}
+	lifecycle.DependsOn = m.resolveDependencies(lifecycle.DependsOn)
+	return lifecycle
+}
+
+// resolveDependencies replace the alias of the pipes declared with named instances by the instances,
+// this way 'auth' is the same as depending on 'auth@internal' and 'auth@public'. The unknown
+// dependencies are kept to be reported by the validation.
+func (m Manager) resolveDependencies(dependencies []string) []string {
+	if len(dependencies) == 0 {
+		return dependencies
+	}
+
+	resolved := make([]string, 0, len(dependencies))
+	for _, dependency := range dependencies {
+		if _, ok := m.instances[dependency]; ok {
+			resolved = append(resolved, dependency)
+			continue
+		}
+
+		var instances []string
+		for importPathAlias := range m.instances {
+			if strings.HasPrefix(importPathAlias, dependency+"@") {
+				instances = append(instances, importPathAlias)
+			}
+		}
+		if len(instances) == 0 {
+			resolved = append(resolved, dependency)
+			continue
+		}
+		sort.Strings(instances)
+		resolved = append(resolved, instances...)
+	}
+	return resolved
+}
+
+func (m Manager) validLifecycle() error {
+	for _, pipe := range m.settings.Pipe {
+		switch pipe.Lifecycle.StartFailure {
+		case "", lifecycleStartFailureAbort, lifecycleStartFailureContinue:
+		default:
+			return fmt.Errorf("invalid start failure policy '%s' at pipe '%s'", pipe.Lifecycle.StartFailure, pipe.ImportPath)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package pipe
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+type lifecycleClient struct {
+	name    string
+	started *[]string
+	closed  *[]string
+	delay   time.Duration
+	err     error
+	cfg     map[string]interface{}
+
+	reloadErr error
+}
+
+func (lc *lifecycleClient) Close(context.Context) error {
+	if lc.closed != nil {
+		*lc.closed = append(*lc.closed, lc.name)
+	}
+	return nil
+}
+
+func (lc *lifecycleClient) Start(ctx context.Context) error {
+	select {
+	case <-time.After(lc.delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	*lc.started = append(*lc.started, lc.name)
+	return lc.err
+}
+
+func (lc *lifecycleClient) Health(context.Context) error { return lc.err }
+
+func (lc *lifecycleClient) Reload(cfg map[string]interface{}) error {
+	if lc.reloadErr != nil {
+		return lc.reloadErr
+	}
+	lc.cfg = cfg
+	return nil
+}
+
+func TestManagerStart(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name            string
+		lifecycle       internal.PipeLifecycle
+		delay           time.Duration
+		err             error
+		expectedStarted []string
+		expectedClosed  []string
+		shouldFail      bool
+	}{
+		{
+			name:            "declaration order",
+			expectedStarted: []string{"second", "first"},
+		},
+		{
+			name:            "dependency order",
+			lifecycle:       internal.PipeLifecycle{DependsOn: []string{"first"}},
+			expectedStarted: []string{"first", "second"},
+		},
+		{
+			name:            "abort",
+			err:             errors.New("failed"),
+			expectedStarted: []string{"second"},
+			expectedClosed:  []string{"first", "second"},
+			shouldFail:      true,
+		},
+		{
+			name:            "abort after a dependency started",
+			lifecycle:       internal.PipeLifecycle{DependsOn: []string{"first"}},
+			err:             errors.New("failed"),
+			expectedStarted: []string{"first", "second"},
+			expectedClosed:  []string{"second", "first"},
+			shouldFail:      true,
+		},
+		{
+			name:            "continue",
+			lifecycle:       internal.PipeLifecycle{StartFailure: lifecycleStartFailureContinue},
+			err:             errors.New("failed"),
+			expectedStarted: []string{"second", "first"},
+		},
+		{
+			name:           "timeout",
+			lifecycle:      internal.PipeLifecycle{StartTimeout: time.Millisecond},
+			delay:          time.Second,
+			expectedClosed: []string{"first", "second"},
+			shouldFail:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var started, closed []string
+			m := Manager{
+				settings: ManagerConfig{
+					Pipe: []internal.Pipe{
+						{ImportPath: "github.com/pipehub/second", Lifecycle: tt.lifecycle},
+						{ImportPath: "github.com/pipehub/first"},
+					},
+				},
+				instances: map[string]instance{
+					"first": {
+						id:         "github.com/pipehub/first",
+						importPath: "github.com/pipehub/first",
+						instancer:  &lifecycleClient{name: "first", started: &started, closed: &closed},
+					},
+					"second": {
+						id:         "github.com/pipehub/second",
+						importPath: "github.com/pipehub/second",
+						instancer: &lifecycleClient{
+							name: "second", started: &started, closed: &closed, delay: tt.delay, err: tt.err,
+						},
+					},
+				},
+				mutex: &sync.RWMutex{},
+			}
+
+			err := m.Start(context.Background())
+			require.Equal(t, tt.shouldFail, err != nil)
+			require.Equal(t, tt.expectedStarted, started)
+			require.Equal(t, tt.expectedClosed, closed)
+
+			health := m.Health(context.Background())
+			require.Len(t, health, 2)
+			require.Equal(t, tt.err, health["second"])
+
+			cfg := map[string]interface{}{"host": "example.com"}
+			require.NoError(t, m.Reload([]internal.Pipe{{ImportPath: "github.com/pipehub/first", Config: cfg}}))
+			require.Equal(t, cfg, m.instances["first"].instancer.(*lifecycleClient).cfg)
+			require.Equal(t, map[string]interface{}{}, m.instances["second"].instancer.(*lifecycleClient).cfg)
+		})
+	}
+}
+
+func TestManagerReload(t *testing.T) {
+	t.Parallel()
+
+	client := func(name string, err error) instance {
+		return instance{
+			id:         "github.com/pipehub/" + name,
+			importPath: "github.com/pipehub/" + name,
+			instancer:  &lifecycleClient{name: name, reloadErr: err},
+		}
+	}
+	m := Manager{
+		instances: map[string]instance{
+			"first":  client("first", nil),
+			"second": client("second", errors.New("failed")),
+		},
+		mutex: &sync.RWMutex{},
+	}
+
+	pipes := []internal.Pipe{
+		{ImportPath: "github.com/pipehub/first", Config: map[string]interface{}{"host": "example.com"}},
+		{ImportPath: "github.com/pipehub/second", Config: map[string]interface{}{"host": "example.org"}},
+	}
+	err := m.Reload(pipes)
+
+	var multiErr *MultiError
+	require.True(t, errors.As(err, &multiErr))
+	require.Len(t, multiErr.Errors, 1)
+	require.Equal(t, "second", multiErr.Errors[0].Pipe)
+
+	// The pipes that reloaded and the settings should agree on the configuration.
+	require.Equal(t, pipes, m.settings.Pipe)
+	require.Equal(t, pipes[0].Config, m.instances["first"].instancer.(*lifecycleClient).cfg)
+}
+
+type reloadClient struct {
+	cfg configTest
+}
+
+func (rc *reloadClient) Close(context.Context) error { return nil }
+
+func (rc *reloadClient) Reload(cfg configTest) error {
+	rc.cfg = cfg
+	return nil
+}
+
+func TestManagerReloadConfig(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		cfg        map[string]interface{}
+		expected   configTest
+		shouldFail bool
+	}{
+		{
+			name:     "valid",
+			cfg:      map[string]interface{}{"host": "example.com", "timeout": "1s"},
+			expected: configTest{Host: "example.com", Timeout: time.Second, Retries: 3},
+		},
+		{
+			name:       "unknown key",
+			cfg:        map[string]interface{}{"host": "example.com", "unknown": true},
+			shouldFail: true,
+		},
+		{
+			name:       "validation",
+			cfg:        map[string]interface{}{"timeout": "1s"},
+			shouldFail: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			typed, raw := &reloadClient{}, &lifecycleClient{}
+			m := Manager{
+				instances: map[string]instance{
+					"raw":   {id: "github.com/pipehub/raw", importPath: "github.com/pipehub/raw", instancer: raw},
+					"typed": {id: "github.com/pipehub/typed", importPath: "github.com/pipehub/typed", instancer: typed},
+				},
+				configTypes: map[string]reflect.Type{
+					"raw":   reflect.TypeOf(configTest{}),
+					"typed": reflect.TypeOf(configTest{}),
+				},
+				mutex: &sync.RWMutex{},
+			}
+
+			pipes := []internal.Pipe{
+				{ImportPath: "github.com/pipehub/raw", Config: map[string]interface{}{"host": "example.com"}},
+				{ImportPath: "github.com/pipehub/typed", Config: tt.cfg},
+			}
+			err := m.Reload(pipes)
+			if tt.shouldFail {
+				require.Error(t, err)
+				require.Nil(t, m.settings.Pipe)
+				require.Nil(t, raw.cfg, "no pipe should be reloaded when a configuration is invalid")
+				return
+			}
+
+			require.NoError(t, err)
+			tt.expected.Server.Port = 8080
+			require.Equal(t, tt.expected, typed.cfg)
+			require.Equal(t, pipes[0].Config, raw.cfg)
+		})
+	}
+}
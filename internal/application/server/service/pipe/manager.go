@@ -1,41 +1,40 @@
 package pipe
 
 import (
-	"context"
 	"fmt"
 	"reflect"
-	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 
 	"github.com/pipehub/pipehub/internal"
+	"github.com/pipehub/pipehub/internal/application/server/service/store"
+	"github.com/pipehub/pipehub/internal/infra/log"
 )
 
+// ManagerConfig has the configuration needed to initialize the pipes.
+type ManagerConfig struct {
+	Pipe   []internal.Pipe
+	Logger *log.Logger
+
+	// Store is shared by the pipes, each pipe receive a namespace named by the import path alias.
+	Store store.Store
+}
+
 // Manager is the responsible to initialize the pipes.
 type Manager struct {
-	pipes     []internal.Pipe
+	// It can't be named config because of the method used by the generated code to fetch the pipe
+	// configuration.
+	settings  ManagerConfig
 	instances map[string]instance
-}
 
-// Close the initialized pipes.
-func (m *Manager) Close(ctx context.Context) error {
-	var errs []string
-	for _, instance := range m.instances {
-		if err := instance.Close(ctx); err != nil {
-			errs = append(errs, err.Error())
-		}
-	}
+	// configTypes are the configuration types of the constructors that receive a struct, by import
+	// path alias, they're used to decode the configuration at the reload.
+	configTypes map[string]reflect.Type
 
-	switch len(errs) {
-	case 0:
-		return nil
-	case 1:
-		err := errors.New(errs[0])
-		return errors.Wrap(err, "close error")
-	default:
-		value := strings.Join(errs, "|")
-		return fmt.Errorf("multiple errors detected during close: (%s)", value)
-	}
+	// mutex protect the pipes configuration, it's replaced at the reload while the lifecycle methods
+	// may be reading it.
+	mutex *sync.RWMutex
 }
 
 // Fetch the instance of a pipe.
@@ -56,6 +55,7 @@ func (m *Manager) init() error {
 
 	value := add.Call(nil)[0]
 	if value.IsNil() {
+		m.settings.Logger.Debug("pipes initialized", "count", len(m.instances))
 		return nil
 	}
 	err := value.Interface().(error)
@@ -64,7 +64,7 @@ func (m *Manager) init() error {
 
 // nolint: unused
 func (m Manager) config(importPath, id string) map[string]interface{} {
-	for _, pipe := range m.pipes {
+	for _, pipe := range m.settings.Pipe {
 		if (pipe.Module != "") && (pipe.ImportPath == importPath) && (pipe.Module == id) {
 			return pipe.Config
 		}
@@ -77,16 +77,142 @@ func (m Manager) config(importPath, id string) map[string]interface{} {
 	return nil
 }
 
+// nolint: unused
+func (m Manager) instanceConfig(importPath, id, name string) map[string]interface{} {
+	for _, pipe := range m.settings.Pipe {
+		if (pipe.Module != "") && (pipe.ImportPath == importPath) && (pipe.Module == id) {
+			return instanceConfig(pipe, name)
+		}
+
+		if (pipe.ImportPath == importPath) && (pipe.Version == id) {
+			return instanceConfig(pipe, name)
+		}
+	}
+
+	return nil
+}
+
+// instanceConfig return the configuration of the named instance of a pipe.
+func instanceConfig(pipe internal.Pipe, name string) map[string]interface{} {
+	for _, instance := range pipe.Instances {
+		if instance.Name == name {
+			return instance.Config
+		}
+	}
+	return nil
+}
+
+// newClient call the pipe constructor with the pipe configuration. The configuration is received as
+// a map or, if the constructor ask for a struct, it's decoded as described at decodeConfig. Other than
+// the configuration, the constructor may ask for the dependencies PipeHub provide by declaring extra
+// parameters with a interface type the dependency satisfy. As pipes can't import PipeHub packages,
+// the interfaces are declared at the pipe using only builtin types, for example:
+//
+//	type Logger interface {
+//		Info(msg string, keyvals ...interface{})
+//		Error(msg string, keyvals ...interface{})
+//	}
+//
+//	func NewClient(cfg map[string]interface{}, logger Logger) (Client, error)
+//
+// The dependencies are the logger and the pipe namespace at the store, see store.Namespace.
+func (m *Manager) newClient(
+	constructor interface{}, cfg map[string]interface{}, importPathAlias string,
+) (instancer, error) {
+	fn := reflect.ValueOf(constructor)
+	fnType := fn.Type()
+	if fnType.Kind() != reflect.Func {
+		return nil, errors.New("constructor is not a function")
+	}
+
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+	if (fnType.NumOut() != 2) || !fnType.Out(1).Implements(errorType) {
+		return nil, errors.New("constructor should return a client and a error")
+	}
+
+	if fnType.NumIn() == 0 {
+		return nil, errors.New("constructor should receive the configuration as the first parameter")
+	}
+
+	if cfg == nil {
+		cfg = make(map[string]interface{})
+	}
+	cfgValue := reflect.ValueOf(cfg)
+	if cfgType := fnType.In(0); configStruct(cfgType) {
+		var err error
+		cfgValue, err = decodeConfig(cfg, cfgType)
+		if err != nil {
+			return nil, errors.Wrapf(err, "pipe '%s' configuration error", importPathAlias)
+		}
+		if m.configTypes == nil {
+			m.configTypes = make(map[string]reflect.Type)
+		}
+		m.configTypes[importPathAlias] = cfgType
+	} else if !cfgValue.Type().AssignableTo(cfgType) {
+		return nil, fmt.Errorf(
+			"constructor configuration parameter should be '%s', a struct or a pointer to a struct", cfgValue.Type(),
+		)
+	}
+
+	args := []reflect.Value{cfgValue}
+	dependencies := []interface{}{m.settings.Logger.With("pipe", importPathAlias)}
+	if m.settings.Store != nil {
+		dependencies = append(dependencies, store.NewNamespace(m.settings.Store, importPathAlias))
+	}
+	for i := 1; i < fnType.NumIn(); i++ {
+		arg, err := m.newClientDependency(fnType.In(i), dependencies)
+		if err != nil {
+			return nil, errors.Wrapf(err, "constructor parameter '%d' error", i)
+		}
+		args = append(args, arg)
+	}
+
+	results := fn.Call(args)
+	if err, _ := results[1].Interface().(error); err != nil { // nolint: errcheck
+		return nil, err
+	}
+
+	client, ok := results[0].Interface().(instancer)
+	if !ok {
+		return nil, errors.New("client don't have the method 'Close(context.Context) error'")
+	}
+	return client, nil
+}
+
+func (Manager) newClientDependency(param reflect.Type, dependencies []interface{}) (reflect.Value, error) {
+	if param.Kind() != reflect.Interface {
+		return reflect.Value{}, fmt.Errorf("type '%s' is not a interface", param)
+	}
+
+	for _, dependency := range dependencies {
+		if reflect.TypeOf(dependency).Implements(param) {
+			return reflect.ValueOf(dependency), nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("no dependency satisfy the interface '%s'", param)
+}
+
 // NewManager start the pipes.
-func NewManager(pipes []internal.Pipe) (Manager, error) {
+// nolint: gocritic
+func NewManager(config ManagerConfig) (Manager, error) {
 	m := Manager{
-		pipes:     pipes,
-		instances: make(map[string]instance),
+		settings:    config,
+		instances:   make(map[string]instance),
+		configTypes: make(map[string]reflect.Type),
+		mutex:       &sync.RWMutex{},
+	}
+
+	if err := m.validLifecycle(); err != nil {
+		return m, errors.Wrap(err, "lifecycle validation error")
 	}
 
 	if err := m.init(); err != nil {
 		return m, errors.Wrap(err, "initialization error")
 	}
 
+	if err := m.validDependencies(); err != nil {
+		return m, errors.Wrap(err, "dependencies validation error")
+	}
+
 	return m, nil
 }
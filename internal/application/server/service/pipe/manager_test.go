@@ -0,0 +1,37 @@
+package pipe
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipehub/pipehub/internal/application/server/service/store"
+)
+
+type managerStore interface {
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+func TestManagerNewClientStore(t *testing.T) {
+	t.Parallel()
+
+	s := store.NewMemory(time.Minute)
+	defer s.Close() // nolint: errcheck
+
+	m := Manager{settings: ManagerConfig{Store: s}}
+	constructor := func(_ map[string]interface{}, s managerStore) (httpClient, error) {
+		return httpClient{}, s.Set(context.Background(), "started", []byte("true"), 0)
+	}
+	_, err := m.newClient(constructor, nil, "auth@internal")
+	require.NoError(t, err)
+
+	value, ok, err := s.Get("auth@internal", "started")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, []byte("true"), value)
+
+	_, err = (&Manager{}).newClient(constructor, nil, "base")
+	require.Error(t, err, "the store should not be injected when it's not configured")
+}
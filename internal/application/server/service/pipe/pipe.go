@@ -12,6 +12,9 @@ type instance struct {
 	id string
 
 	importPath string
+
+	// name is set when the pipe is declared with named instances.
+	name string
 	instancer
 }
 
@@ -21,6 +24,7 @@ type instancer interface {
 
 // extractPipeHandler return the pipe import path alias and the function.
 // Example: base.handler, will return 'base' as the import path alias and 'handler' as the function.
+// Named instances are part of the alias, 'auth@internal.Check' return 'auth@internal' and 'Check'.
 func extractPipeHandler(id string) (importPathAlias, handler string, err error) {
 	fragments := strings.Split(id, ".")
 	if len(fragments) != 2 {
@@ -0,0 +1,294 @@
+package pipe
+
+import (
+	"bufio"
+	"context"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/pipehub/pipehub/internal/infra/log"
+)
+
+// nolint: gochecknoglobals
+var httpTimeouts = expvar.NewMap("pipe_timeouts")
+
+// HTTPConfigTimeout limit the time a pipe function has to handle the request. The time of a
+// middleware stop to count when the request is passed to the next handler, this way a slow upstream
+// is not attributed to the pipe.
+type HTTPConfigTimeout struct {
+	Duration time.Duration
+
+	// Fallback is a handler called when the time is exceeded, if empty, a 504 is returned.
+	Fallback string
+}
+
+// httpTimeoutContextKey is unique by wrapped function, this way the nested pipes don't share the
+// execution.
+type httpTimeoutContextKey struct {
+	id string
+}
+
+// httpTimeoutExecution holds the state of a request inside a pipe with timeout. The request is either
+// passed to the next handler or timed out, never both.
+type httpTimeoutExecution struct {
+	mutex       sync.Mutex
+	deadline    time.Time
+	passed      bool
+	timedOut    bool
+	wroteHeader bool
+}
+
+// pass mark the request as passed to the next handler, it return false if the pipe already timed out.
+func (e *httpTimeoutExecution) pass() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.timedOut {
+		return false
+	}
+	e.passed = true
+	return true
+}
+
+// expire mark the request as timed out, it return false if the request was already passed to the
+// next handler.
+func (e *httpTimeoutExecution) expire() (expired, wroteHeader bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.passed {
+		return false, e.wroteHeader
+	}
+	e.timedOut = true
+	return true, e.wroteHeader
+}
+
+// httpTimeoutContext report the pipe deadline until the request is passed to the next handler, after
+// that, the next handlers are not limited by the pipe deadline.
+type httpTimeoutContext struct {
+	context.Context
+	execution *httpTimeoutExecution
+}
+
+func (c *httpTimeoutContext) Deadline() (time.Time, bool) {
+	c.execution.mutex.Lock()
+	passed := c.execution.passed
+	c.execution.mutex.Unlock()
+
+	parent, ok := c.Context.Deadline()
+	if passed || (ok && parent.Before(c.execution.deadline)) {
+		return parent, ok
+	}
+	return c.execution.deadline, true
+}
+
+func (c *httpTimeoutContext) Err() error {
+	c.execution.mutex.Lock()
+	timedOut := c.execution.timedOut
+	c.execution.mutex.Unlock()
+
+	if timedOut {
+		return context.DeadlineExceeded
+	}
+	return c.Context.Err()
+}
+
+// httpTimeoutWriter don't allow writes after the timeout. Until the response is started the headers
+// are kept apart, this way the timeout response don't race with the pipe.
+type httpTimeoutWriter struct {
+	http.ResponseWriter
+	execution *httpTimeoutExecution
+	header    http.Header
+}
+
+func (tw *httpTimeoutWriter) Header() http.Header {
+	tw.execution.mutex.Lock()
+	defer tw.execution.mutex.Unlock()
+	if tw.execution.wroteHeader {
+		return tw.ResponseWriter.Header()
+	}
+	return tw.header
+}
+
+func (tw *httpTimeoutWriter) WriteHeader(status int) {
+	tw.execution.mutex.Lock()
+	defer tw.execution.mutex.Unlock()
+	if tw.execution.timedOut {
+		return
+	}
+	tw.start()
+	tw.ResponseWriter.WriteHeader(status)
+}
+
+func (tw *httpTimeoutWriter) Write(p []byte) (int, error) {
+	tw.execution.mutex.Lock()
+	defer tw.execution.mutex.Unlock()
+	if tw.execution.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.start()
+	return tw.ResponseWriter.Write(p)
+}
+
+func (tw *httpTimeoutWriter) Flush() {
+	tw.execution.mutex.Lock()
+	defer tw.execution.mutex.Unlock()
+	if tw.execution.timedOut {
+		return
+	}
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		tw.start()
+		f.Flush()
+	}
+}
+
+func (tw *httpTimeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	tw.execution.mutex.Lock()
+	defer tw.execution.mutex.Unlock()
+	if tw.execution.timedOut {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	h, ok := tw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the response writer does not support hijack")
+	}
+	tw.start()
+	return h.Hijack()
+}
+
+// start copy the headers to the response, it should be called with the mutex locked.
+func (tw *httpTimeoutWriter) start() {
+	if tw.execution.wroteHeader {
+		return
+	}
+	tw.execution.wroteHeader = true
+
+	header := tw.ResponseWriter.Header()
+	for key, values := range tw.header {
+		header[key] = values
+	}
+}
+
+// PanicError is a panic recovered at a pipe that runs at another goroutine. It's propagated to the
+// request goroutine with the stack of the goroutine that panicked, otherwise the stack would point to
+// the propagation and not to the pipe.
+type PanicError struct {
+	value interface{}
+	stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprint(e.value)
+}
+
+// Value return the value given to panic.
+func (e *PanicError) Value() interface{} {
+	return e.value
+}
+
+// Stack return the stack of the goroutine that panicked.
+func (e *PanicError) Stack() []byte {
+	return e.stack
+}
+
+type httpTimeout struct {
+	id       string
+	duration time.Duration
+	fallback func(http.ResponseWriter, *http.Request)
+	logger   *log.Logger
+}
+
+func (t httpTimeout) middleware(fn func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	key := &httpTimeoutContextKey{id: t.id}
+	return func(next http.Handler) http.Handler {
+		handler := fn(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if execution, ok := r.Context().Value(key).(*httpTimeoutExecution); ok && !execution.pass() {
+				return
+			}
+			next.ServeHTTP(w, r)
+		}))
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.serve(key, handler.ServeHTTP, w, r)
+		})
+	}
+}
+
+func (t httpTimeout) handler(fn func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	key := &httpTimeoutContextKey{id: t.id}
+	return func(w http.ResponseWriter, r *http.Request) {
+		t.serve(key, fn, w, r)
+	}
+}
+
+// serve run the pipe at another goroutine, this way the request can be answered even if the pipe
+// don't respect the context. A panic at the pipe is propagated to the request goroutine as a
+// *PanicError, the abort panic is propagated as is, as it's not a failure.
+func (t httpTimeout) serve(
+	key *httpTimeoutContextKey, fn http.HandlerFunc, w http.ResponseWriter, r *http.Request,
+) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	execution := &httpTimeoutExecution{deadline: time.Now().Add(t.duration)}
+	ctx = context.WithValue(&httpTimeoutContext{Context: ctx, execution: execution}, key, execution)
+	tw := &httpTimeoutWriter{ResponseWriter: w, execution: execution, header: make(http.Header)}
+
+	done := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			v := recover()
+			if (v != nil) && (v != http.ErrAbortHandler) { // nolint: goerr113
+				v = &PanicError{value: v, stack: debug.Stack()}
+			}
+			done <- v
+		}()
+		fn(tw, r.WithContext(ctx))
+	}()
+
+	timer := time.NewTimer(t.duration)
+	defer timer.Stop()
+
+	select {
+	case v := <-done:
+		if v != nil {
+			panic(v)
+		}
+		return
+	case <-timer.C:
+	}
+
+	expired, wroteHeader := execution.expire()
+	if !expired {
+		// The request is already at the next handler, the timeout don't apply anymore.
+		if v := <-done; v != nil {
+			panic(v)
+		}
+		return
+	}
+	cancel()
+
+	httpTimeouts.Add(t.id, 1)
+	t.logger.Error(
+		"pipe timeout",
+		"handler", t.id,
+		"timeout", t.duration,
+		"host", r.Host,
+		"path", r.URL.Path,
+		"request_id", requestID(r),
+	)
+	if wroteHeader {
+		// The response was already started by the pipe, there is no way to answer the timeout.
+		return
+	}
+	if t.fallback != nil {
+		t.fallback(w, r)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusGatewayTimeout), http.StatusGatewayTimeout)
+}
@@ -0,0 +1,166 @@
+package pipe
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type timeoutClient struct{}
+
+func (timeoutClient) Close(context.Context) error { return nil }
+
+// Slow only pass the request after the context is done.
+func (timeoutClient) Slow(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Fast pass the request right away.
+func (timeoutClient) Fast(next http.Handler) http.Handler {
+	return next
+}
+
+// Panic fail before pass the request.
+func (timeoutClient) Panic(http.Handler) http.Handler {
+	return http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("faulty")
+	})
+}
+
+func (timeoutClient) Fallback(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusServiceUnavailable)
+}
+
+func TestHTTPTimeout(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		id      string
+		timeout HTTPConfigTimeout
+		next    time.Duration
+		status  int
+	}{
+		{
+			name:    "timeout",
+			id:      "base.Slow",
+			timeout: HTTPConfigTimeout{Duration: 10 * time.Millisecond},
+			status:  http.StatusGatewayTimeout,
+		},
+		{
+			name:    "fallback",
+			id:      "base.Slow",
+			timeout: HTTPConfigTimeout{Duration: 10 * time.Millisecond, Fallback: "base.Fallback"},
+			status:  http.StatusServiceUnavailable,
+		},
+		{
+			name:    "slow next handler",
+			id:      "base.Fast",
+			timeout: HTTPConfigTimeout{Duration: 10 * time.Millisecond},
+			next:    50 * time.Millisecond,
+			status:  http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			h, err := NewHTTP(HTTPConfig{
+				Entry:    []HTTPConfigEntry{{Endpoint: "a", Handler: tt.id}},
+				Instance: httpFetcher{"base": {instancer: timeoutClient{}}},
+				Timeout:  map[string]HTTPConfigTimeout{tt.id: tt.timeout},
+			})
+			require.NoError(t, err)
+
+			middleware, err := h.Middleware(tt.id)
+			require.NoError(t, err)
+
+			var deadline bool
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, deadline = r.Context().Deadline()
+				time.Sleep(tt.next)
+				w.WriteHeader(http.StatusNoContent)
+			})
+
+			w := httptest.NewRecorder()
+			middleware(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			require.Equal(t, tt.status, w.Code)
+			require.False(t, deadline, "the pipe deadline should not be visible at the next handler")
+		})
+	}
+}
+
+func TestHTTPTimeoutInvalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		id      string
+		timeout HTTPConfigTimeout
+	}{
+		{"missing duration", "base.Slow", HTTPConfigTimeout{}},
+		{"unknown fallback", "base.Slow", HTTPConfigTimeout{Duration: time.Second, Fallback: "base.Unknown"}},
+		{"middleware as fallback", "base.Slow", HTTPConfigTimeout{Duration: time.Second, Fallback: "base.Fast"}},
+		{"unknown handler", "base.Slwo", HTTPConfigTimeout{Duration: time.Second}},
+		{"unknown pipe", "other.Slow", HTTPConfigTimeout{Duration: time.Second}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewHTTP(HTTPConfig{
+				Entry:    []HTTPConfigEntry{{Endpoint: "a", Handler: "base.Slow"}},
+				Instance: httpFetcher{"base": {instancer: timeoutClient{}}},
+				Timeout:  map[string]HTTPConfigTimeout{tt.id: tt.timeout},
+			})
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestHTTPTimeoutUnusedHandler(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewHTTP(HTTPConfig{
+		Entry:    []HTTPConfigEntry{{Endpoint: "a", Handler: "base.Slow"}},
+		Instance: httpFetcher{"base": {instancer: timeoutClient{}}},
+		Timeout:  map[string]HTTPConfigTimeout{"base.Fast": {Duration: time.Second}},
+	})
+	require.NoError(t, err)
+}
+
+func TestHTTPTimeoutPanic(t *testing.T) {
+	t.Parallel()
+
+	h, err := NewHTTP(HTTPConfig{
+		Entry:    []HTTPConfigEntry{{Endpoint: "a", Handler: "base.Panic"}},
+		Instance: httpFetcher{"base": {instancer: timeoutClient{}}},
+		Timeout:  map[string]HTTPConfigTimeout{"base.Panic": {Duration: time.Second}},
+	})
+	require.NoError(t, err)
+
+	middleware, err := h.Middleware("base.Panic")
+	require.NoError(t, err)
+
+	var value interface{}
+	func() {
+		defer func() { value = recover() }()
+		middleware(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+
+	panicErr, ok := value.(*PanicError)
+	require.True(t, ok)
+	require.Equal(t, "faulty", panicErr.Value())
+	require.Contains(t, string(panicErr.Stack()), "timeoutClient.Panic", "stack should point to the pipe")
+}
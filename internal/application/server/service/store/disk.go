@@ -0,0 +1,279 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/pipehub/pipehub/internal/infra/log"
+)
+
+// diskCompactMinRecords is the minimum amount of records at the file before a compaction is
+// considered, this avoid rewriting small files.
+const diskCompactMinRecords = 1024
+
+// diskRecord is a line at the store file. The value is encoded as base64 by the JSON encoder.
+type diskRecord struct {
+	Namespace string `json:"n"`
+	Key       string `json:"k"`
+	Value     []byte `json:"v,omitempty"`
+	Expires   int64  `json:"e,omitempty"`
+	Delete    bool   `json:"d,omitempty"`
+}
+
+// Disk keep the entries at a append only file and a copy of them in memory, the reads never touch
+// the disk. The file is loaded at the initialization and compacted, removing the overwritten,
+// deleted and expired entries, at the initialization and when most of the records are not used.
+type Disk struct {
+	mutex   sync.Mutex
+	memory  *Memory
+	path    string
+	sync    bool
+	file    *os.File
+	records int
+	logger  *log.Logger
+	closed  bool
+}
+
+// Get return the value of a key.
+func (d *Disk) Get(namespace, key string) ([]byte, bool, error) {
+	return d.memory.Get(namespace, key)
+}
+
+// Set the value of a key.
+func (d *Disk) Set(namespace, key string, value []byte, ttl time.Duration) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	expires := d.memory.expires(ttl)
+	record := diskRecord{Namespace: namespace, Key: key, Value: value}
+	if !expires.IsZero() {
+		record.Expires = expires.UnixNano()
+	}
+	if err := d.write(record); err != nil {
+		return err
+	}
+
+	d.memory.mutex.Lock()
+	d.memory.set(namespace, key, value, expires)
+	d.memory.mutex.Unlock()
+	d.compactIfNeeded()
+	return nil
+}
+
+// Delete a key.
+func (d *Disk) Delete(namespace, key string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.write(diskRecord{Namespace: namespace, Key: key, Delete: true}); err != nil {
+		return err
+	}
+
+	d.memory.mutex.Lock()
+	d.memory.delete(namespace, key)
+	d.memory.mutex.Unlock()
+	d.compactIfNeeded()
+	return nil
+}
+
+// Keys return the keys of a namespace, sorted.
+func (d *Disk) Keys(namespace string) ([]string, error) {
+	return d.memory.Keys(namespace)
+}
+
+// Namespaces return the namespaces with at least one key, sorted.
+func (d *Disk) Namespaces() ([]string, error) {
+	return d.memory.Namespaces()
+}
+
+// Close stop the cleanup and close the file, it can be called more than once.
+func (d *Disk) Close() error {
+	if err := d.memory.Close(); err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.closed {
+		return nil
+	}
+	d.closed = true
+	if err := d.file.Sync(); err != nil {
+		return errors.Wrap(err, "file sync error")
+	}
+	return errors.Wrap(d.file.Close(), "file close error")
+}
+
+// write should be called with the mutex locked.
+func (d *Disk) write(record diskRecord) error {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "record encode error")
+	}
+
+	if _, err := d.file.Write(append(payload, '\n')); err != nil {
+		return errors.Wrap(err, "record write error")
+	}
+	if d.sync {
+		if err := d.file.Sync(); err != nil {
+			return errors.Wrap(err, "file sync error")
+		}
+	}
+	d.records++
+	return nil
+}
+
+// load the records of the file into memory. A incomplete last record is ignored, it happen if the
+// process stop in the middle of a write.
+func (d *Disk) load() error {
+	f, err := os.Open(d.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "file open error")
+	}
+	defer f.Close() // nolint: errcheck
+
+	now := d.memory.now()
+	reader := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		payload, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "file read error")
+		}
+
+		var record diskRecord
+		if err := json.Unmarshal(bytes.TrimSpace(payload), &record); err != nil {
+			return errors.Wrapf(err, "record decode error at line %d", line)
+		}
+
+		if record.Delete {
+			d.memory.delete(record.Namespace, record.Key)
+			continue
+		}
+		var expires time.Time
+		if record.Expires > 0 {
+			expires = time.Unix(0, record.Expires)
+			if !now.Before(expires) {
+				d.memory.delete(record.Namespace, record.Key)
+				continue
+			}
+		}
+		d.memory.set(record.Namespace, record.Key, record.Value, expires)
+	}
+}
+
+// compactIfNeeded compact the file when less then half of the records are used. It should be called
+// with the mutex locked. The write that triggered the compaction already succeeded, so a compaction
+// error is only logged, the file keep growing and the compaction is tried again at the next write.
+func (d *Disk) compactIfNeeded() {
+	if d.records < diskCompactMinRecords {
+		return
+	}
+
+	d.memory.mutex.RLock()
+	var used int
+	for _, entries := range d.memory.entries {
+		used += len(entries)
+	}
+	d.memory.mutex.RUnlock()
+
+	if used*2 > d.records {
+		return
+	}
+	if err := d.compact(); err != nil {
+		d.logger.Error("store compact error", "error", err, "path", d.path)
+	}
+}
+
+// compact write the entries into a new file that replace the current one. It should be called with
+// the mutex locked. The new file is opened in append mode and kept open after the rename, this way
+// there is no reopen that could fail and the current file is used until the new one is in place.
+func (d *Disk) compact() error {
+	tmpPath := d.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Wrap(err, "temporary file open error")
+	}
+
+	records, err := d.dump(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		tmp.Close()        // nolint: errcheck
+		os.Remove(tmpPath) // nolint: errcheck
+		return errors.Wrap(err, "temporary file write error")
+	}
+
+	if err := os.Rename(tmpPath, d.path); err != nil {
+		tmp.Close()        // nolint: errcheck
+		os.Remove(tmpPath) // nolint: errcheck
+		return errors.Wrap(err, "temporary file rename error")
+	}
+
+	if d.file != nil {
+		d.file.Close() // nolint: errcheck
+	}
+	d.file = tmp
+	d.records = records
+	return nil
+}
+
+func (d *Disk) dump(w io.Writer) (int, error) {
+	d.memory.mutex.RLock()
+	defer d.memory.mutex.RUnlock()
+
+	var (
+		records int
+		buf     = bufio.NewWriter(w)
+		encoder = json.NewEncoder(buf)
+		now     = d.memory.now()
+	)
+	for namespace, entries := range d.memory.entries {
+		for key, entry := range entries {
+			if entry.expired(now) {
+				continue
+			}
+
+			record := diskRecord{Namespace: namespace, Key: key, Value: entry.value}
+			if !entry.expires.IsZero() {
+				record.Expires = entry.expires.UnixNano()
+			}
+			if err := encoder.Encode(record); err != nil {
+				return 0, errors.Wrap(err, "record encode error")
+			}
+			records++
+		}
+	}
+	return records, errors.Wrap(buf.Flush(), "flush error")
+}
+
+// NewDisk return a disk store that use the file at the path, the file is created if it don't exist.
+func NewDisk(path string, syncWrites bool, cleanupInterval time.Duration, logger *log.Logger) (*Disk, error) {
+	if path == "" {
+		return nil, errors.New("missing path")
+	}
+
+	d := &Disk{memory: newMemory(), path: path, sync: syncWrites, logger: logger}
+	if err := d.load(); err != nil {
+		return nil, errors.Wrapf(err, "load '%s' error", path)
+	}
+	if err := d.compact(); err != nil {
+		return nil, errors.Wrapf(err, "compact '%s' error", path)
+	}
+
+	d.memory.startCleanup(cleanupInterval)
+	return d, nil
+}
@@ -0,0 +1,169 @@
+package store
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// Memory keep the entries in memory. The expired entries are never returned and they're removed at
+// the cleanup interval.
+type Memory struct {
+	mutex   sync.RWMutex
+	entries map[string]map[string]memoryEntry
+	now     func() time.Time
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// Get return the value of a key.
+func (m *Memory) Get(namespace, key string) ([]byte, bool, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	entry, ok := m.entries[namespace][key]
+	if !ok || entry.expired(m.now()) {
+		return nil, false, nil
+	}
+	return copyBytes(entry.value), true, nil
+}
+
+// Set the value of a key.
+func (m *Memory) Set(namespace, key string, value []byte, ttl time.Duration) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.set(namespace, key, value, m.expires(ttl))
+	return nil
+}
+
+// Delete a key.
+func (m *Memory) Delete(namespace, key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.delete(namespace, key)
+	return nil
+}
+
+// Keys return the keys of a namespace, sorted.
+func (m *Memory) Keys(namespace string) ([]string, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	now := m.now()
+	keys := make([]string, 0, len(m.entries[namespace]))
+	for key, entry := range m.entries[namespace] {
+		if !entry.expired(now) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Namespaces return the namespaces with at least one key, sorted.
+func (m *Memory) Namespaces() ([]string, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	namespaces := make([]string, 0, len(m.entries))
+	for namespace := range m.entries {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// Close stop the cleanup, it can be called more than once.
+func (m *Memory) Close() error {
+	m.closeOnce.Do(func() { close(m.done) })
+	m.wg.Wait()
+	return nil
+}
+
+func (m *Memory) expires(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return m.now().Add(ttl)
+}
+
+// set and delete should be called with the mutex locked.
+func (m *Memory) set(namespace, key string, value []byte, expires time.Time) {
+	entries, ok := m.entries[namespace]
+	if !ok {
+		entries = make(map[string]memoryEntry)
+		m.entries[namespace] = entries
+	}
+	entries[key] = memoryEntry{value: copyBytes(value), expires: expires}
+}
+
+func (m *Memory) delete(namespace, key string) {
+	delete(m.entries[namespace], key)
+	if len(m.entries[namespace]) == 0 {
+		delete(m.entries, namespace)
+	}
+}
+
+func (m *Memory) cleanup() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.now()
+	for namespace, entries := range m.entries {
+		for key, entry := range entries {
+			if entry.expired(now) {
+				m.delete(namespace, key)
+			}
+		}
+	}
+}
+
+func (m *Memory) startCleanup(interval time.Duration) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.cleanup()
+			case <-m.done:
+				return
+			}
+		}
+	}()
+}
+
+func copyBytes(value []byte) []byte {
+	result := make([]byte, len(value))
+	copy(result, value)
+	return result
+}
+
+func newMemory() *Memory {
+	return &Memory{
+		entries: make(map[string]map[string]memoryEntry),
+		now:     time.Now,
+		done:    make(chan struct{}),
+	}
+}
+
+// NewMemory return a memory store that remove the expired entries at each interval.
+func NewMemory(cleanupInterval time.Duration) *Memory {
+	m := newMemory()
+	m.startCleanup(cleanupInterval)
+	return m
+}
@@ -0,0 +1,109 @@
+// Package store provide the key-value store shared by the pipes. Each pipe receive a namespace of
+// the store at the constructor, the namespace is the pipe import path alias, like 'base' or
+// 'auth@internal'.
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pipehub/pipehub/internal/infra/log"
+)
+
+const (
+	// DriverMemory keep the entries in memory, they're lost at the restart.
+	DriverMemory = "memory"
+
+	// DriverDisk keep the entries at a file.
+	DriverDisk = "disk"
+
+	defaultCleanupInterval = time.Minute
+)
+
+// Store is a key-value store with namespaces. A zero TTL means the entry never expire.
+type Store interface {
+	Get(namespace, key string) ([]byte, bool, error)
+	Set(namespace, key string, value []byte, ttl time.Duration) error
+	Delete(namespace, key string) error
+	Keys(namespace string) ([]string, error)
+	Namespaces() ([]string, error)
+	Close() error
+}
+
+// Config has the configuration needed to initialize the store.
+type Config struct {
+	// Driver is 'memory' or 'disk', if empty, the memory driver is used.
+	Driver string
+
+	// Path is the file used by the disk driver.
+	Path string
+
+	// Sync flush each write to the disk before return.
+	Sync bool
+
+	// CleanupInterval is the interval to remove the expired entries, if zero, one minute is used.
+	CleanupInterval time.Duration
+
+	// Logger receive the errors that don't fail the operations, like the disk driver compaction.
+	Logger *log.Logger
+}
+
+// Namespace is the part of the store a pipe has access to. As pipes can't import PipeHub packages,
+// they receive it by declaring a constructor parameter with a interface that has the methods they
+// need, for example:
+//
+//	type Store interface {
+//		Get(ctx context.Context, key string) ([]byte, bool, error)
+//		Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+//	}
+//
+//	func NewClient(cfg map[string]interface{}, store Store) (Client, error)
+type Namespace struct {
+	store Store
+	name  string
+}
+
+// Get return the value of a key, the bool is false if the key don't exist or it's expired.
+func (n *Namespace) Get(_ context.Context, key string) ([]byte, bool, error) {
+	return n.store.Get(n.name, key)
+}
+
+// Set the value of a key. A zero TTL means the entry never expire.
+func (n *Namespace) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	return n.store.Set(n.name, key, value, ttl)
+}
+
+// Delete a key, it's not a error if the key don't exist.
+func (n *Namespace) Delete(_ context.Context, key string) error {
+	return n.store.Delete(n.name, key)
+}
+
+// Keys return the keys that are not expired.
+func (n *Namespace) Keys(_ context.Context) ([]string, error) {
+	return n.store.Keys(n.name)
+}
+
+// NewNamespace return the namespace of a store.
+func NewNamespace(store Store, name string) *Namespace {
+	return &Namespace{store: store, name: name}
+}
+
+// New return a configured store.
+func New(config Config) (Store, error) {
+	if config.CleanupInterval < 0 {
+		return nil, fmt.Errorf("invalid cleanup interval '%s', it can't be negative", config.CleanupInterval)
+	}
+	if config.CleanupInterval == 0 {
+		config.CleanupInterval = defaultCleanupInterval
+	}
+
+	switch config.Driver {
+	case "", DriverMemory:
+		return NewMemory(config.CleanupInterval), nil
+	case DriverDisk:
+		return NewDisk(config.Path, config.Sync, config.CleanupInterval, config.Logger)
+	default:
+		return nil, fmt.Errorf("invalid driver '%s'", config.Driver)
+	}
+}
@@ -0,0 +1,177 @@
+package store
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipehub/pipehub/internal/infra/log"
+)
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{"memory", Config{Driver: DriverMemory}},
+		{"disk", Config{Driver: DriverDisk, Sync: true}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir, err := ioutil.TempDir("", "")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir) // nolint: errcheck
+			if tt.config.Driver == DriverDisk {
+				tt.config.Path = filepath.Join(dir, "store.db")
+			}
+
+			s, err := New(tt.config)
+			require.NoError(t, err)
+			defer s.Close() // nolint: errcheck
+
+			base := NewNamespace(s, "base")
+			auth := NewNamespace(s, "auth@internal")
+			ctx := context.Background()
+
+			require.NoError(t, base.Set(ctx, "counter", []byte("1"), 0))
+			require.NoError(t, auth.Set(ctx, "session", []byte("alice"), time.Hour))
+			require.NoError(t, auth.Set(ctx, "expired", []byte("bob"), time.Nanosecond))
+			time.Sleep(time.Millisecond)
+
+			value, ok, err := base.Get(ctx, "counter")
+			require.NoError(t, err)
+			require.True(t, ok)
+			require.Equal(t, []byte("1"), value)
+
+			_, ok, err = base.Get(ctx, "session")
+			require.NoError(t, err)
+			require.False(t, ok, "namespaces should not share keys")
+
+			_, ok, err = auth.Get(ctx, "expired")
+			require.NoError(t, err)
+			require.False(t, ok)
+
+			keys, err := auth.Keys(ctx)
+			require.NoError(t, err)
+			require.Equal(t, []string{"session"}, keys)
+
+			require.NoError(t, base.Delete(ctx, "counter"))
+			namespaces, err := s.Namespaces()
+			require.NoError(t, err)
+			require.Equal(t, []string{"auth@internal"}, namespaces)
+
+			require.NoError(t, s.Close())
+			require.NoError(t, s.Close(), "the store can be closed more than once")
+		})
+	}
+}
+
+func TestDiskReload(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) // nolint: errcheck
+	path := filepath.Join(dir, "store.db")
+
+	d, err := NewDisk(path, false, time.Minute, nil)
+	require.NoError(t, err)
+	require.NoError(t, d.Set("base", "a", []byte("1"), 0))
+	require.NoError(t, d.Set("base", "a", []byte("2"), 0))
+	require.NoError(t, d.Set("base", "b", []byte("3"), 0))
+	require.NoError(t, d.Delete("base", "b"))
+	require.NoError(t, d.Close())
+
+	// A incomplete record, like the ones left by a crash in the middle of a write, is ignored.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"n":"base","k":"c"`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	d, err = NewDisk(path, false, time.Minute, nil)
+	require.NoError(t, err)
+	defer d.Close() // nolint: errcheck
+	require.Equal(t, 1, d.records, "the file should be compacted")
+
+	value, ok, err := d.Get("base", "a")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, []byte("2"), value)
+
+	keys, err := d.Keys("base")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, keys)
+}
+
+func TestDiskCompactError(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) // nolint: errcheck
+	path := filepath.Join(dir, "store.db")
+
+	logPath := filepath.Join(dir, "pipehub.log")
+	logger, err := log.NewLogger(log.LoggerConfig{Output: logPath})
+	require.NoError(t, err)
+	defer logger.Close() // nolint: errcheck
+
+	d, err := NewDisk(path, false, time.Minute, logger)
+	require.NoError(t, err)
+	defer d.Close() // nolint: errcheck
+
+	// A directory at the temporary file path make the compaction fail.
+	require.NoError(t, os.Mkdir(path+".tmp", 0700))
+	for i := 0; i < diskCompactMinRecords; i++ {
+		require.NoError(t, d.Set("base", "a", []byte("1"), 0))
+	}
+	require.NoError(t, d.Delete("base", "a"))
+	require.Equal(t, diskCompactMinRecords+1, d.records, "the file should not be compacted")
+
+	_, ok, err := d.Get("base", "a")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	payload, err := ioutil.ReadFile(logPath)
+	require.NoError(t, err)
+	require.Contains(t, string(payload), "store compact error")
+}
+
+func TestDiskCompact(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) // nolint: errcheck
+	path := filepath.Join(dir, "store.db")
+
+	d, err := NewDisk(path, false, time.Minute, nil)
+	require.NoError(t, err)
+	for i := 0; i < diskCompactMinRecords; i++ {
+		require.NoError(t, d.Set("base", "a", []byte("1"), 0))
+	}
+	require.Equal(t, 1, d.records, "the file should be compacted")
+
+	// The writes after the compaction go to the new file.
+	require.NoError(t, d.Set("base", "b", []byte("2"), 0))
+	require.NoError(t, d.Close())
+
+	d, err = NewDisk(path, false, time.Minute, nil)
+	require.NoError(t, err)
+	defer d.Close() // nolint: errcheck
+	keys, err := d.Keys("base")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, keys)
+}
@@ -0,0 +1,156 @@
+package http
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+// accessControlRules are the networks allowed and denied.
+type accessControlRules struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+func (rules accessControlRules) allowed(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range rules.deny {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	if len(rules.allow) == 0 {
+		return true
+	}
+	for _, network := range rules.allow {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// accessControl filter the requests by the client IP. The rules from the file are reloaded without
+// restart the server.
+type accessControl struct {
+	config internal.HostAccessControl
+	denied http.Handler
+
+	mutex sync.RWMutex
+	rules accessControlRules
+}
+
+func (ac *accessControl) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ac.mutex.RLock()
+		allowed := ac.rules.allowed(net.ParseIP(clientIP(r)))
+		ac.mutex.RUnlock()
+
+		if !allowed {
+			ac.denied.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// reload parse the lists and the file again. The current rules are kept if there is a error.
+func (ac *accessControl) reload() error {
+	var rules accessControlRules
+	for _, value := range ac.config.Allow {
+		network, err := parseCIDR(value)
+		if err != nil {
+			return errors.Wrap(err, "parse allow list error")
+		}
+		rules.allow = append(rules.allow, network)
+	}
+
+	for _, value := range ac.config.Deny {
+		network, err := parseCIDR(value)
+		if err != nil {
+			return errors.Wrap(err, "parse deny list error")
+		}
+		rules.deny = append(rules.deny, network)
+	}
+
+	if ac.config.File != "" {
+		if err := ac.load(&rules); err != nil {
+			return errors.Wrapf(err, "load file '%s' error", ac.config.File)
+		}
+	}
+
+	ac.mutex.Lock()
+	ac.rules = rules
+	ac.mutex.Unlock()
+	return nil
+}
+
+func (ac *accessControl) load(rules *accessControlRules) error {
+	f, err := os.Open(ac.config.File)
+	if err != nil {
+		return errors.Wrap(err, "open file error")
+	}
+	defer f.Close() // nolint: errcheck
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if (entry == "") || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		fragments := strings.Fields(entry)
+		if len(fragments) != 2 {
+			return fmt.Errorf("invalid rule at line %d", line)
+		}
+
+		network, err := parseCIDR(fragments[1])
+		if err != nil {
+			return errors.Wrapf(err, "parse rule at line %d error", line)
+		}
+
+		switch fragments[0] {
+		case "allow":
+			rules.allow = append(rules.allow, network)
+		case "deny":
+			rules.deny = append(rules.deny, network)
+		default:
+			return fmt.Errorf("invalid action '%s' at line %d", fragments[0], line)
+		}
+	}
+	return errors.Wrap(scanner.Err(), "read file error")
+}
+
+func newAccessControl(config internal.HostAccessControl, fetcher serverHandlerFetcher) (*accessControl, error) {
+	ac := &accessControl{
+		config: config,
+		denied: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		}),
+	}
+
+	if config.Handler != "" {
+		fn, err := fetcher.Handler(config.Handler)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fetch handler '%s' error", config.Handler)
+		}
+		ac.denied = http.HandlerFunc(fn)
+	}
+
+	if err := ac.reload(); err != nil {
+		return nil, err
+	}
+	return ac, nil
+}
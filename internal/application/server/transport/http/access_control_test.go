@@ -0,0 +1,94 @@
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+func TestTrustedProxiesMiddleware(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		xForwardedFor []string
+		expected      string
+	}{
+		{"untrusted remote", "203.0.113.1:1234", []string{"198.51.100.1"}, "203.0.113.1"},
+		{"trusted remote", "10.0.0.1:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"trusted chain", "10.0.0.1:1234", []string{"198.51.100.1, 10.0.0.2", "10.0.0.3"}, "198.51.100.1"},
+		{"forged address", "10.0.0.1:1234", []string{"192.0.2.1, 198.51.100.1"}, "198.51.100.1"},
+		{"invalid address", "10.0.0.1:1234", []string{"invalid, 10.0.0.2"}, "10.0.0.2"},
+		{"without header", "10.0.0.1:1234", nil, "10.0.0.1"},
+	}
+
+	tp, err := newTrustedProxies([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var ip string
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ip = clientIP(r)
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			r.Header["X-Forwarded-For"] = tt.xForwardedFor
+			tp.middleware(handler).ServeHTTP(httptest.NewRecorder(), r)
+			require.Equal(t, tt.expected, ip)
+		})
+	}
+}
+
+func TestAccessControlMiddleware(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "pipehub-access-control-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	file := filepath.Join(dir, "rules")
+	require.NoError(t, ioutil.WriteFile(file, []byte("# rules\ndeny 10.0.0.2\n"), 0600))
+
+	ac, err := newAccessControl(internal.HostAccessControl{
+		Allow: []string{"10.0.0.0/8", "2001:db8::/32"},
+		Deny:  []string{"10.0.0.1"},
+		File:  file,
+	}, nil)
+	require.NoError(t, err)
+
+	status := func(remoteAddr string) int {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		ac.middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(w, r)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusOK, status("10.0.0.3:1234"))
+	require.Equal(t, http.StatusOK, status("[2001:db8::1]:1234"))
+	require.Equal(t, http.StatusForbidden, status("10.0.0.1:1234"))
+	require.Equal(t, http.StatusForbidden, status("10.0.0.2:1234"))
+	require.Equal(t, http.StatusForbidden, status("192.168.0.1:1234"))
+
+	require.NoError(t, ioutil.WriteFile(file, []byte("deny 10.0.0.3\n"), 0600))
+	require.NoError(t, ac.reload())
+	require.Equal(t, http.StatusOK, status("10.0.0.2:1234"))
+	require.Equal(t, http.StatusForbidden, status("10.0.0.3:1234"))
+
+	require.NoError(t, ioutil.WriteFile(file, []byte("invalid\n"), 0600))
+	require.Error(t, ac.reload())
+	require.Equal(t, http.StatusForbidden, status("10.0.0.3:1234"))
+}
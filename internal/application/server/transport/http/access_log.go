@@ -0,0 +1,192 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/pipehub/pipehub/internal/infra/log"
+)
+
+// Formats supported by the access log.
+const (
+	accessLogFormatCommon   = "common"
+	accessLogFormatCombined = "combined"
+	accessLogFormatJSON     = "json"
+	accessLogFormatLogfmt   = "logfmt"
+)
+
+// Optional fields that can be added to the access log.
+const (
+	accessLogFieldHost      = "host"
+	accessLogFieldHandler   = "handler"
+	accessLogFieldUpstream  = "upstream"
+	accessLogFieldLatency   = "latency"
+	accessLogFieldBytes     = "bytes"
+	accessLogFieldRequestID = "request-id"
+)
+
+// ServerConfigAccessLog has the configuration needed to log the requests.
+type ServerConfigAccessLog struct {
+	// Format can be 'common', 'combined', 'json' or 'logfmt'. An empty value disable the access log.
+	Format string
+
+	// Fields are added to the default ones. At the 'common' and 'combined' formats they're appended
+	// to the end of the line as logfmt.
+	Fields []string
+
+	// Output is 'stdout', 'stderr' or a file path.
+	Output string
+}
+
+type accessLogRecordKey struct{}
+
+// accessLogRecord is stored at the request context and filled by the inner handlers with the
+// information the access log middleware can't see from the outside.
+type accessLogRecord struct {
+	handler   string
+	upstream  string
+	requestID string
+}
+
+func accessLogRecordFromContext(ctx context.Context) *accessLogRecord {
+	record, _ := ctx.Value(accessLogRecordKey{}).(*accessLogRecord) // nolint: errcheck
+	return record
+}
+
+type accessLog struct {
+	format string
+	fields []string
+	writer log.Writer
+	logger *log.Logger
+}
+
+func (a *accessLog) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			start  = time.Now()
+			record = &accessLogRecord{}
+			rw     = &responseWriter{ResponseWriter: w}
+		)
+		ctx := context.WithValue(r.Context(), accessLogRecordKey{}, record)
+		next.ServeHTTP(rw, r.WithContext(ctx))
+
+		var buf bytes.Buffer
+		a.encode(&buf, r, rw, record, start, time.Since(start))
+		buf.WriteByte('\n')
+
+		if _, err := a.writer.Write(buf.Bytes()); err != nil {
+			a.logger.Error("access log write error", "error", err)
+		}
+	})
+}
+
+// encode the request, the time logged is when the request started, like the web servers do.
+func (a *accessLog) encode(
+	buf *bytes.Buffer,
+	r *http.Request,
+	rw *responseWriter,
+	record *accessLogRecord,
+	start time.Time,
+	latency time.Duration,
+) {
+	var (
+		remote = clientIP(r)
+		user   = "-"
+	)
+	if username, _, ok := r.BasicAuth(); ok && username != "" {
+		user = username
+	}
+
+	extra := make([]log.Field, 0, len(a.fields))
+	for _, field := range a.fields {
+		var value interface{}
+		switch field {
+		case accessLogFieldHost:
+			value = r.Host
+		case accessLogFieldHandler:
+			value = record.handler
+		case accessLogFieldUpstream:
+			value = record.upstream
+		case accessLogFieldLatency:
+			value = latency
+		case accessLogFieldBytes:
+			value = rw.bytes
+		case accessLogFieldRequestID:
+			value = record.requestID
+		}
+		extra = append(extra, log.Field{Key: field, Value: value})
+	}
+
+	switch a.format {
+	case accessLogFormatCommon, accessLogFormatCombined:
+		size := "-"
+		if rw.bytes > 0 {
+			size = strconv.FormatInt(rw.bytes, 10)
+		}
+		fmt.Fprintf(
+			buf, `%s - %s [%s] "%s %s %s" %d %s`,
+			remote, user, start.Format("02/Jan/2006:15:04:05 -0700"), r.Method, r.RequestURI, r.Proto, rw.Status(), size,
+		)
+		if a.format == accessLogFormatCombined {
+			fmt.Fprintf(buf, " %q %q", r.Referer(), r.UserAgent())
+		}
+		if len(extra) > 0 {
+			buf.WriteByte(' ')
+			log.EncodeLogfmt(buf, extra)
+		}
+	case accessLogFormatJSON, accessLogFormatLogfmt:
+		fields := []log.Field{
+			{Key: "time", Value: start},
+			{Key: "remote", Value: remote},
+			{Key: "user", Value: user},
+			{Key: "method", Value: r.Method},
+			{Key: "uri", Value: r.RequestURI},
+			{Key: "proto", Value: r.Proto},
+			{Key: "status", Value: rw.Status()},
+			{Key: "referer", Value: r.Referer()},
+			{Key: "user-agent", Value: r.UserAgent()},
+		}
+		fields = append(fields, extra...)
+
+		if a.format == accessLogFormatJSON {
+			log.EncodeJSON(buf, fields)
+		} else {
+			log.EncodeLogfmt(buf, fields)
+		}
+	}
+}
+
+func newAccessLog(config ServerConfigAccessLog, logger *log.Logger) (*accessLog, error) {
+	switch config.Format {
+	case accessLogFormatCommon, accessLogFormatCombined, accessLogFormatJSON, accessLogFormatLogfmt:
+	default:
+		return nil, fmt.Errorf("invalid format '%s'", config.Format)
+	}
+
+	for _, field := range config.Fields {
+		switch field {
+		case accessLogFieldHost, accessLogFieldHandler, accessLogFieldUpstream, accessLogFieldLatency,
+			accessLogFieldBytes, accessLogFieldRequestID:
+		default:
+			return nil, fmt.Errorf("invalid field '%s'", field)
+		}
+	}
+
+	writer, err := log.NewWriter(config.Output)
+	if err != nil {
+		return nil, errors.Wrapf(err, "output '%s' initialization error", config.Output)
+	}
+
+	return &accessLog{
+		format: config.Format,
+		fields: config.Fields,
+		writer: writer,
+		logger: logger,
+	}, nil
+}
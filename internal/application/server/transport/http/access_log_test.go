@@ -0,0 +1,142 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type accessLogBuffer struct {
+	bytes.Buffer
+}
+
+func (*accessLogBuffer) Reopen() error { return nil }
+func (*accessLogBuffer) Close() error  { return nil }
+
+func TestAccessLogEncode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		format   string
+		fields   []string
+		expected string
+	}{
+		{
+			name:     "common",
+			format:   accessLogFormatCommon,
+			expected: `192.0.2.1 - john [10/Oct/2020:13:55:36 +0000] "GET /path?q=1 HTTP/1.1" 201 5`,
+		},
+		{
+			name:   "combined",
+			format: accessLogFormatCombined,
+			expected: `192.0.2.1 - john [10/Oct/2020:13:55:36 +0000] "GET /path?q=1 HTTP/1.1" 201 5 ` +
+				`"http://example.org" "client/1.0"`,
+		},
+		{
+			name:   "common with fields",
+			format: accessLogFormatCommon,
+			fields: []string{accessLogFieldHost, accessLogFieldLatency},
+			expected: `192.0.2.1 - john [10/Oct/2020:13:55:36 +0000] "GET /path?q=1 HTTP/1.1" 201 5 ` +
+				`host=example.com latency=1.5ms`,
+		},
+		{
+			name:   "json",
+			format: accessLogFormatJSON,
+			fields: []string{accessLogFieldHandler, accessLogFieldUpstream, accessLogFieldBytes, accessLogFieldRequestID},
+			expected: `{"time":"2020-10-10T13:55:36Z","remote":"192.0.2.1","user":"john","method":"GET",` +
+				`"uri":"/path?q=1","proto":"HTTP/1.1","status":201,"referer":"http://example.org",` +
+				`"user-agent":"client/1.0","handler":"base.Default","upstream":"http://upstream",` +
+				`"bytes":5,"request-id":"abc"}`,
+		},
+		{
+			name:   "logfmt",
+			format: accessLogFormatLogfmt,
+			fields: []string{accessLogFieldRequestID},
+			expected: `time=2020-10-10T13:55:36Z remote=192.0.2.1 user=john method=GET uri="/path?q=1" ` +
+				`proto=HTTP/1.1 status=201 referer=http://example.org user-agent=client/1.0 request-id=abc`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			a, err := newAccessLog(ServerConfigAccessLog{Format: tt.format, Fields: tt.fields}, nil)
+			require.NoError(t, err)
+
+			r := httptest.NewRequest(http.MethodGet, "/path?q=1", nil)
+			r.Host = "example.com"
+			r.RemoteAddr = "192.0.2.1:1234"
+			r.SetBasicAuth("john", "secret")
+			r.Header.Set("Referer", "http://example.org")
+			r.Header.Set("User-Agent", "client/1.0")
+
+			var (
+				buf    bytes.Buffer
+				rw     = &responseWriter{status: http.StatusCreated, bytes: 5}
+				record = &accessLogRecord{handler: "base.Default", upstream: "http://upstream", requestID: "abc"}
+				start  = time.Date(2020, 10, 10, 13, 55, 36, 0, time.UTC)
+			)
+			a.encode(&buf, r, rw, record, start, 1500*time.Microsecond)
+			require.Equal(t, tt.expected, buf.String())
+		})
+	}
+}
+
+func TestAccessLogMiddleware(t *testing.T) {
+	t.Parallel()
+
+	a, err := newAccessLog(ServerConfigAccessLog{
+		Format: accessLogFormatJSON,
+		Fields: []string{accessLogFieldHandler, accessLogFieldLatency, accessLogFieldRequestID},
+	}, nil)
+	require.NoError(t, err)
+	buf := &accessLogBuffer{}
+	a.writer = buf
+
+	var handled time.Time
+	handler := a.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accessLogRecordFromContext(r.Context()).handler = "base.Default"
+		time.Sleep(10 * time.Millisecond)
+		handled = time.Now()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	// The request ID is only set by the request ID middleware, the header sent by the client is ignored.
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Request-ID", "spoofed")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	var entry struct {
+		Time      time.Time `json:"time"`
+		Status    int       `json:"status"`
+		Handler   string    `json:"handler"`
+		Latency   string    `json:"latency"`
+		RequestID string    `json:"request-id"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	require.Equal(t, http.StatusNoContent, entry.Status)
+	require.Equal(t, "base.Default", entry.Handler)
+	require.Empty(t, entry.RequestID)
+	require.True(t, entry.Time.Before(handled), "the time should be when the request started")
+
+	latency, err := time.ParseDuration(entry.Latency)
+	require.NoError(t, err)
+	require.True(t, latency >= 10*time.Millisecond)
+}
+
+func TestNewAccessLogInvalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := newAccessLog(ServerConfigAccessLog{Format: "apache"}, nil)
+	require.Error(t, err)
+
+	_, err = newAccessLog(ServerConfigAccessLog{Format: accessLogFormatJSON, Fields: []string{"cookie"}}, nil)
+	require.Error(t, err)
+}
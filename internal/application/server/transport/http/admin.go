@@ -0,0 +1,167 @@
+package http
+
+import (
+	"encoding/json"
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+)
+
+// ServerConfigAdmin has the configuration of the admin listener. The admin API is never exposed at
+// the public listener. A port equal to zero disable the admin listener.
+type ServerConfigAdmin struct {
+	// Address is the interface the admin listener bind to, the default is '127.0.0.1'. The admin API
+	// don't have authentication, it should only be exposed at a trusted network.
+	Address string
+	Port    int
+
+	// Debug expose the pprof, goroutine dump and runtime stats endpoints.
+	Debug bool
+}
+
+// nolint: gochecknoglobals
+var (
+	// expvar variables are global, they can only be published once.
+	adminRuntimeOnce sync.Once
+	adminStartedAt   = time.Now()
+)
+
+func (s *Server) startAdmin() {
+	if s.config.Admin.Port == 0 {
+		return
+	}
+
+	s.admin = &http.Server{
+		Addr:    s.adminAddr(),
+		Handler: s.adminMux,
+	}
+
+	s.config.Logger.Info("admin server listening", "addr", s.admin.Addr)
+	go func() {
+		if err := s.admin.ListenAndServe(); err != http.ErrServerClosed {
+			err = errors.Wrapf(err, "admin server listen error at addr '%s'", s.admin.Addr)
+			s.config.AsyncErrorHandler(err)
+		}
+	}()
+}
+
+func (s *Server) adminAddr() string {
+	address := s.config.Admin.Address
+	if address == "" {
+		address = "127.0.0.1"
+	}
+	return net.JoinHostPort(address, strconv.Itoa(s.config.Admin.Port))
+}
+
+func (s *Server) initAdmin() {
+	s.adminMux = chi.NewRouter()
+	s.adminMux.Get("/health", s.adminHealth)
+	s.adminMux.Delete("/cache/{host}", s.adminCachePurge)
+	s.adminMux.Get("/maintenance", s.adminMaintenanceList)
+	s.adminMux.Get("/mirror", s.adminMirrorStats)
+	s.adminMux.Get("/split/{host}", s.adminSplitGet)
+	s.adminMux.Put("/split/{host}", s.adminSplitSet)
+	s.adminMux.Put("/maintenance/{host}", s.adminMaintenanceEnable)
+	s.adminMux.Delete("/maintenance/{host}", s.adminMaintenanceDisable)
+	s.adminMux.Get("/recovery", s.adminRecoveryList)
+	s.adminMux.Delete("/recovery/{pipe}", s.adminRecoveryReset)
+	if s.config.Store != nil {
+		s.adminMux.Get("/store", s.adminStoreNamespaces)
+		s.adminMux.Get("/store/{namespace}", s.adminStoreKeys)
+		// The key is a wildcard as it may have '/'.
+		s.adminMux.Get("/store/{namespace}/*", s.adminStoreGet)
+		s.adminMux.Delete("/store/{namespace}/*", s.adminStoreDelete)
+	}
+	if s.config.Admin.Debug {
+		s.initAdminDebug(s.adminMux)
+	}
+}
+
+func (Server) initAdminDebug(mux *chi.Mux) {
+	adminRuntimeOnce.Do(func() {
+		expvar.Publish("runtime", expvar.Func(adminRuntimeStats))
+	})
+
+	mux.Route("/debug", func(r chi.Router) {
+		// The index also serve the named profiles, like '/debug/pprof/heap'.
+		r.HandleFunc("/pprof/*", pprof.Index)
+		r.HandleFunc("/pprof/cmdline", pprof.Cmdline)
+		r.HandleFunc("/pprof/profile", pprof.Profile)
+		r.HandleFunc("/pprof/symbol", pprof.Symbol)
+		r.HandleFunc("/pprof/trace", pprof.Trace)
+		r.HandleFunc("/goroutines", adminGoroutineDump)
+		r.Handle("/vars", expvar.Handler())
+	})
+}
+
+// adminHealth report the health of the pipes that support it. The status is 503 if any pipe is
+// unhealthy.
+func (s *Server) adminHealth(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	pipes := make(map[string]string)
+	if s.config.PipeHealth != nil {
+		for pipe, err := range s.config.PipeHealth.Health(r.Context()) {
+			if err != nil {
+				status = http.StatusServiceUnavailable
+				pipes[pipe] = err.Error()
+				continue
+			}
+			pipes[pipe] = "ok"
+		}
+	}
+
+	payload, err := json.Marshal(struct {
+		Status string            `json:"status"`
+		Pipes  map[string]string `json:"pipes"`
+	}{http.StatusText(status), pipes})
+	if err != nil {
+		s.config.Logger.Error("health error", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(payload) // nolint: errcheck
+}
+
+// adminGoroutineDump write the stack trace of all the goroutines.
+func adminGoroutineDump(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			w.Write(buf[:n]) // nolint: errcheck
+			return
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+func adminRuntimeStats() interface{} {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	return map[string]interface{}{
+		"goroutines":      runtime.NumGoroutine(),
+		"cpus":            runtime.NumCPU(),
+		"gomaxprocs":      runtime.GOMAXPROCS(0),
+		"cgo-calls":       runtime.NumCgoCall(),
+		"go-version":      runtime.Version(),
+		"uptime":          time.Since(adminStartedAt).String(),
+		"heap-alloc":      mem.HeapAlloc,
+		"heap-objects":    mem.HeapObjects,
+		"gc-count":        mem.NumGC,
+		"gc-pause-total":  time.Duration(mem.PauseTotalNs).String(),
+		"gc-cpu-fraction": mem.GCCPUFraction,
+	}
+}
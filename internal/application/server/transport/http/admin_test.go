@@ -0,0 +1,76 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerAdminAddr(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		config ServerConfigAdmin
+		addr   string
+	}{
+		{"default", ServerConfigAdmin{Port: 8081}, "127.0.0.1:8081"},
+		{"address", ServerConfigAdmin{Address: "0.0.0.0", Port: 8081}, "0.0.0.0:8081"},
+		{"ipv6", ServerConfigAdmin{Address: "::1", Port: 8081}, "[::1]:8081"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := Server{config: ServerConfig{Admin: tt.config}}
+			require.Equal(t, tt.addr, s.adminAddr())
+		})
+	}
+}
+
+func TestServerAdminDebug(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		debug  bool
+		status int
+	}{
+		{"enabled", true, http.StatusOK},
+		{"disabled", false, http.StatusNotFound},
+	}
+
+	paths := []string{
+		"/debug/pprof/",
+		"/debug/pprof/heap",
+		"/debug/pprof/cmdline",
+		"/debug/goroutines",
+		"/debug/vars",
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := &Server{config: ServerConfig{Admin: ServerConfigAdmin{Debug: tt.debug}}}
+			s.initAdmin()
+
+			for _, path := range paths {
+				w := httptest.NewRecorder()
+				s.adminMux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+				require.Equalf(t, tt.status, w.Code, "path '%s'", path)
+				if tt.status == http.StatusOK {
+					require.NotEmptyf(t, w.Body.Bytes(), "path '%s'", path)
+				}
+				if tt.debug && (path == "/debug/vars") {
+					require.Contains(t, w.Body.String(), `"runtime":`)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/pipehub/pipehub/internal"
+	"github.com/pipehub/pipehub/internal/infra/log"
+)
+
+// Authentication methods.
+const (
+	authMethodBasic  = "basic"
+	authMethodAPIKey = "api-key"
+	authMethodJWT    = "jwt"
+)
+
+// authIdentity is the result of a successful authentication. It's stored at the request context, the
+// claims are set only by the JWT method.
+type authIdentity struct {
+	method  string
+	subject string
+	claims  map[string]interface{}
+}
+
+type authenticator interface {
+	// authenticate return false if the request don't have valid credentials.
+	authenticate(r *http.Request) (authIdentity, bool)
+
+	// challenge is the value of the 'WWW-Authenticate' header, it can be empty.
+	challenge() string
+}
+
+// auth check the request credentials before the pipes. The identity is stored at the request
+// context, this way the pipes can use it.
+type auth struct {
+	authenticators []authenticator
+	challenges     []string
+}
+
+func (a auth) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, authenticator := range a.authenticators {
+			identity, ok := authenticator.authenticate(r)
+			if !ok {
+				continue
+			}
+
+			ctx := contextWithValue(r.Context(), contextKeyAuthMethod, identity.method)
+			ctx = contextWithValue(ctx, contextKeyAuthSubject, identity.subject)
+			if identity.claims != nil {
+				ctx = contextWithValue(ctx, contextKeyAuthClaims, identity.claims)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		if len(a.challenges) > 0 {
+			w.Header().Set("WWW-Authenticate", strings.Join(a.challenges, ", "))
+		}
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
+
+func newAuth(config internal.HostAuth, logger *log.Logger) (*auth, error) {
+	a := &auth{}
+
+	if config.Basic != nil {
+		basic, err := newAuthBasic(*config.Basic)
+		if err != nil {
+			return nil, errors.Wrap(err, "basic initialization error")
+		}
+		a.authenticators = append(a.authenticators, basic)
+	}
+
+	if config.APIKey != nil {
+		apiKey, err := newAuthAPIKey(*config.APIKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "api key initialization error")
+		}
+		a.authenticators = append(a.authenticators, apiKey)
+	}
+
+	if config.JWT != nil {
+		jwt, err := newAuthJWT(*config.JWT, logger)
+		if err != nil {
+			return nil, errors.Wrap(err, "jwt initialization error")
+		}
+		a.authenticators = append(a.authenticators, jwt)
+	}
+
+	if len(a.authenticators) == 0 {
+		return nil, errors.New("at least one authentication method is required")
+	}
+
+	for _, authenticator := range a.authenticators {
+		if challenge := authenticator.challenge(); challenge != "" {
+			a.challenges = append(a.challenges, challenge)
+		}
+	}
+	return a, nil
+}
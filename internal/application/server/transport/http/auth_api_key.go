@@ -0,0 +1,82 @@
+package http
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+// authAPIKeyDefaultHeader is the header used to send the key if none is configured.
+const authAPIKeyDefaultHeader = "X-API-Key"
+
+// authAPIKey validate the key sent at a header. The keys are indexed by hash, this way the lookup
+// time don't depend on how much of the key is right.
+type authAPIKey struct {
+	header string
+	keys   map[[sha256.Size]byte]string
+}
+
+func (a authAPIKey) authenticate(r *http.Request) (authIdentity, bool) {
+	key := r.Header.Get(a.header)
+	if key == "" {
+		return authIdentity{}, false
+	}
+
+	name, ok := a.keys[sha256.Sum256([]byte(key))]
+	if !ok {
+		return authIdentity{}, false
+	}
+	return authIdentity{method: authMethodAPIKey, subject: name}, true
+}
+
+func (authAPIKey) challenge() string {
+	return ""
+}
+
+// loadAPIKeys read the keys from the file. The keys without a name are named after the line number.
+func loadAPIKeys(path string) (map[[sha256.Size]byte]string, error) {
+	f, err := os.Open(path) // nolint: gosec
+	if err != nil {
+		return nil, errors.Wrap(err, "open file error")
+	}
+	defer f.Close() // nolint: errcheck
+
+	keys := make(map[[sha256.Size]byte]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if (entry == "") || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		name, key := "line-"+strconv.Itoa(line), entry
+		if fragments := strings.SplitN(entry, ":", 2); len(fragments) == 2 {
+			name, key = fragments[0], fragments[1]
+		}
+		keys[sha256.Sum256([]byte(key))] = name
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "read file error")
+	}
+	return keys, nil
+}
+
+func newAuthAPIKey(config internal.HostAuthAPIKey) (authAPIKey, error) {
+	keys, err := loadAPIKeys(config.File)
+	if err != nil {
+		return authAPIKey{}, errors.Wrapf(err, "load keys '%s' error", config.File)
+	}
+
+	a := authAPIKey{header: config.Header, keys: keys}
+	if a.header == "" {
+		a.header = authAPIKeyDefaultHeader
+	}
+	return a, nil
+}
@@ -0,0 +1,99 @@
+package http
+
+import (
+	"bufio"
+	"crypto/sha1" // nolint: gosec
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+// authBasic validate the credentials against the users loaded from a htpasswd file.
+type authBasic struct {
+	realm string
+	users map[string]string
+}
+
+func (a authBasic) authenticate(r *http.Request) (authIdentity, bool) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return authIdentity{}, false
+	}
+
+	hash, ok := a.users[username]
+	if !ok || !authBasicVerify(hash, password) {
+		return authIdentity{}, false
+	}
+	return authIdentity{method: authMethodBasic, subject: username}, true
+}
+
+func (a authBasic) challenge() string {
+	return fmt.Sprintf("Basic realm=%q", a.realm)
+}
+
+func authBasicVerify(hash, password string) bool {
+	if strings.HasPrefix(hash, "{SHA}") {
+		sum := sha1.Sum([]byte(password)) // nolint: gosec
+		expected := base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(hash, "{SHA}")), []byte(expected)) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// loadHtpasswd read the users from a htpasswd file. Only the bcrypt and SHA1 hashes are supported,
+// the other formats are rejected to avoid a user that can never authenticate.
+func loadHtpasswd(path string) (map[string]string, error) {
+	f, err := os.Open(path) // nolint: gosec
+	if err != nil {
+		return nil, errors.Wrap(err, "open file error")
+	}
+	defer f.Close() // nolint: errcheck
+
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if (entry == "") || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		fragments := strings.SplitN(entry, ":", 2)
+		if len(fragments) != 2 {
+			return nil, fmt.Errorf("invalid entry at line %d", line)
+		}
+
+		hash := fragments[1]
+		switch {
+		case strings.HasPrefix(hash, "{SHA}"):
+		case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		default:
+			return nil, fmt.Errorf("unsupported hash at line %d, only bcrypt and SHA1 are supported", line)
+		}
+		users[fragments[0]] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "read file error")
+	}
+	return users, nil
+}
+
+func newAuthBasic(config internal.HostAuthBasic) (authBasic, error) {
+	users, err := loadHtpasswd(config.Htpasswd)
+	if err != nil {
+		return authBasic{}, errors.Wrapf(err, "load htpasswd '%s' error", config.Htpasswd)
+	}
+
+	a := authBasic{realm: config.Realm, users: users}
+	if a.realm == "" {
+		a.realm = "pipehub"
+	}
+	return a, nil
+}
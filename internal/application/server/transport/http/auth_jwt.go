@@ -0,0 +1,359 @@
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+
+	"github.com/pipehub/pipehub/internal"
+	"github.com/pipehub/pipehub/internal/infra/log"
+)
+
+const (
+	// authJWKSDefaultRefresh is the interval the JWKS is fetched again.
+	authJWKSDefaultRefresh = time.Hour
+
+	// authJWKSMinInterval is the minimum interval between two fetches caused by unknown key ids, this
+	// way a client can't make PipeHub flood the JWKS server.
+	authJWKSMinInterval = 10 * time.Second
+)
+
+// nolint: gochecknoglobals
+var (
+	authJWTAsymmetricAlgorithms = []string{
+		"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512",
+	}
+	authJWTHMACAlgorithms = []string{"HS256", "HS384", "HS512"}
+)
+
+// authJWT validate the bearer token. The token is validated against the secret, the static keys and
+// the JWKS keys.
+type authJWT struct {
+	parser   *jwt.Parser
+	secret   []byte
+	keys     []interface{}
+	jwks     *authJWKS
+	issuer   string
+	audience string
+}
+
+func (a authJWT) authenticate(r *http.Request) (authIdentity, bool) {
+	header := r.Header.Get("Authorization")
+	if (len(header) < 7) || !strings.EqualFold(header[:7], "bearer ") {
+		return authIdentity{}, false
+	}
+	raw := strings.TrimSpace(header[7:])
+
+	unverified, _, err := a.parser.ParseUnverified(raw, jwt.MapClaims{})
+	if err != nil {
+		return authIdentity{}, false
+	}
+
+	for _, key := range a.candidates(unverified) {
+		claims := jwt.MapClaims{}
+		token, err := a.parser.ParseWithClaims(raw, claims, func(*jwt.Token) (interface{}, error) {
+			return key, nil
+		})
+		if (err != nil) || !token.Valid {
+			continue
+		}
+
+		if (a.issuer != "") && !claims.VerifyIssuer(a.issuer, true) {
+			return authIdentity{}, false
+		}
+		if (a.audience != "") && !claims.VerifyAudience(a.audience, true) {
+			return authIdentity{}, false
+		}
+
+		subject, _ := claims["sub"].(string) // nolint: errcheck
+		return authIdentity{method: authMethodJWT, subject: subject, claims: claims}, true
+	}
+	return authIdentity{}, false
+}
+
+func (authJWT) challenge() string {
+	return "Bearer"
+}
+
+// candidates return the keys that may have signed the token.
+func (a authJWT) candidates(token *jwt.Token) []interface{} {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if a.secret == nil {
+			return nil
+		}
+		return []interface{}{a.secret}
+	}
+
+	keys := append([]interface{}{}, a.keys...)
+	if a.jwks != nil {
+		kid, _ := token.Header["kid"].(string) // nolint: errcheck
+		keys = append(keys, a.jwks.find(kid)...)
+	}
+	return keys
+}
+
+// authJWKS keep the keys fetched from a JWKS endpoint. The keys are fetched again in background,
+// started by a request, when they're older than the refresh interval or when a unknown key id is
+// found. There is at most one fetch at a time, only the requests with a unknown key id wait for it
+// and the others keep using the current keys.
+type authJWKS struct {
+	url     string
+	refresh time.Duration
+	client  *http.Client
+	logger  *log.Logger
+
+	mutex    sync.Mutex
+	keys     map[string]interface{}
+	fetched  time.Time
+	fetching chan struct{}
+}
+
+func (j *authJWKS) find(kid string) []interface{} {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	_, found := j.keys[kid]
+	missing := (kid != "") && !found
+	elapsed := time.Since(j.fetched)
+	if (j.fetching == nil) && ((elapsed > j.refresh) || (missing && (elapsed > authJWKSMinInterval))) {
+		j.startFetch()
+	}
+	if missing {
+		// The fetch in progress may have the key.
+		if done := j.fetching; done != nil {
+			j.mutex.Unlock()
+			<-done
+			j.mutex.Lock()
+		}
+	}
+
+	if kid != "" {
+		if key, ok := j.keys[kid]; ok {
+			return []interface{}{key}
+		}
+		return nil
+	}
+
+	keys := make([]interface{}, 0, len(j.keys))
+	for _, key := range j.keys {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// startFetch fetch the keys in background, it should be called with the mutex locked.
+func (j *authJWKS) startFetch() {
+	done := make(chan struct{})
+	j.fetching = done
+	j.fetched = time.Now()
+
+	go func() {
+		keys, err := j.fetch()
+
+		j.mutex.Lock()
+		defer j.mutex.Unlock()
+		j.fetching = nil
+		close(done)
+
+		if err != nil {
+			// The keys already fetched are still used.
+			j.logger.Error("jwks fetch error", "error", err, "url", j.url)
+			return
+		}
+		j.keys = keys
+	}()
+}
+
+// fetch return the keys from the JWKS endpoint. It don't touch the state, so it can be called without
+// the mutex.
+func (j *authJWKS) fetch() (map[string]interface{}, error) {
+	resp, err := j.client.Get(j.url)
+	if err != nil {
+		return nil, errors.Wrap(err, "request error")
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code '%d'", resp.StatusCode)
+	}
+
+	payload, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "read body error")
+	}
+
+	keys, err := parseJWKS(payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse error")
+	}
+	return keys, nil
+}
+
+type authJWK struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS return the signature keys indexed by key id. The keys with unknown types are ignored.
+func parseJWKS(payload []byte) (map[string]interface{}, error) {
+	var set struct {
+		Keys []authJWK `json:"keys"`
+	}
+	if err := json.Unmarshal(payload, &set); err != nil {
+		return nil, errors.Wrap(err, "unmarshal error")
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if (jwk.Use != "") && (jwk.Use != "sig") {
+			continue
+		}
+
+		var (
+			key interface{}
+			err error
+		)
+		switch jwk.Kty {
+		case "RSA":
+			key, err = jwk.rsa()
+		case "EC":
+			key, err = jwk.ecdsa()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "key '%s' error", jwk.Kid)
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func (jwk authJWK) rsa() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode modulus error")
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode exponent error")
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
+
+func (jwk authJWK) ecdsa() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch jwk.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve '%s'", jwk.Crv)
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode x error")
+	}
+	y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode y error")
+	}
+
+	return &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}, nil
+}
+
+// loadJWTKey read a PEM encoded RSA or ECDSA public key.
+func loadJWTKey(path string) (interface{}, error) {
+	payload, err := ioutil.ReadFile(path) // nolint: gosec
+	if err != nil {
+		return nil, errors.Wrap(err, "read file error")
+	}
+
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(payload); err == nil {
+		return key, nil
+	}
+	if key, err := jwt.ParseECPublicKeyFromPEM(payload); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("the file don't have a RSA or ECDSA public key")
+}
+
+func newAuthJWT(config internal.HostAuthJWT, logger *log.Logger) (authJWT, error) {
+	a := authJWT{
+		issuer:   config.Issuer,
+		audience: config.Audience,
+	}
+	if config.Secret != "" {
+		a.secret = []byte(config.Secret)
+	}
+
+	for _, path := range config.Keys {
+		key, err := loadJWTKey(path)
+		if err != nil {
+			return authJWT{}, errors.Wrapf(err, "load key '%s' error", path)
+		}
+		a.keys = append(a.keys, key)
+	}
+
+	if config.JWKSURL != "" {
+		a.jwks = &authJWKS{
+			url:     config.JWKSURL,
+			refresh: config.JWKSRefresh,
+			client:  &http.Client{Timeout: 10 * time.Second},
+			logger:  logger,
+		}
+		if a.jwks.refresh <= 0 {
+			a.jwks.refresh = authJWKSDefaultRefresh
+		}
+		keys, err := a.jwks.fetch()
+		if err != nil {
+			return authJWT{}, errors.Wrapf(err, "fetch jwks '%s' error", config.JWKSURL)
+		}
+		a.jwks.keys, a.jwks.fetched = keys, time.Now()
+	}
+
+	if (a.secret == nil) && (len(a.keys) == 0) && (a.jwks == nil) {
+		return authJWT{}, errors.New("a secret, key or jwks url is required")
+	}
+
+	algorithms := config.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = append(algorithms, authJWTAsymmetricAlgorithms...)
+		if a.secret != nil {
+			algorithms = append(algorithms, authJWTHMACAlgorithms...)
+		}
+	}
+	a.parser = jwt.NewParser(jwt.WithValidMethods(algorithms))
+
+	return a, nil
+}
@@ -0,0 +1,263 @@
+package http
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "pipehub-auth-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	htpasswd := filepath.Join(dir, "htpasswd")
+	require.NoError(t, ioutil.WriteFile(htpasswd, []byte("user:"+string(hash)+"\n"), 0600))
+
+	apiKeys := filepath.Join(dir, "api-keys")
+	require.NoError(t, ioutil.WriteFile(apiKeys, []byte("# keys\nservice:key-1\nkey-2\n"), 0600))
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{ // nolint: errcheck, gosec
+			"keys": []map[string]string{{
+				"kid": "key-1",
+				"kty": "RSA",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+	defer jwks.Close()
+
+	sign := func(method jwt.SigningMethod, kid string, signKey interface{}, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		raw, err := token.SignedString(signKey)
+		require.NoError(t, err)
+		return "Bearer " + raw
+	}
+	valid := jwt.MapClaims{"sub": "john", "iss": "pipehub", "exp": time.Now().Add(time.Hour).Unix()}
+	expired := jwt.MapClaims{"sub": "john", "iss": "pipehub", "exp": time.Now().Add(-time.Hour).Unix()}
+
+	auth, err := newAuth(internal.HostAuth{
+		Basic:  &internal.HostAuthBasic{Htpasswd: htpasswd},
+		APIKey: &internal.HostAuthAPIKey{File: apiKeys},
+		JWT:    &internal.HostAuthJWT{Secret: "hmac", JWKSURL: jwks.URL, Issuer: "pipehub"},
+	}, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		header  http.Header
+		status  int
+		method  string
+		subject string
+	}{
+		{
+			"no credentials",
+			http.Header{},
+			http.StatusUnauthorized, "", "",
+		},
+		{
+			"basic",
+			http.Header{"Authorization": {"Basic " + base64.StdEncoding.EncodeToString([]byte("user:secret"))}},
+			http.StatusOK, authMethodBasic, "user",
+		},
+		{
+			"basic with invalid password",
+			http.Header{"Authorization": {"Basic " + base64.StdEncoding.EncodeToString([]byte("user:invalid"))}},
+			http.StatusUnauthorized, "", "",
+		},
+		{
+			"api key with name",
+			http.Header{"X-Api-Key": {"key-1"}},
+			http.StatusOK, authMethodAPIKey, "service",
+		},
+		{
+			"api key without name",
+			http.Header{"X-Api-Key": {"key-2"}},
+			http.StatusOK, authMethodAPIKey, "line-3",
+		},
+		{
+			"invalid api key",
+			http.Header{"X-Api-Key": {"key-3"}},
+			http.StatusUnauthorized, "", "",
+		},
+		{
+			"jwt with hmac",
+			http.Header{"Authorization": {sign(jwt.SigningMethodHS256, "", []byte("hmac"), valid)}},
+			http.StatusOK, authMethodJWT, "john",
+		},
+		{
+			"jwt with jwks",
+			http.Header{"Authorization": {sign(jwt.SigningMethodRS256, "key-1", key, valid)}},
+			http.StatusOK, authMethodJWT, "john",
+		},
+		{
+			"expired jwt",
+			http.Header{"Authorization": {sign(jwt.SigningMethodRS256, "key-1", key, expired)}},
+			http.StatusUnauthorized, "", "",
+		},
+		{
+			"jwt with invalid issuer",
+			http.Header{"Authorization": {sign(jwt.SigningMethodHS256, "", []byte("hmac"), jwt.MapClaims{"iss": "other"})}},
+			http.StatusUnauthorized, "", "",
+		},
+		{
+			"jwt with invalid signature",
+			http.Header{"Authorization": {sign(jwt.SigningMethodHS256, "", []byte("other"), valid)}},
+			http.StatusUnauthorized, "", "",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var method, subject interface{}
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				method = r.Context().Value(contextKeyAuthMethod)
+				subject = r.Context().Value(contextKeyAuthSubject)
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header = tt.header
+			w := httptest.NewRecorder()
+			auth.middleware(handler).ServeHTTP(w, r)
+
+			require.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusOK {
+				require.Equal(t, tt.method, method)
+				require.Equal(t, tt.subject, subject)
+			} else {
+				require.Equal(t, `Basic realm="pipehub", Bearer`, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+// authJWKSServer serve the keys 'key-1' and 'key-2', the responses wait for the release.
+func authJWKSServer(key *rsa.PrivateKey, fetches *int32, release <-chan struct{}) *httptest.Server {
+	jwk := map[string]string{
+		"kty": "RSA",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(fetches, 1)
+		<-release
+		keys := []map[string]string{{"kid": "key-1"}, {"kid": "key-2"}}
+		for _, k := range keys {
+			for name, value := range jwk {
+				k[name] = value
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys}) // nolint: errcheck, gosec
+	}))
+}
+
+func TestAuthJWKSFind(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var fetches int32
+	release := make(chan struct{})
+	server := authJWKSServer(key, &fetches, release)
+	defer server.Close()
+
+	j := &authJWKS{
+		url:     server.URL,
+		refresh: time.Hour,
+		client:  server.Client(),
+		keys:    map[string]interface{}{"key-1": &key.PublicKey},
+		fetched: time.Now().Add(-time.Minute),
+	}
+
+	// The requests with a unknown key id share the same fetch and wait for it.
+	var wg sync.WaitGroup
+	results := make([][]interface{}, 5)
+	for i := range results {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = j.find("key-2")
+		}()
+	}
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&fetches) == 1
+	}, time.Second, time.Millisecond)
+
+	// The mutex is not held during the fetch, so the known keys are still found.
+	require.Len(t, j.find("key-1"), 1)
+
+	close(release)
+	wg.Wait()
+	for _, result := range results {
+		require.Len(t, result, 1)
+	}
+	require.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+}
+
+func TestAuthJWKSRefresh(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var fetches int32
+	release := make(chan struct{})
+	server := authJWKSServer(key, &fetches, release)
+	defer server.Close()
+
+	j := &authJWKS{
+		url:     server.URL,
+		refresh: time.Hour,
+		client:  server.Client(),
+		keys:    map[string]interface{}{"key-1": &key.PublicKey},
+		fetched: time.Now().Add(-2 * time.Hour),
+	}
+
+	// The scheduled refresh is done in background, the requests keep using the current keys.
+	require.Len(t, j.find("key-1"), 1)
+	require.Len(t, j.find(""), 1)
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&fetches) == 1
+	}, time.Second, time.Millisecond)
+
+	close(release)
+	require.Eventually(t, func() bool {
+		return len(j.find("")) == 2
+	}, time.Second, time.Millisecond)
+	require.Len(t, j.find("key-2"), 1)
+	require.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+}
@@ -0,0 +1,584 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+
+	"github.com/pipehub/pipehub/internal"
+	"github.com/pipehub/pipehub/internal/infra/log"
+)
+
+// Values of the cache status header.
+const (
+	cacheStatusHit         = "HIT"
+	cacheStatusMiss        = "MISS"
+	cacheStatusStale       = "STALE"
+	cacheStatusRevalidated = "REVALIDATED"
+	cacheStatusBypass      = "BYPASS"
+)
+
+// Stores supported by the cache.
+const (
+	cacheStoreMemory = "memory"
+	cacheStoreDisk   = "disk"
+)
+
+// cache is a HTTP cache in front of the upstream. It follow the 'Cache-Control', 'Expires' and
+// 'Vary' headers, revalidate stale responses with 'ETag' and 'Last-Modified' and support the
+// 'stale-while-revalidate' extension.
+type cache struct {
+	store        cacheStore
+	maxEntrySize int64
+	statusHeader string
+	logger       *log.Logger
+	now          func() time.Time
+
+	// Keys being revalidated at the background.
+	revalidating sync.Map
+}
+
+func (c *cache) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !c.cacheableRequest(r) {
+			w.Header().Set(c.statusHeader, cacheStatusBypass)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var (
+			key       = c.key(r)
+			requestCC = parseCacheControl(r.Header)
+			now       = c.now()
+			entry     = c.lookup(r, key)
+		)
+		switch {
+		case (entry == nil) || requestCC.has("no-cache"):
+		case requestCC.has("max-age") && (now.Sub(entry.Stored) > requestCC.duration("max-age")):
+		case now.Before(entry.Expires):
+			c.serve(w, r, entry, cacheStatusHit, now)
+			return
+		case now.Before(entry.StaleUntil):
+			c.serve(w, r, entry, cacheStatusStale, now)
+			c.revalidateBackground(r, next, key, entry)
+			return
+		}
+
+		c.fetch(w, r, next, key, entry, now)
+	})
+}
+
+// cacheableRequest check if the request can be answered by the cache. Only GET and HEAD requests
+// without ranges and protocol upgrades are handled.
+func (*cache) cacheableRequest(r *http.Request) bool {
+	if (r.Method != http.MethodGet) && (r.Method != http.MethodHead) {
+		return false
+	}
+
+	if (r.Header.Get("Range") != "") || (r.Header.Get("Upgrade") != "") {
+		return false
+	}
+
+	return !parseCacheControl(r.Header).has("no-store")
+}
+
+// key is generated with the original host and URI, as the pipes may change the request URL.
+func (*cache) key(r *http.Request) string {
+	return r.Host + "|" + r.RequestURI
+}
+
+// lookup fetch the index entry, which has the headers used to select the variant, and then the
+// response variant.
+func (c *cache) lookup(r *http.Request, key string) *cacheEntry {
+	index, ok := c.store.Get(key)
+	if !ok {
+		return nil
+	}
+
+	entry, ok := c.store.Get(cacheVariantKey(key, index.Vary, r.Header))
+	if !ok {
+		return nil
+	}
+	return entry
+}
+
+func (c *cache) serve(w http.ResponseWriter, r *http.Request, entry *cacheEntry, status string, now time.Time) {
+	header := w.Header()
+	cacheCopyHeader(header, entry.Header)
+	header.Set("Age", strconv.Itoa(int(now.Sub(entry.Stored).Seconds())))
+	header.Set(c.statusHeader, status)
+
+	if cacheNotModified(r, entry) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(entry.Status)
+	if r.Method != http.MethodHead {
+		w.Write(entry.Body) // nolint: errcheck
+	}
+}
+
+// fetch the response from the upstream. When there is a entry with validators, the request is sent
+// as a conditional request to revalidate it, otherwise, the response is streamed to the client
+// while it's buffered to be stored.
+func (c *cache) fetch(
+	w http.ResponseWriter, r *http.Request, next http.Handler, key string, entry *cacheEntry, now time.Time,
+) {
+	if (entry == nil) || !entry.hasValidator() || (r.Method != http.MethodGet) {
+		// The headers already set at the response belong to this request and should not be stored.
+		preset := w.Header().Clone()
+
+		w.Header().Set(c.statusHeader, cacheStatusMiss)
+		rw := &cacheTeeWriter{responseWriter: responseWriter{ResponseWriter: w}, limit: c.maxEntrySize}
+		next.ServeHTTP(rw, r)
+		if (r.Method != http.MethodGet) || rw.overflow {
+			return
+		}
+
+		header := rw.header
+		if header == nil {
+			header = rw.Header().Clone()
+		}
+		cacheRemoveHeader(header, preset)
+		c.storeResponse(r, key, rw.Status(), header, rw.body.Bytes(), now)
+		return
+	}
+
+	rec := c.revalidate(r, next, entry)
+	if rec.Status() == http.StatusNotModified {
+		updated := c.refresh(r, key, entry, rec.Header(), now)
+		c.serve(w, r, updated, cacheStatusRevalidated, now)
+		return
+	}
+
+	header := w.Header()
+	cacheCopyHeader(header, rec.Header())
+	header.Set(c.statusHeader, cacheStatusMiss)
+	w.WriteHeader(rec.Status())
+	w.Write(rec.body.Bytes()) // nolint: errcheck
+
+	if int64(rec.body.Len()) <= c.maxEntrySize {
+		c.storeResponse(r, key, rec.Status(), rec.Header(), rec.body.Bytes(), now)
+	}
+}
+
+// revalidate send a conditional request to the upstream using the entry validators.
+func (*cache) revalidate(r *http.Request, next http.Handler, entry *cacheEntry) *cacheRecorder {
+	req := r.Clone(r.Context())
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Modified-Since")
+	if etag := entry.Header.Get("ETag"); etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	rec := &cacheRecorder{header: make(http.Header)}
+	next.ServeHTTP(rec, req)
+	return rec
+}
+
+// revalidateBackground refresh the entry without blocking the request. Only one revalidation per
+// key run at a time.
+func (c *cache) revalidateBackground(r *http.Request, next http.Handler, key string, entry *cacheEntry) {
+	if _, running := c.revalidating.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+
+	req := r.Clone(context.Background())
+	req.Body = http.NoBody
+	go func() {
+		defer c.revalidating.Delete(key)
+
+		now := c.now()
+		rec := c.revalidate(req, next, entry)
+		if rec.Status() == http.StatusNotModified {
+			c.refresh(req, key, entry, rec.Header(), now)
+			return
+		}
+		if int64(rec.body.Len()) <= c.maxEntrySize {
+			c.storeResponse(req, key, rec.Status(), rec.Header(), rec.body.Bytes(), now)
+		}
+	}()
+}
+
+// refresh update the entry with the headers received at the not modified response and store it.
+func (c *cache) refresh(
+	r *http.Request, key string, entry *cacheEntry, header http.Header, now time.Time,
+) *cacheEntry {
+	updated := *entry
+	updated.Header = entry.Header.Clone()
+	for _, name := range []string{"Cache-Control", "Expires", "Date", "ETag", "Last-Modified", "Vary"} {
+		if values, ok := header[name]; ok {
+			updated.Header[name] = values
+		}
+	}
+	updated.Stored = now
+
+	var ok bool
+	updated.Expires, updated.StaleUntil, ok = cacheFreshness(updated.Header, now)
+	if !ok {
+		return &updated
+	}
+
+	vary := cacheVaryNames(updated.Header)
+	if err := c.store.Set(cacheVariantKey(key, vary, r.Header), &updated); err != nil {
+		c.logger.Error("cache store error", "error", err, "key", key)
+	}
+	return &updated
+}
+
+// storeResponse persist the response if it's cacheable. Two entries are stored, the index, which
+// hold the headers from 'Vary', and the response variant.
+func (c *cache) storeResponse(
+	r *http.Request, key string, status int, header http.Header, body []byte, now time.Time,
+) {
+	if !cacheableResponse(r, status, header) {
+		return
+	}
+
+	expires, staleUntil, ok := cacheFreshness(header, now)
+	if !ok {
+		return
+	}
+
+	var (
+		vary  = cacheVaryNames(header)
+		index = &cacheEntry{Vary: vary}
+		entry = &cacheEntry{
+			Status:     status,
+			Header:     header.Clone(),
+			Body:       append([]byte(nil), body...),
+			Stored:     now,
+			Expires:    expires,
+			StaleUntil: staleUntil,
+		}
+	)
+	entry.Header.Del(c.statusHeader)
+
+	if err := c.store.Set(key, index); err != nil {
+		c.logger.Error("cache store error", "error", err, "key", key)
+		return
+	}
+	if err := c.store.Set(cacheVariantKey(key, vary, r.Header), entry); err != nil {
+		c.logger.Error("cache store error", "error", err, "key", key)
+	}
+}
+
+// purge remove the entries that have the path as prefix. An empty path remove all the entries.
+func (c *cache) purge(path string) (int, error) {
+	return c.store.Delete(func(key string) bool {
+		fragments := strings.SplitN(key, "|", 2)
+		return (len(fragments) == 2) && strings.HasPrefix(fragments[1], path)
+	})
+}
+
+// cacheNotModified check the client conditional request against the entry. The 'If-Modified-Since'
+// is only used when there is no 'If-None-Match', as the entity tag is more precise.
+func cacheNotModified(r *http.Request, entry *cacheEntry) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		etag := entry.Header.Get("ETag")
+		return (etag != "") && (match == etag)
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(entry.Header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.After(since)
+}
+
+func (e *cacheEntry) hasValidator() bool {
+	return (e.Header.Get("ETag") != "") || (e.Header.Get("Last-Modified") != "")
+}
+
+// cacheableResponse check if the response can be stored at a shared cache.
+func cacheableResponse(r *http.Request, status int, header http.Header) bool {
+	switch status {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusNoContent, http.StatusMultipleChoices,
+		http.StatusMovedPermanently, http.StatusNotFound, http.StatusGone:
+	default:
+		return false
+	}
+
+	if (header.Get("Set-Cookie") != "") || (header.Get("Vary") == "*") {
+		return false
+	}
+
+	cc := parseCacheControl(header)
+	if cc.has("no-store") || cc.has("private") {
+		return false
+	}
+
+	if r.Header.Get("Authorization") != "" {
+		return cc.has("public") || cc.has("s-maxage")
+	}
+	return true
+}
+
+// cacheFreshness calculate until when the response is fresh and until when it can be served stale
+// while it's revalidated. Responses without freshness information are only stored if they can be
+// revalidated.
+func cacheFreshness(header http.Header, now time.Time) (expires, staleUntil time.Time, ok bool) {
+	var (
+		cc       = parseCacheControl(header)
+		lifetime time.Duration
+	)
+	switch {
+	case cc.has("no-cache"):
+	case cc.has("s-maxage"):
+		lifetime = cc.duration("s-maxage")
+	case cc.has("max-age"):
+		lifetime = cc.duration("max-age")
+	case header.Get("Expires") != "":
+		value, err := http.ParseTime(header.Get("Expires"))
+		if err != nil {
+			break
+		}
+		date, err := http.ParseTime(header.Get("Date"))
+		if err != nil {
+			date = now
+		}
+		lifetime = value.Sub(date)
+	}
+
+	if age, err := strconv.Atoi(header.Get("Age")); err == nil {
+		lifetime -= time.Duration(age) * time.Second
+	}
+
+	if (lifetime <= 0) && (header.Get("ETag") == "") && (header.Get("Last-Modified") == "") {
+		return time.Time{}, time.Time{}, false
+	}
+
+	expires = now.Add(lifetime)
+	return expires, expires.Add(cc.duration("stale-while-revalidate")), true
+}
+
+// cacheCopyHeader copy the stored headers to the response. The 'Vary' values are appended, the ones
+// already at the response were set by the middlewares that run before the cache, like compression
+// and CORS.
+func cacheCopyHeader(dst, src http.Header) {
+	for key, values := range src {
+		if key == "Vary" {
+			dst[key] = append(dst[key], values...)
+			continue
+		}
+		dst[key] = append([]string(nil), values...)
+	}
+}
+
+// cacheRemoveHeader remove the values that were set before the upstream was called. Only the values
+// are removed, the upstream may have added values to the same header, like 'Vary'.
+func cacheRemoveHeader(header, preset http.Header) {
+	for key, presetValues := range preset {
+		values := header[key]
+		for _, presetValue := range presetValues {
+			for i, value := range values {
+				if value == presetValue {
+					values = append(values[:i:i], values[i+1:]...)
+					break
+				}
+			}
+		}
+		if len(values) == 0 {
+			delete(header, key)
+			continue
+		}
+		header[key] = values
+	}
+}
+
+// cacheVaryNames return the canonical names of the headers listed at 'Vary'.
+func cacheVaryNames(header http.Header) []string {
+	var names []string
+	for _, value := range header["Vary"] {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func cacheVariantKey(key string, vary []string, header http.Header) string {
+	var b strings.Builder
+	b.WriteString(key)
+	b.WriteString("|variant")
+	for _, name := range vary {
+		fmt.Fprintf(&b, "|%s=%s", name, strings.Join(header[name], ","))
+	}
+	return b.String()
+}
+
+type cacheControl map[string]string
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+func (cc cacheControl) duration(directive string) time.Duration {
+	seconds, err := strconv.Atoi(cc[directive])
+	if err != nil {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func parseCacheControl(header http.Header) cacheControl {
+	cc := make(cacheControl)
+	for _, value := range header["Cache-Control"] {
+		for _, directive := range strings.Split(value, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+
+			fragments := strings.SplitN(directive, "=", 2)
+			name := strings.ToLower(strings.TrimSpace(fragments[0]))
+			if len(fragments) == 1 {
+				cc[name] = ""
+				continue
+			}
+			cc[name] = strings.Trim(strings.TrimSpace(fragments[1]), `"`)
+		}
+	}
+	return cc
+}
+
+// cacheRecorder buffer the whole response.
+type cacheRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *cacheRecorder) Header() http.Header { return rec.header }
+
+func (rec *cacheRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
+
+func (rec *cacheRecorder) Write(p []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.body.Write(p)
+}
+
+func (rec *cacheRecorder) Status() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
+
+// cacheTeeWriter send the response to the client and buffer it until the limit is reached. The
+// headers are copied when the upstream write them, the middlewares that run before the cache, like
+// compression, change them after this point and the changes should not be stored.
+type cacheTeeWriter struct {
+	responseWriter
+	limit    int64
+	body     bytes.Buffer
+	overflow bool
+	header   http.Header
+}
+
+func (tw *cacheTeeWriter) WriteHeader(status int) {
+	if (tw.header == nil) && (status >= http.StatusOK) {
+		tw.header = tw.Header().Clone()
+	}
+	tw.responseWriter.WriteHeader(status)
+}
+
+func (tw *cacheTeeWriter) Write(p []byte) (int, error) {
+	if tw.header == nil {
+		tw.header = tw.Header().Clone()
+	}
+	if !tw.overflow {
+		if int64(tw.body.Len()+len(p)) > tw.limit {
+			tw.overflow = true
+			tw.body.Reset()
+		} else {
+			tw.body.Write(p)
+		}
+	}
+	return tw.responseWriter.Write(p)
+}
+
+func (s *Server) initCache(host internal.Host) error {
+	config := *host.Cache
+	if config.MaxEntrySize == 0 {
+		config.MaxEntrySize = 1 << 20
+	}
+	if config.StatusHeader == "" {
+		config.StatusHeader = "X-Cache"
+	}
+
+	c := &cache{
+		maxEntrySize: config.MaxEntrySize,
+		statusHeader: config.StatusHeader,
+		logger:       s.config.Logger.With("host", host.Endpoint),
+		now:          time.Now,
+	}
+
+	switch config.Store {
+	case "", cacheStoreMemory:
+		c.store = newCacheMemoryStore(config.MaxSize)
+	case cacheStoreDisk:
+		if config.Path == "" {
+			return errors.New("missing 'path' for the disk store")
+		}
+
+		var err error
+		c.store, err = newCacheDiskStore(config.Path, config.MaxSize)
+		if err != nil {
+			return errors.Wrap(err, "disk store initialization error")
+		}
+	default:
+		return fmt.Errorf("invalid store '%s'", config.Store)
+	}
+
+	s.caches[host.Endpoint] = c
+	return nil
+}
+
+// adminCachePurge remove the cached responses of a host. The query parameter 'path' can be used to
+// only remove the responses with the path as prefix.
+func (s *Server) adminCachePurge(w http.ResponseWriter, r *http.Request) {
+	host := chi.URLParam(r, "host")
+	c, ok := s.caches[host]
+	if !ok {
+		http.Error(w, fmt.Sprintf("host '%s' don't have cache", host), http.StatusNotFound)
+		return
+	}
+
+	count, err := c.purge(r.URL.Query().Get("path"))
+	if err != nil {
+		s.config.Logger.Error("cache purge error", "error", err, "host", host)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"purged":%d}`, count)
+}
@@ -0,0 +1,311 @@
+package http
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// cacheEntry is a cached response. Entries are never changed after stored, any update is done by
+// storing a new entry.
+type cacheEntry struct {
+	// Vary is set only at the index entries, they hold the request headers used to select the
+	// response variant.
+	Vary []string
+
+	Status     int
+	Header     http.Header
+	Body       []byte
+	Stored     time.Time
+	Expires    time.Time
+	StaleUntil time.Time
+}
+
+func (e *cacheEntry) size() int64 {
+	size := int64(len(e.Body))
+	for key, values := range e.Header {
+		size += int64(len(key))
+		for _, value := range values {
+			size += int64(len(value))
+		}
+	}
+	for _, vary := range e.Vary {
+		size += int64(len(vary))
+	}
+	return size
+}
+
+type cacheStore interface {
+	Get(key string) (*cacheEntry, bool)
+	Set(key string, entry *cacheEntry) error
+
+	// Delete remove all the entries with a key that match and return the amount of removed entries.
+	Delete(match func(key string) bool) (int, error)
+}
+
+type cacheLRUItem struct {
+	key   string
+	size  int64
+	entry *cacheEntry
+}
+
+// cacheLRU track the entries by usage and evict the least recently used when the size limit is
+// reached.
+type cacheLRU struct {
+	maxSize int64
+	size    int64
+	list    *list.List
+	items   map[string]*list.Element
+	onEvict func(key string)
+}
+
+func (c *cacheLRU) get(key string) (*cacheLRUItem, bool) {
+	element, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.list.MoveToFront(element)
+	return element.Value.(*cacheLRUItem), true
+}
+
+func (c *cacheLRU) set(item *cacheLRUItem) {
+	if element, ok := c.items[item.key]; ok {
+		c.size -= element.Value.(*cacheLRUItem).size
+		element.Value = item
+		c.list.MoveToFront(element)
+	} else {
+		c.items[item.key] = c.list.PushFront(item)
+	}
+	c.size += item.size
+
+	for (c.maxSize > 0) && (c.size > c.maxSize) && (c.list.Len() > 1) {
+		c.remove(c.list.Back())
+	}
+}
+
+func (c *cacheLRU) delete(match func(key string) bool) int {
+	var count int
+	for key, element := range c.items {
+		if match(key) {
+			c.remove(element)
+			count++
+		}
+	}
+	return count
+}
+
+func (c *cacheLRU) remove(element *list.Element) {
+	item := element.Value.(*cacheLRUItem)
+	c.list.Remove(element)
+	delete(c.items, item.key)
+	c.size -= item.size
+	if c.onEvict != nil {
+		c.onEvict(item.key)
+	}
+}
+
+func newCacheLRU(maxSize int64, onEvict func(key string)) *cacheLRU {
+	return &cacheLRU{
+		maxSize: maxSize,
+		list:    list.New(),
+		items:   make(map[string]*list.Element),
+		onEvict: onEvict,
+	}
+}
+
+// cacheMemoryStore keep the entries in memory.
+type cacheMemoryStore struct {
+	mutex sync.Mutex
+	lru   *cacheLRU
+}
+
+func (s *cacheMemoryStore) Get(key string) (*cacheEntry, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	item, ok := s.lru.get(key)
+	if !ok {
+		return nil, false
+	}
+	return item.entry, true
+}
+
+func (s *cacheMemoryStore) Set(key string, entry *cacheEntry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.lru.set(&cacheLRUItem{key: key, size: entry.size() + int64(len(key)), entry: entry})
+	return nil
+}
+
+func (s *cacheMemoryStore) Delete(match func(key string) bool) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lru.delete(match), nil
+}
+
+func newCacheMemoryStore(maxSize int64) *cacheMemoryStore {
+	return &cacheMemoryStore{lru: newCacheLRU(maxSize, nil)}
+}
+
+// cacheDiskFile is the content of each file at the disk store.
+type cacheDiskFile struct {
+	Key   string
+	Entry cacheEntry
+}
+
+// cacheDiskTempPrefix is the prefix of the files being written, they're renamed when complete.
+const cacheDiskTempPrefix = ".tmp-"
+
+// cacheDiskStore keep each entry at a file. Only the keys and sizes are kept in memory, they're
+// loaded from the directory during the initialization.
+type cacheDiskStore struct {
+	mutex sync.Mutex
+	path  string
+	lru   *cacheLRU
+}
+
+func (s *cacheDiskStore) Get(key string) (*cacheEntry, bool) {
+	s.mutex.Lock()
+	_, ok := s.lru.get(key)
+	s.mutex.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	file, err := s.read(s.filePath(key))
+	if (err != nil) || (file.Key != key) {
+		return nil, false
+	}
+	return &file.Entry, true
+}
+
+func (s *cacheDiskStore) Set(key string, entry *cacheEntry) error {
+	path := s.filePath(key)
+	tmp, err := ioutil.TempFile(s.path, cacheDiskTempPrefix)
+	if err != nil {
+		return errors.Wrap(err, "create temporary file error")
+	}
+	defer os.Remove(tmp.Name()) // nolint: errcheck
+
+	if err := gob.NewEncoder(tmp).Encode(cacheDiskFile{Key: key, Entry: *entry}); err != nil {
+		tmp.Close() // nolint: errcheck, gosec
+		return errors.Wrap(err, "encode error")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "close temporary file error")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return errors.Wrap(err, "rename file error")
+	}
+	s.lru.set(&cacheLRUItem{key: key, size: entry.size() + int64(len(key))})
+	return nil
+}
+
+func (s *cacheDiskStore) Delete(match func(key string) bool) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lru.delete(match), nil
+}
+
+// cacheDiskOwned report if the file was created by the store, the entries are named after the key
+// hash and the temporary files have a prefix.
+func cacheDiskOwned(name string) (entry, temporary bool) {
+	if strings.HasPrefix(name, cacheDiskTempPrefix) {
+		return false, true
+	}
+	if len(name) != hex.EncodedLen(sha256.Size) {
+		return false, false
+	}
+	for _, c := range name {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false, false
+		}
+	}
+	return true, false
+}
+
+func (s *cacheDiskStore) filePath(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(s.path, hex.EncodeToString(hash[:]))
+}
+
+func (*cacheDiskStore) read(path string) (*cacheDiskFile, error) {
+	f, err := os.Open(path) // nolint: gosec
+	if err != nil {
+		return nil, errors.Wrap(err, "open file error")
+	}
+	defer f.Close() // nolint: errcheck
+
+	var file cacheDiskFile
+	if err := gob.NewDecoder(f).Decode(&file); err != nil {
+		return nil, errors.Wrap(err, "decode error")
+	}
+	return &file, nil
+}
+
+// load the entries from the directory, the files are added to the LRU by modification time.
+func (s *cacheDiskStore) load() error {
+	if err := os.MkdirAll(s.path, 0750); err != nil {
+		return errors.Wrapf(err, "create directory '%s' error", s.path)
+	}
+
+	files, err := ioutil.ReadDir(s.path)
+	if err != nil {
+		return errors.Wrapf(err, "read directory '%s' error", s.path)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+
+	for _, info := range files {
+		path := filepath.Join(s.path, info.Name())
+		if info.IsDir() {
+			continue
+		}
+
+		// Only the files created by the store are touched, the directory may be shared by mistake.
+		entry, temporary := cacheDiskOwned(info.Name())
+		if temporary {
+			// The write was interrupted.
+			os.Remove(path) // nolint: errcheck, gosec
+			continue
+		}
+		if !entry {
+			continue
+		}
+
+		file, err := s.read(path)
+		if err != nil {
+			// Corrupted entries are removed, the cache can always be rebuilt.
+			os.Remove(path) // nolint: errcheck, gosec
+			continue
+		}
+		s.lru.set(&cacheLRUItem{key: file.Key, size: file.Entry.size() + int64(len(file.Key))})
+	}
+	return nil
+}
+
+func newCacheDiskStore(path string, maxSize int64) (*cacheDiskStore, error) {
+	s := &cacheDiskStore{path: path}
+	s.lru = newCacheLRU(maxSize, func(key string) {
+		os.Remove(s.filePath(key)) // nolint: errcheck, gosec
+	})
+	if err := s.load(); err != nil {
+		return nil, errors.Wrap(err, "load error")
+	}
+	return s, nil
+}
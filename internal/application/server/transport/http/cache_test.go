@@ -0,0 +1,432 @@
+package http
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+func TestCacheHandler(t *testing.T) {
+	t.Parallel()
+
+	type step struct {
+		elapsed time.Duration
+		header  http.Header
+		status  string
+		body    string
+	}
+
+	tests := []struct {
+		name     string
+		upstream func(w http.ResponseWriter, r *http.Request)
+		steps    []step
+	}{
+		{
+			"fresh response",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Cache-Control", "max-age=10")
+				w.Write([]byte("v1")) // nolint: errcheck
+			},
+			[]step{
+				{0, nil, cacheStatusMiss, "v1"},
+				{5 * time.Second, nil, cacheStatusHit, "v1"},
+				{11 * time.Second, nil, cacheStatusMiss, "v1"},
+			},
+		},
+		{
+			"not cacheable",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Cache-Control", "private, max-age=10")
+				w.Write([]byte("v1")) // nolint: errcheck
+			},
+			[]step{
+				{0, nil, cacheStatusMiss, "v1"},
+				{time.Second, nil, cacheStatusMiss, "v1"},
+			},
+		},
+		{
+			"revalidation",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Cache-Control", "max-age=1")
+				w.Header().Set("ETag", `"v1"`)
+				if r.Header.Get("If-None-Match") == `"v1"` {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				w.Write([]byte("v1")) // nolint: errcheck
+			},
+			[]step{
+				{0, nil, cacheStatusMiss, "v1"},
+				{2 * time.Second, nil, cacheStatusRevalidated, "v1"},
+				{2 * time.Second, nil, cacheStatusHit, "v1"},
+			},
+		},
+		{
+			"vary",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Cache-Control", "max-age=10")
+				w.Header().Set("Vary", "Accept-Language")
+				w.Write([]byte(r.Header.Get("Accept-Language"))) // nolint: errcheck
+			},
+			[]step{
+				{0, http.Header{"Accept-Language": {"en"}}, cacheStatusMiss, "en"},
+				{0, http.Header{"Accept-Language": {"pt"}}, cacheStatusMiss, "pt"},
+				{0, http.Header{"Accept-Language": {"en"}}, cacheStatusHit, "en"},
+			},
+		},
+		{
+			"request without cache",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Cache-Control", "max-age=10")
+				w.Write([]byte("v1")) // nolint: errcheck
+			},
+			[]step{
+				{0, http.Header{"Cache-Control": {"no-store"}}, cacheStatusBypass, "v1"},
+				{0, nil, cacheStatusMiss, "v1"},
+				{0, http.Header{"Cache-Control": {"no-cache"}}, cacheStatusMiss, "v1"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				start = time.Unix(1000, 0)
+				c     = &cache{
+					store:        newCacheMemoryStore(0),
+					maxEntrySize: 1024,
+					statusHeader: "X-Cache",
+				}
+			)
+			handler := c.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tt.upstream(w, r)
+			}))
+
+			for i, s := range tt.steps {
+				c.now = func() time.Time { return start.Add(s.elapsed) }
+				req := httptest.NewRequest(http.MethodGet, "http://example.com/path", nil)
+				for key, values := range s.header {
+					req.Header[key] = values
+				}
+
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+				require.Equalf(t, s.status, rec.Header().Get("X-Cache"), "step %d", i)
+				require.Equalf(t, s.body, rec.Body.String(), "step %d", i)
+			}
+		})
+	}
+}
+
+func TestCacheConditionalRequest(t *testing.T) {
+	t.Parallel()
+
+	lastModified := time.Unix(1000, 0).UTC()
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		{"etag match", http.Header{"If-None-Match": {`"v1"`}}, http.StatusNotModified},
+		{"etag mismatch", http.Header{"If-None-Match": {`"v0"`}}, http.StatusOK},
+		{
+			"not modified since",
+			http.Header{"If-Modified-Since": {lastModified.Format(http.TimeFormat)}},
+			http.StatusNotModified,
+		},
+		{
+			"modified since",
+			http.Header{"If-Modified-Since": {lastModified.Add(-time.Second).Format(http.TimeFormat)}},
+			http.StatusOK,
+		},
+		{"invalid date", http.Header{"If-Modified-Since": {"yesterday"}}, http.StatusOK},
+		{
+			"etag has precedence",
+			http.Header{
+				"If-None-Match":     {`"v0"`},
+				"If-Modified-Since": {lastModified.Add(time.Hour).Format(http.TimeFormat)},
+			},
+			http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := &cache{store: newCacheMemoryStore(0), maxEntrySize: 1024, statusHeader: "X-Cache", now: time.Now}
+			handler := c.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Cache-Control", "max-age=10")
+				w.Header().Set("ETag", `"v1"`)
+				w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+				w.Write([]byte("v1")) // nolint: errcheck
+			}))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com/path", nil))
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/path", nil)
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			require.Equal(t, cacheStatusHit, rec.Header().Get("X-Cache"))
+			require.Equal(t, tt.status, rec.Code)
+		})
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	t.Parallel()
+
+	var (
+		version int32
+		start   = time.Unix(1000, 0)
+		elapsed atomic.Value
+		c       = &cache{store: newCacheMemoryStore(0), maxEntrySize: 1024, statusHeader: "X-Cache"}
+	)
+	elapsed.Store(time.Duration(0))
+	c.now = func() time.Time { return start.Add(elapsed.Load().(time.Duration)) }
+
+	handler := c.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=1, stale-while-revalidate=10")
+		w.Write([]byte{'v', byte('0' + atomic.AddInt32(&version, 1))}) // nolint: errcheck
+	}))
+	serve := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/path", nil)
+		req.Host = "example.com"
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve()
+	require.Equal(t, cacheStatusMiss, rec.Header().Get("X-Cache"))
+	require.Equal(t, "v1", rec.Body.String())
+
+	// The stale response is served right away and the entry is refreshed at the background.
+	elapsed.Store(2 * time.Second)
+	rec = serve()
+	require.Equal(t, cacheStatusStale, rec.Header().Get("X-Cache"))
+	require.Equal(t, "v1", rec.Body.String())
+	require.Eventually(t, func() bool {
+		_, running := c.revalidating.Load("example.com|/path")
+		return !running && (atomic.LoadInt32(&version) == 2)
+	}, time.Second, time.Millisecond)
+
+	rec = serve()
+	require.Equal(t, cacheStatusHit, rec.Header().Get("X-Cache"))
+	require.Equal(t, "v2", rec.Body.String())
+
+	// After the stale window, the request wait for the upstream.
+	elapsed.Store(20 * time.Second)
+	rec = serve()
+	require.Equal(t, cacheStatusMiss, rec.Header().Get("X-Cache"))
+	require.Equal(t, "v3", rec.Body.String())
+}
+
+func TestCacheDiskStore(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "pipehub-cache-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	entry := func(body string) *cacheEntry {
+		return &cacheEntry{
+			Status: http.StatusOK,
+			Header: http.Header{"Content-Type": {"text/plain"}},
+			Body:   []byte(body),
+			Stored: time.Unix(1000, 0).UTC(),
+		}
+	}
+
+	store, err := newCacheDiskStore(dir, 0)
+	require.NoError(t, err)
+	require.NoError(t, store.Set("example.com|/a", entry("a")))
+	require.NoError(t, store.Set("example.com|/b", entry("b")))
+
+	value, ok := store.Get("example.com|/a")
+	require.True(t, ok)
+	require.Equal(t, entry("a"), value)
+	_, ok = store.Get("example.com|/c")
+	require.False(t, ok)
+
+	// The entries survive a restart.
+	store, err = newCacheDiskStore(dir, 0)
+	require.NoError(t, err)
+	value, ok = store.Get("example.com|/b")
+	require.True(t, ok)
+	require.Equal(t, entry("b"), value)
+
+	count, err := store.Delete(func(key string) bool { return key == "example.com|/a" })
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	_, ok = store.Get("example.com|/a")
+	require.False(t, ok)
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	// The least recently used entries are evicted, and their files removed, when the size is exceeded.
+	size := entry("b").size() + int64(len("example.com|/b"))
+	store, err = newCacheDiskStore(dir, size)
+	require.NoError(t, err)
+	require.NoError(t, store.Set("example.com|/c", entry("c")))
+	_, ok = store.Get("example.com|/b")
+	require.False(t, ok)
+	_, ok = store.Get("example.com|/c")
+	require.True(t, ok)
+
+	files, err = ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	// The files not created by the store are kept, the corrupted entries and the incomplete writes are
+	// removed.
+	unknown := filepath.Join(dir, "notes.txt")
+	corrupted := filepath.Join(dir, strings.Repeat("0", 64))
+	incomplete := filepath.Join(dir, cacheDiskTempPrefix+"1")
+	for _, path := range []string{unknown, corrupted, incomplete} {
+		require.NoError(t, ioutil.WriteFile(path, []byte("data"), 0600))
+	}
+	_, err = newCacheDiskStore(dir, 0)
+	require.NoError(t, err)
+	_, err = os.Stat(unknown)
+	require.NoError(t, err)
+	_, err = os.Stat(corrupted)
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(incomplete)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestServerAdminCachePurge(t *testing.T) {
+	t.Parallel()
+
+	c := &cache{store: newCacheMemoryStore(0), maxEntrySize: 1024, statusHeader: "X-Cache", now: time.Now}
+	handler := c.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=10")
+		w.Write([]byte(r.URL.Path)) // nolint: errcheck
+	}))
+	for _, path := range []string{"/a/1", "/a/2", "/b"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Host = "example.com"
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	s := &Server{caches: map[string]*cache{"example.com": c}}
+	s.initAdmin()
+	purge := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.adminMux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, target, nil))
+		return rec
+	}
+
+	// Each response has the index and the variant entries.
+	rec := purge("/cache/example.com?path=/a")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"purged":4}`, rec.Body.String())
+
+	rec = purge("/cache/example.com")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"purged":2}`, rec.Body.String())
+
+	require.Equal(t, http.StatusNotFound, purge("/cache/example.org").Code)
+}
+
+func TestCacheCORS(t *testing.T) {
+	t.Parallel()
+
+	cors, err := newCORS(internal.HostCORS{Origins: []string{"https://example.com"}})
+	require.NoError(t, err)
+
+	c := &cache{store: newCacheMemoryStore(0), maxEntrySize: 1024, statusHeader: "X-Cache", now: time.Now}
+	handler := cors.middleware(c.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=10")
+		w.Header().Add("Vary", "Accept-Language")
+		w.Write([]byte(r.Header.Get("Accept-Language"))) // nolint: errcheck
+	})))
+
+	steps := []struct {
+		language string
+		status   string
+	}{
+		{"en", cacheStatusMiss},
+		{"pt", cacheStatusMiss},
+		{"en", cacheStatusHit},
+		{"pt", cacheStatusHit},
+	}
+	for i, s := range steps {
+		req := httptest.NewRequest(http.MethodGet, "/path", nil)
+		req.Host = "example.com"
+		req.Header.Set("Origin", "https://example.com")
+		req.Header.Set("Accept-Language", s.language)
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		require.Equalf(t, s.status, rec.Header().Get("X-Cache"), "step %d", i)
+		require.Equalf(t, s.language, rec.Body.String(), "step %d", i)
+		require.Equalf(t, []string{"Origin", "Accept-Language"}, rec.Header()["Vary"], "step %d", i)
+	}
+}
+
+func TestCacheCompression(t *testing.T) {
+	t.Parallel()
+
+	compression, err := newCompression(internal.HostCompression{Algorithms: []string{compressionGzip}, MinSize: 1})
+	require.NoError(t, err)
+
+	c := &cache{store: newCacheMemoryStore(0), maxEntrySize: 1024, statusHeader: "X-Cache", now: time.Now}
+	handler := compression.middleware(c.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=10")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("plain body")) // nolint: errcheck
+	})))
+
+	steps := []struct {
+		acceptEncoding  string
+		status          string
+		contentEncoding string
+	}{
+		{"gzip", cacheStatusMiss, "gzip"},
+		{"", cacheStatusHit, ""},
+		{"gzip", cacheStatusHit, "gzip"},
+	}
+	for i, s := range steps {
+		req := httptest.NewRequest(http.MethodGet, "/path", nil)
+		req.Host = "example.com"
+		if s.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", s.acceptEncoding)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		require.Equalf(t, s.status, rec.Header().Get("X-Cache"), "step %d", i)
+		require.Equalf(t, s.contentEncoding, rec.Header().Get("Content-Encoding"), "step %d", i)
+
+		body := rec.Body.Bytes()
+		if s.contentEncoding == compressionGzip {
+			reader, err := gzip.NewReader(rec.Body)
+			require.NoError(t, err)
+			body, err = ioutil.ReadAll(reader)
+			require.NoError(t, err)
+		}
+		require.Equalf(t, "plain body", string(body), "step %d", i)
+	}
+}
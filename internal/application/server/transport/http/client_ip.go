@@ -0,0 +1,98 @@
+package http
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// clientIP return the IP address of the client. The address resolved from the trusted proxies is
+// used when available.
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(contextKeyClientIP).(string); ok {
+		return ip
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// trustedProxies resolve the real client IP from the 'X-Forwarded-For' header. The header is read
+// from right to left and the first address that is not a trusted proxy is the client. The header
+// is ignored if the request don't come from a trusted proxy, otherwise any client could forge it.
+type trustedProxies struct {
+	networks []*net.IPNet
+}
+
+func (tp trustedProxies) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+		if tp.trusted(ip) {
+			addresses := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+			for i := len(addresses) - 1; i >= 0; i-- {
+				address := strings.TrimSpace(addresses[i])
+				if net.ParseIP(address) == nil {
+					break
+				}
+				ip = address
+				if !tp.trusted(address) {
+					break
+				}
+			}
+		}
+
+		ctx := contextWithValue(r.Context(), contextKeyClientIP, ip)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (tp trustedProxies) trusted(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range tp.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCIDR parse a network in the CIDR notation, a single address is also accepted.
+func parseCIDR(value string) (*net.IPNet, error) {
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid address '%s'", value)
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, network, err := net.ParseCIDR(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid network '%s'", value)
+	}
+	return network, nil
+}
+
+func newTrustedProxies(networks []string) (*trustedProxies, error) {
+	var tp trustedProxies
+	for _, value := range networks {
+		network, err := parseCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+		tp.networks = append(tp.networks, network)
+	}
+	return &tp, nil
+}
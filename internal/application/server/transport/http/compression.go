@@ -0,0 +1,327 @@
+package http
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/pkg/errors"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+// Encodings supported by the compression.
+const (
+	compressionBrotli  = "br"
+	compressionGzip    = "gzip"
+	compressionDeflate = "deflate"
+)
+
+// compressionDefaultMinSize is the size, in bytes, below which the responses are not compressed.
+const compressionDefaultMinSize = 1024
+
+// nolint: gochecknoglobals
+var (
+	compressionDefaultAlgorithms = []string{compressionBrotli, compressionGzip, compressionDeflate}
+	compressionDefaultTypes      = []string{
+		"text/*",
+		"application/javascript",
+		"application/json",
+		"application/xml",
+		"image/svg+xml",
+	}
+)
+
+type compressionEncoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// compression negotiate the response encoding with the client and compress the response body. It's
+// executed before the pipes, so they read and write uncompressed bodies.
+type compression struct {
+	algorithms       []string
+	types            []string
+	minSize          int
+	identityUpstream bool
+	pools            map[string]*sync.Pool
+}
+
+func (c *compression) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := c.negotiate(r.Header.Get("Accept-Encoding"))
+		// The upstream responses are decompressed by the transport, this way the pipes always see the
+		// plain body.
+		if c.identityUpstream {
+			r.Header.Del("Accept-Encoding")
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if (encoding == "") || (r.Method == http.MethodHead) || (r.Header.Get("Upgrade") != "") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressionWriter{ResponseWriter: w, compression: c, encoding: encoding}
+		defer cw.Close() // nolint: errcheck
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiate choose the encoding with the highest quality at the 'Accept-Encoding' header. On a tie,
+// the algorithms order is used.
+func (c *compression) negotiate(header string) string {
+	if header == "" {
+		return ""
+	}
+
+	quality := make(map[string]float64)
+	for _, entry := range strings.Split(header, ",") {
+		fragments := strings.Split(strings.TrimSpace(entry), ";")
+		name := strings.ToLower(strings.TrimSpace(fragments[0]))
+		q := 1.0
+		for _, param := range fragments[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				value, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+				if err == nil {
+					q = value
+				}
+			}
+		}
+		quality[name] = q
+	}
+
+	var (
+		selected string
+		best     float64
+	)
+	for _, algorithm := range c.algorithms {
+		q, ok := quality[algorithm]
+		if !ok {
+			q, ok = quality["*"]
+		}
+		if ok && (q > best) {
+			selected, best = algorithm, q
+		}
+	}
+	return selected
+}
+
+// compressible check if the content type is at the allowed list.
+func (c *compression) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, t := range c.types {
+		if t == mediaType {
+			return true
+		}
+		if strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(t, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *compression) encoder(encoding string, w io.Writer) compressionEncoder {
+	encoder := c.pools[encoding].Get().(compressionEncoder)
+	encoder.Reset(w)
+	return encoder
+}
+
+// compressionWriter buffer the beginning of the response until it know if the response should be
+// compressed. The decision is based on the status, headers and size.
+type compressionWriter struct {
+	http.ResponseWriter
+	compression *compression
+	encoding    string
+	status      int
+	decided     bool
+	buf         []byte
+	encoder     compressionEncoder
+}
+
+func (cw *compressionWriter) WriteHeader(status int) {
+	if cw.status != 0 {
+		return
+	}
+	if status < http.StatusOK {
+		// Informational responses are sent right away and are followed by the final one.
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	cw.status = status
+
+	header := cw.Header()
+	switch {
+	case (status == http.StatusNoContent) || (status == http.StatusNotModified):
+	// The range describe the uncompressed bytes.
+	case (status == http.StatusPartialContent) || (header.Get("Content-Range") != ""):
+	case header.Get("Content-Encoding") != "":
+	case (header.Get("Content-Type") != "") && !cw.compression.compressible(header.Get("Content-Type")):
+	case cw.contentLength() >= 0 && cw.contentLength() < int64(cw.compression.minSize):
+	default:
+		return
+	}
+	cw.decide(false)
+}
+
+func (cw *compressionWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < cw.compression.minSize {
+			return len(p), nil
+		}
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if cw.encoder != nil {
+		return cw.encoder.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+func (cw *compressionWriter) Flush() {
+	if !cw.decided {
+		cw.decide(len(cw.buf) >= cw.compression.minSize) // nolint: errcheck
+	}
+	if cw.encoder != nil {
+		cw.encoder.Flush() // nolint: errcheck
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressionWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the response writer does not support hijack")
+	}
+	return h.Hijack()
+}
+
+// Close write the buffered content, if any, and release the encoder.
+func (cw *compressionWriter) Close() error {
+	if cw.status == 0 {
+		return nil
+	}
+
+	if !cw.decided {
+		if err := cw.decide(len(cw.buf) >= cw.compression.minSize); err != nil {
+			return err
+		}
+	}
+
+	if cw.encoder == nil {
+		return nil
+	}
+	err := cw.encoder.Close()
+	cw.compression.pools[cw.encoding].Put(cw.encoder)
+	cw.encoder = nil
+	return err
+}
+
+// decide write the headers and the buffered content. The content type is sniffed if it's missing,
+// just like the net/http server does.
+func (cw *compressionWriter) decide(compress bool) error {
+	cw.decided = true
+	header := cw.Header()
+	if compress && (header.Get("Content-Type") == "") {
+		header.Set("Content-Type", http.DetectContentType(cw.buf))
+		compress = cw.compression.compressible(header.Get("Content-Type"))
+	}
+
+	if compress {
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", cw.encoding)
+		// The compressed body is not byte equal to the original, so a strong validator is weakened.
+		if etag := header.Get("ETag"); (etag != "") && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		cw.encoder = cw.compression.encoder(cw.encoding, cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if len(cw.buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if cw.encoder != nil {
+		_, err = cw.encoder.Write(cw.buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf)
+	}
+	cw.buf = nil
+	return err
+}
+
+func (cw *compressionWriter) contentLength() int64 {
+	value, err := strconv.ParseInt(cw.Header().Get("Content-Length"), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return value
+}
+
+func newCompression(config internal.HostCompression) (*compression, error) {
+	c := &compression{
+		algorithms:       config.Algorithms,
+		types:            config.Types,
+		minSize:          config.MinSize,
+		identityUpstream: config.IdentityUpstream,
+		pools:            make(map[string]*sync.Pool),
+	}
+	if len(c.algorithms) == 0 {
+		c.algorithms = compressionDefaultAlgorithms
+	}
+	if len(c.types) == 0 {
+		c.types = compressionDefaultTypes
+	}
+	if c.minSize == 0 {
+		c.minSize = compressionDefaultMinSize
+	}
+
+	for _, algorithm := range c.algorithms {
+		switch algorithm {
+		case compressionBrotli:
+			c.pools[algorithm] = &sync.Pool{New: func() interface{} {
+				return brotli.NewWriter(nil)
+			}}
+		case compressionGzip:
+			c.pools[algorithm] = &sync.Pool{New: func() interface{} {
+				return gzip.NewWriter(nil)
+			}}
+		case compressionDeflate:
+			c.pools[algorithm] = &sync.Pool{New: func() interface{} {
+				w, _ := flate.NewWriter(nil, flate.DefaultCompression) // nolint: errcheck
+				return w
+			}}
+		default:
+			return nil, fmt.Errorf("invalid algorithm '%s'", algorithm)
+		}
+	}
+
+	return c, nil
+}
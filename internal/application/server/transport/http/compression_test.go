@@ -0,0 +1,176 @@
+package http
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+func TestCompressionNegotiate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		algorithms []string
+		header     string
+		expected   string
+	}{
+		{"empty header", nil, "", ""},
+		{"server preference", nil, "gzip, deflate, br", compressionBrotli},
+		{"client quality", nil, "gzip;q=1.0, br;q=0.5", compressionGzip},
+		{"excluded", nil, "br;q=0, gzip;q=0", ""},
+		{"wildcard", nil, "*", compressionBrotli},
+		{"wildcard with exclusion", nil, "br;q=0, *", compressionGzip},
+		{"configured algorithms", []string{compressionDeflate}, "gzip, deflate", compressionDeflate},
+		{"unknown encoding", nil, "compress", ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c, err := newCompression(internal.HostCompression{Algorithms: tt.algorithms})
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, c.negotiate(tt.header))
+		})
+	}
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	t.Parallel()
+
+	var (
+		large = strings.Repeat("pipehub ", 512)
+		small = "pipehub"
+	)
+
+	tests := []struct {
+		name     string
+		handler  func(w http.ResponseWriter, r *http.Request)
+		encoding string
+		etag     string
+		body     string
+	}{
+		{
+			"large text",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				w.Header().Set("ETag", `"v1"`)
+				w.Write([]byte(large)) // nolint: errcheck
+			},
+			compressionGzip,
+			`W/"v1"`,
+			large,
+		},
+		{
+			"weak etag",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				w.Header().Set("ETag", `W/"v1"`)
+				w.Write([]byte(large)) // nolint: errcheck
+			},
+			compressionGzip,
+			`W/"v1"`,
+			large,
+		},
+		{
+			"partial content",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(large)-1, len(large)*2))
+				w.Header().Set("ETag", `"v1"`)
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write([]byte(large)) // nolint: errcheck
+			},
+			"",
+			`"v1"`,
+			large,
+		},
+		{
+			"content range",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", len(large)))
+				w.Write([]byte(large)) // nolint: errcheck
+			},
+			"",
+			"",
+			large,
+		},
+		{
+			"sniffed content type",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(large)) // nolint: errcheck
+			},
+			compressionGzip,
+			"",
+			large,
+		},
+		{
+			"small body",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Write([]byte(small)) // nolint: errcheck
+			},
+			"",
+			"",
+			small,
+		},
+		{
+			"not allowed type",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				w.Write([]byte(large)) // nolint: errcheck
+			},
+			"",
+			"",
+			large,
+		},
+		{
+			"already encoded",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Set("Content-Encoding", "identity")
+				w.Write([]byte(large)) // nolint: errcheck
+			},
+			"identity",
+			"",
+			large,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c, err := newCompression(internal.HostCompression{Algorithms: []string{compressionGzip}})
+			require.NoError(t, err)
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Encoding", "gzip")
+			w := httptest.NewRecorder()
+			c.middleware(http.HandlerFunc(tt.handler)).ServeHTTP(w, r)
+
+			require.Equal(t, tt.encoding, w.Header().Get("Content-Encoding"))
+			require.Equal(t, tt.etag, w.Header().Get("ETag"))
+			require.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+
+			body := w.Body.Bytes()
+			if tt.encoding == compressionGzip {
+				reader, err := gzip.NewReader(w.Body)
+				require.NoError(t, err)
+				body, err = ioutil.ReadAll(reader)
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.body, string(body))
+		})
+	}
+}
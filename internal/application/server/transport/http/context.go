@@ -0,0 +1,29 @@
+package http
+
+import "context"
+
+// Keys of the values PipeHub store at the request context. Pipes can't import PipeHub packages, so
+// the keys are plain strings, this is the only way a pipe can read the values:
+//
+//	id, _ := r.Context().Value("pipehub.request-id").(string)
+const (
+	contextKeyRequestID   = "pipehub.request-id"
+	contextKeyClientIP    = "pipehub.client-ip"
+	contextKeyAuthMethod  = "pipehub.auth.method"
+	contextKeyAuthSubject = "pipehub.auth.subject"
+	contextKeyAuthClaims  = "pipehub.auth.claims"
+
+	contextKeyTLSClientCertificate = "pipehub.tls.client-certificate"
+	contextKeyTLSClientSubject     = "pipehub.tls.client-subject"
+)
+
+// requestIDFromContext return the request ID, it's empty if the request ID is disabled.
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKeyRequestID).(string) // nolint: errcheck
+	return id
+}
+
+// contextWithValue store a value at the context using a key that can be built by the pipes.
+func contextWithValue(ctx context.Context, key string, value interface{}) context.Context {
+	return context.WithValue(ctx, key, value) // nolint: golint, staticcheck
+}
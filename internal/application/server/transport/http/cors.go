@@ -0,0 +1,236 @@
+package http
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+// corsDefaultMethods are the methods allowed if none is configured, they're the CORS safelisted
+// methods.
+var corsDefaultMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost} // nolint: gochecknoglobals
+
+// cors answer the preflight requests before the pipes and add the CORS headers to the responses.
+type cors struct {
+	origins        []string
+	methods        []string
+	headers        []string
+	anyHeader      bool
+	exposedHeaders string
+	credentials    bool
+	maxAge         string
+}
+
+func (c cors) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+
+		preflight := (r.Method == http.MethodOptions) && (r.Header.Get("Access-Control-Request-Method") != "")
+		if preflight {
+			c.preflight(w, r, origin)
+			return
+		}
+
+		if !c.allowedOrigin(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&corsWriter{ResponseWriter: w, cors: c, origin: origin}, r)
+	})
+}
+
+// preflight answer the request without calling the pipes. When the request is not allowed, the CORS
+// headers are not sent and the browser block the actual request.
+func (c cors) preflight(w http.ResponseWriter, r *http.Request, origin string) {
+	header := w.Header()
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+
+	method := r.Header.Get("Access-Control-Request-Method")
+	requestHeaders := strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",")
+	if !c.allowedOrigin(origin) || !c.allowedMethod(method) || !c.allowedHeaders(requestHeaders) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	c.setOrigin(header, origin)
+	header.Set("Access-Control-Allow-Methods", method)
+	if value := strings.TrimSpace(r.Header.Get("Access-Control-Request-Headers")); value != "" {
+		header.Set("Access-Control-Allow-Headers", value)
+	}
+	if c.maxAge != "" {
+		header.Set("Access-Control-Max-Age", c.maxAge)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setOrigin set the headers shared by the preflight and the actual responses.
+func (c cors) setOrigin(header http.Header, origin string) {
+	if (len(c.origins) == 1) && (c.origins[0] == "*") && !c.credentials {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+
+	if c.credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c cors) allowedOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, pattern := range c.origins {
+		if corsMatch(pattern, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c cors) allowedMethod(method string) bool {
+	for _, m := range c.methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (c cors) allowedHeaders(headers []string) bool {
+	if c.anyHeader {
+		return true
+	}
+
+	for _, header := range headers {
+		header = http.CanonicalHeaderKey(strings.TrimSpace(header))
+		if header == "" {
+			continue
+		}
+
+		var found bool
+		for _, h := range c.headers {
+			if h == header {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// corsMatch check the origin against a pattern where '*' match any sequence of characters.
+func corsMatch(pattern, origin string) bool {
+	fragments := strings.Split(pattern, "*")
+	if len(fragments) == 1 {
+		return pattern == origin
+	}
+
+	if !strings.HasPrefix(origin, fragments[0]) {
+		return false
+	}
+	origin = origin[len(fragments[0]):]
+
+	last := fragments[len(fragments)-1]
+	for _, fragment := range fragments[1 : len(fragments)-1] {
+		index := strings.Index(origin, fragment)
+		if index < 0 {
+			return false
+		}
+		origin = origin[index+len(fragment):]
+	}
+	return (len(origin) >= len(last)) && strings.HasSuffix(origin, last)
+}
+
+// corsWriter set the CORS headers right before the response is written. This way the headers set by
+// the pipes or the upstream are replaced instead of duplicated.
+type corsWriter struct {
+	http.ResponseWriter
+	cors        cors
+	origin      string
+	wroteHeader bool
+}
+
+func (cw *corsWriter) WriteHeader(status int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+		header := cw.Header()
+		cw.cors.setOrigin(header, cw.origin)
+		if cw.cors.exposedHeaders != "" {
+			header.Set("Access-Control-Expose-Headers", cw.cors.exposedHeaders)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *corsWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+func (cw *corsWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *corsWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the response writer does not support hijack")
+	}
+	return h.Hijack()
+}
+
+func newCORS(config internal.HostCORS) (cors, error) {
+	if len(config.Origins) == 0 {
+		return cors{}, errors.New("at least one origin is required")
+	}
+
+	c := cors{
+		methods:        config.Methods,
+		exposedHeaders: strings.Join(config.ExposedHeaders, ", "),
+		credentials:    config.Credentials,
+	}
+	for _, origin := range config.Origins {
+		// The browsers reject a credentialed response with any origin, the origin would need to be
+		// reflected, and this would allow any site to read the responses with the user credentials.
+		if (origin == "*") && config.Credentials {
+			return cors{}, errors.New("the origin '*' can't be used with credentials")
+		}
+		c.origins = append(c.origins, strings.ToLower(origin))
+	}
+	if len(c.methods) == 0 {
+		c.methods = corsDefaultMethods
+	}
+	for _, header := range config.Headers {
+		if header == "*" {
+			c.anyHeader = true
+			continue
+		}
+		c.headers = append(c.headers, http.CanonicalHeaderKey(header))
+	}
+	if config.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(int(config.MaxAge.Seconds()))
+	}
+
+	return c, nil
+}
@@ -0,0 +1,222 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	t.Parallel()
+
+	c, err := newCORS(internal.HostCORS{
+		Origins:        []string{"https://example.com", "https://*.example.org"},
+		Methods:        []string{http.MethodGet, http.MethodPut},
+		Headers:        []string{"content-type"},
+		ExposedHeaders: []string{"X-Request-ID"},
+		Credentials:    true,
+		MaxAge:         time.Minute,
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		method   string
+		header   http.Header
+		status   int
+		expected http.Header
+		next     bool
+	}{
+		{
+			"without origin",
+			http.MethodGet,
+			http.Header{},
+			http.StatusOK,
+			http.Header{"Access-Control-Allow-Origin": nil},
+			true,
+		},
+		{
+			"actual request",
+			http.MethodGet,
+			http.Header{"Origin": {"https://example.com"}},
+			http.StatusOK,
+			http.Header{
+				"Access-Control-Allow-Origin":      {"https://example.com"},
+				"Access-Control-Allow-Credentials": {"true"},
+				"Access-Control-Expose-Headers":    {"X-Request-ID"},
+			},
+			true,
+		},
+		{
+			"actual request with wildcard origin",
+			http.MethodGet,
+			http.Header{"Origin": {"https://api.example.org"}},
+			http.StatusOK,
+			http.Header{"Access-Control-Allow-Origin": {"https://api.example.org"}},
+			true,
+		},
+		{
+			"actual request with invalid origin",
+			http.MethodGet,
+			http.Header{"Origin": {"https://example.net"}},
+			http.StatusOK,
+			http.Header{"Access-Control-Allow-Origin": nil},
+			true,
+		},
+		{
+			"preflight",
+			http.MethodOptions,
+			http.Header{
+				"Origin":                         {"https://example.com"},
+				"Access-Control-Request-Method":  {http.MethodPut},
+				"Access-Control-Request-Headers": {"Content-Type"},
+			},
+			http.StatusNoContent,
+			http.Header{
+				"Access-Control-Allow-Origin":  {"https://example.com"},
+				"Access-Control-Allow-Methods": {http.MethodPut},
+				"Access-Control-Allow-Headers": {"Content-Type"},
+				"Access-Control-Max-Age":       {"60"},
+			},
+			false,
+		},
+		{
+			"preflight with invalid method",
+			http.MethodOptions,
+			http.Header{
+				"Origin":                        {"https://example.com"},
+				"Access-Control-Request-Method": {http.MethodDelete},
+			},
+			http.StatusNoContent,
+			http.Header{"Access-Control-Allow-Origin": nil},
+			false,
+		},
+		{
+			"preflight with invalid header",
+			http.MethodOptions,
+			http.Header{
+				"Origin":                         {"https://example.com"},
+				"Access-Control-Request-Method":  {http.MethodGet},
+				"Access-Control-Request-Headers": {"X-Custom"},
+			},
+			http.StatusNoContent,
+			http.Header{"Access-Control-Allow-Origin": nil},
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var next bool
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next = true
+				w.Header().Add("Access-Control-Allow-Origin", "upstream")
+				w.Write([]byte("ok")) // nolint: errcheck
+			})
+
+			r := httptest.NewRequest(tt.method, "/", nil)
+			r.Header = tt.header
+			w := httptest.NewRecorder()
+			c.middleware(handler).ServeHTTP(w, r)
+
+			require.Equal(t, tt.status, w.Code)
+			require.Equal(t, tt.next, next)
+			for key, value := range tt.expected {
+				if (value == nil) && next {
+					require.Equal(t, []string{"upstream"}, w.Header()[key])
+					continue
+				}
+				require.Equal(t, value, w.Header()[key])
+			}
+		})
+	}
+}
+
+func TestCORSMatch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		pattern  string
+		origin   string
+		expected bool
+	}{
+		{"*", "https://example.com", true},
+		{"https://example.com", "https://example.com", true},
+		{"https://example.com", "https://example.org", false},
+		{"https://*.example.com", "https://api.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://api.example.com.evil.org", false},
+		{"https://*.example.*", "https://api.example.org", true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.pattern+" "+tt.origin, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.expected, corsMatch(tt.pattern, tt.origin))
+		})
+	}
+}
+
+func TestNewCORS(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		config    internal.HostCORS
+		shouldErr bool
+	}{
+		{"valid", internal.HostCORS{Origins: []string{"https://example.com"}, Credentials: true}, false},
+		{"any origin", internal.HostCORS{Origins: []string{"*"}}, false},
+		{"without origins", internal.HostCORS{}, true},
+		{"any origin with credentials", internal.HostCORS{Origins: []string{"*"}, Credentials: true}, true},
+		{
+			"any origin between others with credentials",
+			internal.HostCORS{Origins: []string{"https://example.com", "*"}, Credentials: true},
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := newCORS(tt.config)
+			require.Equal(t, tt.shouldErr, err != nil)
+		})
+	}
+}
+
+func TestCORSWriterFlush(t *testing.T) {
+	t.Parallel()
+
+	c, err := newCORS(internal.HostCORS{
+		Origins:        []string{"https://example.com"},
+		ExposedHeaders: []string{"X-Request-ID"},
+	})
+	require.NoError(t, err)
+
+	handler := c.middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.(http.Flusher).Flush()
+		w.Write([]byte("stream")) // nolint: errcheck
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Origin", "https://example.com")
+	handler.ServeHTTP(w, r)
+
+	require.True(t, w.Flushed)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "stream", w.Body.String())
+	require.Equal(t, "https://example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	require.Equal(t, "X-Request-ID", w.Header().Get("Access-Control-Expose-Headers"))
+}
@@ -0,0 +1,168 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+type maintenancePage struct {
+	body        []byte
+	contentType string
+	status      int
+	retryAfter  string
+}
+
+// maintenance answer the requests of the hosts in maintenance mode. The mode is toggled at the admin
+// API and it's kept only in memory, a restart go back to the configured state.
+type maintenance struct {
+	mutex   sync.RWMutex
+	enabled map[string]bool
+	pages   map[string]maintenancePage
+}
+
+func (m *maintenance) middleware(host string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			m.mutex.RLock()
+			enabled := m.enabled[host]
+			m.mutex.RUnlock()
+			if !enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			page := m.pages[host]
+			w.Header().Set("Content-Type", page.contentType)
+			w.Header().Set("Cache-Control", "no-store")
+			if page.retryAfter != "" {
+				w.Header().Set("Retry-After", page.retryAfter)
+			}
+			w.WriteHeader(page.status)
+			if r.Method != http.MethodHead {
+				w.Write(page.body) // nolint: errcheck
+			}
+		})
+	}
+}
+
+// set change the maintenance mode of a host, it return false if the host don't exist.
+func (m *maintenance) set(host string, enabled bool) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.pages[host]; !ok {
+		return false
+	}
+	m.enabled[host] = enabled
+	return true
+}
+
+// hosts return the hosts in maintenance mode.
+func (m *maintenance) hosts() []string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	hosts := make([]string, 0, len(m.enabled))
+	for host, enabled := range m.enabled {
+		if enabled {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// adminMaintenanceList return the hosts in maintenance mode.
+func (s *Server) adminMaintenanceList(w http.ResponseWriter, _ *http.Request) {
+	payload, err := json.Marshal(struct {
+		Hosts []string `json:"hosts"`
+	}{s.maintenance.hosts()})
+	if err != nil {
+		s.config.Logger.Error("maintenance list error", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(payload) // nolint: errcheck
+}
+
+// adminMaintenanceEnable put the host in maintenance mode.
+func (s *Server) adminMaintenanceEnable(w http.ResponseWriter, r *http.Request) {
+	s.adminMaintenanceSet(w, r, true)
+}
+
+// adminMaintenanceDisable remove the host from the maintenance mode.
+func (s *Server) adminMaintenanceDisable(w http.ResponseWriter, r *http.Request) {
+	s.adminMaintenanceSet(w, r, false)
+}
+
+func (s *Server) adminMaintenanceSet(w http.ResponseWriter, r *http.Request, enabled bool) {
+	host := chi.URLParam(r, "host")
+	if !s.maintenance.set(host, enabled) {
+		http.Error(w, fmt.Sprintf("host '%s' not found", host), http.StatusNotFound)
+		return
+	}
+
+	s.config.Logger.Info("maintenance mode changed", "host", host, "enabled", enabled)
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"host":%q,"enabled":%t}`, host, enabled)
+}
+
+func newMaintenance(hosts []internal.Host) (*maintenance, error) {
+	m := &maintenance{
+		enabled: make(map[string]bool, len(hosts)),
+		pages:   make(map[string]maintenancePage, len(hosts)),
+	}
+
+	for _, host := range hosts {
+		page := maintenancePage{
+			body:        []byte(http.StatusText(http.StatusServiceUnavailable) + "\n"),
+			contentType: "text/plain; charset=utf-8",
+			status:      http.StatusServiceUnavailable,
+		}
+
+		if config := host.Maintenance; config != nil {
+			if config.Page != "" {
+				body, err := ioutil.ReadFile(config.Page)
+				if err != nil {
+					return nil, errors.Wrapf(err, "read page '%s' of host '%s' error", config.Page, host.Endpoint)
+				}
+				page.body = body
+				if contentType := mime.TypeByExtension(filepath.Ext(config.Page)); contentType != "" {
+					page.contentType = contentType
+				} else {
+					page.contentType = http.DetectContentType(body)
+				}
+			}
+
+			if config.Status != 0 {
+				if (config.Status < 100) || (config.Status > 599) {
+					return nil, fmt.Errorf("invalid status '%d' of host '%s'", config.Status, host.Endpoint)
+				}
+				page.status = config.Status
+			}
+
+			if config.RetryAfter > 0 {
+				page.retryAfter = strconv.Itoa(int(config.RetryAfter.Seconds()))
+			}
+			m.enabled[host.Endpoint] = config.Enabled
+		}
+
+		m.pages[host.Endpoint] = page
+	}
+
+	return m, nil
+}
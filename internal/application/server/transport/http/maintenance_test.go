@@ -0,0 +1,54 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+func TestMaintenanceMiddleware(t *testing.T) {
+	t.Parallel()
+
+	m, err := newMaintenance([]internal.Host{
+		{Endpoint: "example.com"},
+		{
+			Endpoint: "api.example.com",
+			Maintenance: &internal.HostMaintenance{
+				Status:     http.StatusTooManyRequests,
+				RetryAfter: 2 * time.Minute,
+				Enabled:    true,
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"api.example.com"}, m.hosts())
+	require.False(t, m.set("example.org", true))
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	serve := func(host string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		m.middleware(host)(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://"+host, nil))
+		return w
+	}
+
+	w := serve("api.example.com")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "120", w.Header().Get("Retry-After"))
+	require.Equal(t, http.StatusNoContent, serve("example.com").Code)
+
+	require.True(t, m.set("example.com", true))
+	require.True(t, m.set("api.example.com", false))
+	require.Equal(t, []string{"example.com"}, m.hosts())
+
+	w = serve("example.com")
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Equal(t, "Service Unavailable\n", w.Body.String())
+	require.Equal(t, http.StatusNoContent, serve("api.example.com").Code)
+}
@@ -0,0 +1,297 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/pipehub/pipehub/internal"
+	"github.com/pipehub/pipehub/internal/infra/log"
+)
+
+const (
+	mirrorDefaultMaxBodySize = 1024 * 1024
+	mirrorDefaultTimeout     = 10 * time.Second
+	mirrorDefaultConcurrency = 16
+)
+
+// mirrorStats are the counters used to compare the shadow upstream with the primary one. The
+// latencies are the sum, in nanoseconds, of the requests compared.
+type mirrorStats struct {
+	requests       int64
+	dropped        int64
+	errors         int64
+	statusMatch    int64
+	statusMismatch int64
+	primaryLatency int64
+	shadowLatency  int64
+}
+
+func (ms *mirrorStats) MarshalJSON() ([]byte, error) {
+	compared := atomic.LoadInt64(&ms.statusMatch) + atomic.LoadInt64(&ms.statusMismatch)
+	average := func(total int64) float64 {
+		if compared == 0 {
+			return 0
+		}
+		return float64(total) / float64(compared) / float64(time.Millisecond)
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"requests":               atomic.LoadInt64(&ms.requests),
+		"dropped":                atomic.LoadInt64(&ms.dropped),
+		"errors":                 atomic.LoadInt64(&ms.errors),
+		"status_match":           atomic.LoadInt64(&ms.statusMatch),
+		"status_mismatch":        atomic.LoadInt64(&ms.statusMismatch),
+		"primary_latency_avg_ms": average(atomic.LoadInt64(&ms.primaryLatency)),
+		"shadow_latency_avg_ms":  average(atomic.LoadInt64(&ms.shadowLatency)),
+	})
+}
+
+// mirrorBodyReader keep a copy of the request body while it's read by the primary upstream. The
+// transport may still be reading the body after the response is received, so the access is
+// synchronized.
+type mirrorBodyReader struct {
+	io.ReadCloser
+	mutex    sync.Mutex
+	body     bytes.Buffer
+	limit    int64
+	overflow bool
+	eof      bool
+}
+
+func (mb *mirrorBodyReader) Read(p []byte) (int, error) {
+	n, err := mb.ReadCloser.Read(p)
+
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+	if !mb.overflow {
+		if int64(mb.body.Len()+n) > mb.limit {
+			mb.overflow = true
+			mb.body = bytes.Buffer{}
+		} else {
+			mb.body.Write(p[:n])
+		}
+	}
+	if err == io.EOF {
+		mb.eof = true
+	}
+	return n, err
+}
+
+// payload return the body if it was completely read.
+func (mb *mirrorBodyReader) payload() ([]byte, bool) {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+	if mb.overflow || !mb.eof {
+		return nil, false
+	}
+	return mb.body.Bytes(), true
+}
+
+// mirror duplicate a sample of the requests to a shadow upstream. The shadow request is only sent
+// after the primary response is written, and it's dropped if the concurrency limit is reached, this
+// way the primary path is never delayed.
+type mirror struct {
+	upstream    *url.URL
+	percentage  float64
+	maxBodySize int64
+	timeout     time.Duration
+	transport   http.RoundTripper
+	semaphore   chan struct{}
+	wg          sync.WaitGroup
+	stats       mirrorStats
+	logger      *log.Logger
+	sample      func() float64
+}
+
+func (m *mirror) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (m.sample() * 100) >= m.percentage {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.ContentLength > m.maxBodySize {
+			atomic.AddInt64(&m.stats.dropped, 1)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		req := m.request(r)
+		var body *mirrorBodyReader
+		if (r.Body != nil) && (r.Body != http.NoBody) {
+			body = &mirrorBodyReader{ReadCloser: r.Body, limit: m.maxBodySize}
+			r.Body = body
+		}
+
+		rw := &responseWriter{ResponseWriter: w}
+		start := time.Now()
+		next.ServeHTTP(rw, r)
+		primaryLatency := time.Since(start)
+
+		if body != nil {
+			payload, ok := body.payload()
+			if !ok {
+				atomic.AddInt64(&m.stats.dropped, 1)
+				return
+			}
+			req.Body = ioutil.NopCloser(bytes.NewReader(payload))
+			req.ContentLength = int64(len(payload))
+		}
+
+		select {
+		case m.semaphore <- struct{}{}:
+		default:
+			atomic.AddInt64(&m.stats.dropped, 1)
+			return
+		}
+
+		m.wg.Add(1)
+		go func() {
+			defer func() {
+				<-m.semaphore
+				m.wg.Done()
+			}()
+			m.send(req, rw.Status(), primaryLatency)
+		}()
+	})
+}
+
+// request create the shadow request, the body is set after the primary request is done.
+func (m *mirror) request(r *http.Request) *http.Request {
+	target := *r.URL
+	target.Scheme = m.upstream.Scheme
+	target.Host = m.upstream.Host
+	target.Path = path.Join("/", m.upstream.Path, r.URL.Path)
+	if strings.HasSuffix(r.URL.Path, "/") && !strings.HasSuffix(target.Path, "/") {
+		target.Path += "/"
+	}
+	target.RawPath = ""
+
+	req := &http.Request{
+		Method:     r.Method,
+		URL:        &target,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     r.Header.Clone(),
+		Body:       http.NoBody,
+		Host:       m.upstream.Host,
+	}
+	req.Header.Del("Connection")
+	req.Header.Set("X-Forwarded-Host", r.Host)
+	return req
+}
+
+func (m *mirror) send(req *http.Request, primaryStatus int, primaryLatency time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	atomic.AddInt64(&m.stats.requests, 1)
+	start := time.Now()
+	resp, err := m.transport.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		atomic.AddInt64(&m.stats.errors, 1)
+		m.logger.Debug("mirror request error", "error", err, "url", req.URL.String())
+		return
+	}
+	io.Copy(ioutil.Discard, resp.Body) // nolint: errcheck
+	resp.Body.Close()                  // nolint: errcheck
+	shadowLatency := time.Since(start)
+
+	if resp.StatusCode == primaryStatus {
+		atomic.AddInt64(&m.stats.statusMatch, 1)
+	} else {
+		atomic.AddInt64(&m.stats.statusMismatch, 1)
+		m.logger.Debug(
+			"mirror status mismatch",
+			"url", req.URL.String(), "primary", primaryStatus, "shadow", resp.StatusCode,
+		)
+	}
+	atomic.AddInt64(&m.stats.primaryLatency, int64(primaryLatency))
+	atomic.AddInt64(&m.stats.shadowLatency, int64(shadowLatency))
+}
+
+// wait for the shadow requests in flight.
+func (m *mirror) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// adminMirrorStats return the comparison metrics of the hosts with mirror.
+func (s *Server) adminMirrorStats(w http.ResponseWriter, _ *http.Request) {
+	stats := make(map[string]*mirrorStats, len(s.mirrors))
+	for host, m := range s.mirrors {
+		stats[host] = &m.stats
+	}
+
+	payload, err := json.Marshal(stats)
+	if err != nil {
+		s.config.Logger.Error("mirror stats error", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(payload) // nolint: errcheck
+}
+
+func newMirror(config internal.HostMirror, transport http.RoundTripper, logger *log.Logger) (*mirror, error) {
+	upstream, err := url.Parse(config.Upstream)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse upstream '%s' error", config.Upstream)
+	}
+	if (upstream.Scheme != "http") && (upstream.Scheme != "https") {
+		return nil, fmt.Errorf("invalid upstream '%s', expected an absolute http or https url", config.Upstream)
+	}
+	if (config.Percentage < 0) || (config.Percentage > 100) {
+		return nil, fmt.Errorf("invalid percentage '%v', expected a value from 0 to 100", config.Percentage)
+	}
+
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = mirrorDefaultMaxBodySize
+	}
+	if config.Timeout == 0 {
+		config.Timeout = mirrorDefaultTimeout
+	}
+	if config.Concurrency == 0 {
+		config.Concurrency = mirrorDefaultConcurrency
+	}
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	return &mirror{
+		upstream:    upstream,
+		percentage:  config.Percentage,
+		maxBodySize: config.MaxBodySize,
+		timeout:     config.Timeout,
+		transport:   transport,
+		semaphore:   make(chan struct{}, config.Concurrency),
+		logger:      logger,
+		sample:      rand.Float64, // nolint: gosec
+	}, nil
+}
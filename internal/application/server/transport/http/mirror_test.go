@@ -0,0 +1,109 @@
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+func TestMirror(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		maxBodySize    int64
+		body           string
+		shadowStatus   int
+		expectedBody   string
+		expectedStats  mirrorStats
+		expectedShadow bool
+	}{
+		{
+			name:           "status match",
+			body:           "payload",
+			shadowStatus:   http.StatusCreated,
+			expectedBody:   "payload",
+			expectedStats:  mirrorStats{requests: 1, statusMatch: 1},
+			expectedShadow: true,
+		},
+		{
+			name:           "status mismatch",
+			shadowStatus:   http.StatusInternalServerError,
+			expectedStats:  mirrorStats{requests: 1, statusMismatch: 1},
+			expectedShadow: true,
+		},
+		{
+			name:          "body too large",
+			maxBodySize:   4,
+			body:          "payload",
+			shadowStatus:  http.StatusCreated,
+			expectedStats: mirrorStats{dropped: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				shadowCalls int64
+				shadowBody  string
+				shadowPath  string
+			)
+			shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := ioutil.ReadAll(r.Body)
+				require.NoError(t, err)
+				shadowBody, shadowPath = string(body), r.URL.Path
+				atomic.AddInt64(&shadowCalls, 1)
+				w.WriteHeader(tt.shadowStatus)
+			}))
+			defer shadow.Close()
+
+			m, err := newMirror(
+				internal.HostMirror{Upstream: shadow.URL + "/v2", Percentage: 100, MaxBodySize: tt.maxBodySize},
+				nil,
+				nil,
+			)
+			require.NoError(t, err)
+
+			primary := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := ioutil.ReadAll(r.Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.body, string(body))
+				w.WriteHeader(http.StatusCreated)
+			})
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "http://example.com/users", strings.NewReader(tt.body))
+			r.ContentLength = -1
+			m.handler(primary).ServeHTTP(w, r)
+			require.Equal(t, http.StatusCreated, w.Code)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			require.NoError(t, m.wait(ctx))
+
+			require.Equal(t, tt.expectedStats.requests, m.stats.requests)
+			require.Equal(t, tt.expectedStats.dropped, m.stats.dropped)
+			require.Equal(t, tt.expectedStats.statusMatch, m.stats.statusMatch)
+			require.Equal(t, tt.expectedStats.statusMismatch, m.stats.statusMismatch)
+			if !tt.expectedShadow {
+				require.Zero(t, atomic.LoadInt64(&shadowCalls))
+				return
+			}
+			require.Equal(t, int64(1), atomic.LoadInt64(&shadowCalls))
+			require.Equal(t, tt.expectedBody, shadowBody)
+			require.Equal(t, "/v2/users", shadowPath)
+		})
+	}
+}
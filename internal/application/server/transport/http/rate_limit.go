@@ -0,0 +1,171 @@
+package http
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/pipehub/pipehub/internal"
+	"github.com/pipehub/pipehub/internal/infra/log"
+)
+
+// Sources of the key used to identify the client at the rate limit.
+const (
+	rateLimitKeyIP      = "ip"
+	rateLimitKeyHeader  = "header:"
+	rateLimitKeyContext = "context:"
+)
+
+type rateLimit struct {
+	endpoint string
+	limit    RateLimit
+	key      string
+	store    RateLimitStore
+	logger   *log.Logger
+}
+
+// afterAuth report if the rate limit need to be executed after the authentication, this happen
+// when the key is a header, the bucket is the identity authenticated with the header.
+func (rl rateLimit) afterAuth() bool {
+	return strings.HasPrefix(rl.key, rateLimitKeyHeader)
+}
+
+// afterPipes report if the rate limit need to be executed after the pipes, this happen when the
+// key is a value the pipe store at the request context.
+func (rl rateLimit) afterPipes() bool {
+	return strings.HasPrefix(rl.key, rateLimitKeyContext)
+}
+
+func (rl rateLimit) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := rl.endpoint + "|" + rl.clientKey(r)
+		allowed, retryAfter, err := rl.store.Allow(r.Context(), key, rl.limit)
+		if err != nil {
+			// A failure at the store should not take the host down, the request is allowed.
+			rl.logger.Error(
+				"rate limit store error",
+				"error", err, "host", rl.endpoint, "request_id", requestIDFromContext(r.Context()),
+			)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !allowed {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			if seconds < 1 {
+				seconds = 1
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientKey extract the value that identify the client, if the value is empty, the client IP is
+// used instead. The key is prefixed by its source, this way a value from a header or a pipe can't be
+// used to consume the bucket of a IP. The header keys use the identity the authentication got from
+// the header, the header value itself may change for the same client, like a new JWT, and it would
+// store the credentials at the rate limit store.
+func (rl rateLimit) clientKey(r *http.Request) string {
+	ip := "ip:" + clientIP(r)
+	switch {
+	case strings.HasPrefix(rl.key, rateLimitKeyHeader):
+		method, _ := r.Context().Value(contextKeyAuthMethod).(string)   // nolint: errcheck
+		subject, _ := r.Context().Value(contextKeyAuthSubject).(string) // nolint: errcheck
+		if subject != "" {
+			return "auth:" + method + ":" + subject
+		}
+	case strings.HasPrefix(rl.key, rateLimitKeyContext):
+		value, _ := r.Context().Value(strings.TrimPrefix(rl.key, rateLimitKeyContext)).(string) // nolint: errcheck
+		if value != "" {
+			return "ctx:" + value
+		}
+	}
+	return ip
+}
+
+func newRateLimit(
+	endpoint string,
+	config internal.HostRateLimit,
+	auth *internal.HostAuth,
+	store RateLimitStore,
+	logger *log.Logger,
+) (*rateLimit, error) {
+	switch config.Algorithm {
+	case "":
+		config.Algorithm = rateLimitAlgorithmTokenBucket
+	case rateLimitAlgorithmTokenBucket, rateLimitAlgorithmSlidingWindow:
+	default:
+		return nil, fmt.Errorf("invalid algorithm '%s'", config.Algorithm)
+	}
+
+	if config.Limit <= 0 {
+		return nil, fmt.Errorf("invalid limit '%d', it should be greater than zero", config.Limit)
+	}
+
+	if config.Window <= 0 {
+		return nil, fmt.Errorf("invalid window '%s', it should be greater than zero", config.Window)
+	}
+
+	if config.Burst == 0 {
+		config.Burst = config.Limit
+	}
+
+	switch {
+	case config.Key == "", config.Key == rateLimitKeyIP:
+		config.Key = rateLimitKeyIP
+	case strings.HasPrefix(config.Key, rateLimitKeyHeader) && (config.Key != rateLimitKeyHeader):
+		if err := rateLimitValidHeader(strings.TrimPrefix(config.Key, rateLimitKeyHeader), auth); err != nil {
+			return nil, errors.Wrapf(err, "invalid key '%s'", config.Key)
+		}
+	case strings.HasPrefix(config.Key, rateLimitKeyContext) && (config.Key != rateLimitKeyContext):
+	default:
+		return nil, fmt.Errorf("invalid key '%s'", config.Key)
+	}
+
+	return &rateLimit{
+		endpoint: endpoint,
+		key:      config.Key,
+		store:    store,
+		logger:   logger,
+		limit: RateLimit{
+			Algorithm: config.Algorithm,
+			Limit:     config.Limit,
+			Burst:     config.Burst,
+			Window:    config.Window,
+		},
+	}, nil
+}
+
+// rateLimitValidHeader check if the header is used by the host authentication. Any other header is
+// controlled by the client, which could send a new value at each request to get a new bucket. The
+// hosts authenticated by the pipes should use a context key set by the pipe.
+func rateLimitValidHeader(header string, auth *internal.HostAuth) error {
+	if auth == nil {
+		return errors.New(
+			"the header key require the host authentication, with pipes authentication use a context key",
+		)
+	}
+
+	header = http.CanonicalHeaderKey(header)
+	if (header == "Authorization") && ((auth.Basic != nil) || (auth.JWT != nil)) {
+		return nil
+	}
+	if auth.APIKey != nil {
+		apiKeyHeader := auth.APIKey.Header
+		if apiKeyHeader == "" {
+			apiKeyHeader = authAPIKeyDefaultHeader
+		}
+		if header == http.CanonicalHeaderKey(apiKeyHeader) {
+			return nil
+		}
+	}
+	return fmt.Errorf("the header '%s' is not used by the host authentication", header)
+}
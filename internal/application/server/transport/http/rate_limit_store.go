@@ -0,0 +1,151 @@
+package http
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Algorithms supported by the rate limit.
+const (
+	rateLimitAlgorithmTokenBucket   = "token-bucket"
+	rateLimitAlgorithmSlidingWindow = "sliding-window"
+)
+
+// RateLimit is the limit a store should enforce.
+type RateLimit struct {
+	Algorithm string
+	Limit     int
+	Burst     int
+	Window    time.Duration
+}
+
+// RateLimitStore persist the rate limit state. The default store keep the state in memory, a shared
+// backend allow multiple PipeHub instances to enforce the same limit.
+type RateLimitStore interface {
+	// Allow register a hit at the key and report if it's allowed. When the hit is not allowed, it
+	// return how long the client should wait before retry.
+	Allow(ctx context.Context, key string, limit RateLimit) (allowed bool, retryAfter time.Duration, err error)
+}
+
+type rateLimitMemoryEntry struct {
+	// Token bucket state.
+	tokens float64
+	last   time.Time
+
+	// Sliding window state.
+	start    time.Time
+	current  int
+	previous int
+
+	expire time.Time
+}
+
+// rateLimitMemoryStore keep the rate limit state in memory. The expired entries are removed from
+// time to time during the calls to Allow.
+type rateLimitMemoryStore struct {
+	mutex     sync.Mutex
+	entries   map[string]*rateLimitMemoryEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func (s *rateLimitMemoryStore) Allow(
+	_ context.Context, key string, limit RateLimit,
+) (bool, time.Duration, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &rateLimitMemoryEntry{}
+		s.entries[key] = entry
+	}
+
+	if limit.Algorithm == rateLimitAlgorithmSlidingWindow {
+		return s.slidingWindow(entry, limit, now)
+	}
+	return s.tokenBucket(entry, limit, now)
+}
+
+func (*rateLimitMemoryStore) tokenBucket(
+	entry *rateLimitMemoryEntry, limit RateLimit, now time.Time,
+) (bool, time.Duration, error) {
+	var (
+		capacity = float64(limit.Burst)
+		rate     = float64(limit.Limit) / limit.Window.Seconds()
+	)
+	if entry.last.IsZero() {
+		entry.tokens = capacity
+	} else {
+		entry.tokens = math.Min(capacity, entry.tokens+now.Sub(entry.last).Seconds()*rate)
+	}
+	entry.last = now
+	entry.expire = now.Add(time.Duration((capacity - entry.tokens) / rate * float64(time.Second)))
+
+	if entry.tokens < 1 {
+		return false, time.Duration((1 - entry.tokens) / rate * float64(time.Second)), nil
+	}
+	entry.tokens--
+	return true, 0, nil
+}
+
+// slidingWindow approximate the amount of hits at the last window using the hits from the current
+// and the previous fixed windows, weighting the previous one by the time that still overlap.
+func (*rateLimitMemoryStore) slidingWindow(
+	entry *rateLimitMemoryEntry, limit RateLimit, now time.Time,
+) (bool, time.Duration, error) {
+	start := now.Truncate(limit.Window)
+	switch {
+	case start.Equal(entry.start):
+	case start.Sub(entry.start) == limit.Window:
+		entry.previous, entry.current = entry.current, 0
+	default:
+		entry.previous, entry.current = 0, 0
+	}
+	entry.start = start
+	entry.expire = start.Add(2 * limit.Window)
+
+	var (
+		elapsed  = now.Sub(start)
+		weight   = 1 - float64(elapsed)/float64(limit.Window)
+		estimate = float64(entry.previous)*weight + float64(entry.current)
+	)
+	if estimate+1 <= float64(limit.Limit) {
+		entry.current++
+		return true, 0, nil
+	}
+
+	// Find when the previous window weight is small enough to allow one more hit, if the current
+	// window alone is already at the limit, the client need to wait the next window.
+	retryAfter := limit.Window - elapsed
+	if free := float64(limit.Limit - entry.current - 1); (free >= 0) && (entry.previous > 0) {
+		overlap := free / float64(entry.previous)
+		retryAfter = time.Duration((1-overlap)*float64(limit.Window)) - elapsed
+	}
+	return false, retryAfter, nil
+}
+
+func (s *rateLimitMemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for key, entry := range s.entries {
+		if now.After(entry.expire) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+func newRateLimitMemoryStore() *rateLimitMemoryStore {
+	return &rateLimitMemoryStore{
+		entries: make(map[string]*rateLimitMemoryEntry),
+		now:     time.Now,
+	}
+}
@@ -0,0 +1,149 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+func TestRateLimitMemoryStoreAllow(t *testing.T) {
+	t.Parallel()
+
+	type hit struct {
+		elapsed    time.Duration
+		allowed    bool
+		retryAfter time.Duration
+	}
+
+	tests := []struct {
+		name  string
+		limit RateLimit
+		hits  []hit
+	}{
+		{
+			"token bucket",
+			RateLimit{Algorithm: rateLimitAlgorithmTokenBucket, Limit: 1, Burst: 2, Window: time.Second},
+			[]hit{
+				{0, true, 0},
+				{0, true, 0},
+				{0, false, time.Second},
+				{500 * time.Millisecond, false, 500 * time.Millisecond},
+				{time.Second, true, 0},
+				{3 * time.Second, true, 0},
+				{3 * time.Second, true, 0},
+				{3 * time.Second, false, time.Second},
+			},
+		},
+		{
+			"sliding window",
+			RateLimit{Algorithm: rateLimitAlgorithmSlidingWindow, Limit: 2, Window: 10 * time.Second},
+			[]hit{
+				{0, true, 0},
+				{time.Second, true, 0},
+				{2 * time.Second, false, 8 * time.Second},
+				{10 * time.Second, false, 5 * time.Second},
+				{15 * time.Second, true, 0},
+				{16 * time.Second, false, 4 * time.Second},
+				{40 * time.Second, true, 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			start := time.Unix(1000, 0)
+			store := newRateLimitMemoryStore()
+			for i, h := range tt.hits {
+				store.now = func() time.Time { return start.Add(h.elapsed) }
+				allowed, retryAfter, err := store.Allow(context.Background(), "key", tt.limit)
+				require.NoError(t, err)
+				require.Equalf(t, h.allowed, allowed, "hit %d", i)
+				require.Equalf(t, h.retryAfter, retryAfter, "hit %d", i)
+			}
+		})
+	}
+}
+
+// rateLimitRedisStore mimic a fixed window limit at Redis, using INCR and EXPIRE at a key per
+// window. The state is shared by all the servers that use it.
+type rateLimitRedisStore struct {
+	mutex    sync.Mutex
+	counters map[string]int
+	expires  map[string]time.Time
+	now      func() time.Time
+}
+
+func (s *rateLimitRedisStore) Allow(_ context.Context, key string, limit RateLimit) (bool, time.Duration, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	if expire, ok := s.expires[key]; ok && !now.Before(expire) {
+		delete(s.counters, key)
+		delete(s.expires, key)
+	}
+
+	s.counters[key]++
+	if s.counters[key] == 1 {
+		s.expires[key] = now.Add(limit.Window)
+	}
+	if s.counters[key] > limit.Limit {
+		return false, s.expires[key].Sub(now), nil
+	}
+	return true, 0, nil
+}
+
+func TestRateLimitPluggableStore(t *testing.T) {
+	t.Parallel()
+
+	start := time.Unix(1000, 0)
+	elapsed := time.Duration(0)
+	store := &rateLimitRedisStore{
+		counters: make(map[string]int),
+		expires:  make(map[string]time.Time),
+		now:      func() time.Time { return start.Add(elapsed) },
+	}
+
+	// Two limiters with the same store act like two PipeHub instances.
+	var handlers []http.Handler
+	for i := 0; i < 2; i++ {
+		rl, err := newRateLimit(
+			"example.com", internal.HostRateLimit{Limit: 2, Window: 10 * time.Second}, nil, store, nil,
+		)
+		require.NoError(t, err)
+		handlers = append(handlers, rl.middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})))
+	}
+
+	serve := func(handler http.Handler) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+		r.RemoteAddr = "192.0.2.1:1000"
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	require.Equal(t, http.StatusNoContent, serve(handlers[0]).Code)
+	require.Equal(t, http.StatusNoContent, serve(handlers[1]).Code)
+
+	elapsed = 4 * time.Second
+	w := serve(handlers[0])
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "6", w.Header().Get("Retry-After"))
+	require.Equal(t, map[string]int{"example.com|ip:192.0.2.1": 3}, store.counters)
+
+	elapsed = 10 * time.Second
+	require.Equal(t, http.StatusNoContent, serve(handlers[1]).Code)
+}
@@ -0,0 +1,154 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	t.Parallel()
+
+	type hit struct {
+		remoteAddr string
+		subject    string
+		context    string
+		status     int
+	}
+
+	tests := []struct {
+		name string
+		key  string
+		hits []hit
+	}{
+		{
+			name: "ip",
+			key:  "ip",
+			hits: []hit{
+				{remoteAddr: "192.0.2.1:1000", status: http.StatusNoContent},
+				{remoteAddr: "192.0.2.1:1001", status: http.StatusTooManyRequests},
+				{remoteAddr: "192.0.2.2:1000", status: http.StatusNoContent},
+			},
+		},
+		{
+			name: "header",
+			key:  "header:X-API-Key",
+			hits: []hit{
+				{remoteAddr: "192.0.2.1:1000", subject: "a", status: http.StatusNoContent},
+				{remoteAddr: "192.0.2.2:1000", subject: "a", status: http.StatusTooManyRequests},
+				{remoteAddr: "192.0.2.2:1000", subject: "b", status: http.StatusNoContent},
+				{remoteAddr: "192.0.2.2:1000", status: http.StatusNoContent},
+			},
+		},
+		{
+			name: "header can't consume the bucket of a IP",
+			key:  "header:X-API-Key",
+			hits: []hit{
+				{remoteAddr: "192.0.2.1:1000", subject: "ip:192.0.2.2", status: http.StatusNoContent},
+				{remoteAddr: "192.0.2.2:1000", status: http.StatusNoContent},
+			},
+		},
+		{
+			name: "context",
+			key:  "context:user",
+			hits: []hit{
+				{remoteAddr: "192.0.2.1:1000", context: "a", status: http.StatusNoContent},
+				{remoteAddr: "192.0.2.2:1000", context: "a", status: http.StatusTooManyRequests},
+				{remoteAddr: "192.0.2.1:1000", status: http.StatusNoContent},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rl, err := newRateLimit(
+				"example.com",
+				internal.HostRateLimit{Limit: 1, Window: time.Minute, Key: tt.key},
+				&internal.HostAuth{APIKey: &internal.HostAuthAPIKey{}},
+				newRateLimitMemoryStore(),
+				nil,
+			)
+			require.NoError(t, err)
+
+			handler := rl.middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			for i, h := range tt.hits {
+				r := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+				r.RemoteAddr = h.remoteAddr
+				if h.subject != "" {
+					// The key sent by the client is not used, only the identity set by the authentication.
+					r.Header.Set("X-API-Key", strconv.Itoa(i))
+					ctx := contextWithValue(r.Context(), contextKeyAuthMethod, authMethodAPIKey)
+					r = r.WithContext(contextWithValue(ctx, contextKeyAuthSubject, h.subject))
+				}
+				if h.context != "" {
+					r = r.WithContext(context.WithValue(r.Context(), "user", h.context)) // nolint: staticcheck
+				}
+
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				require.Equalf(t, h.status, w.Code, "hit %d", i)
+				if h.status == http.StatusTooManyRequests {
+					require.Equalf(t, "60", w.Header().Get("Retry-After"), "hit %d", i)
+				} else {
+					require.Emptyf(t, w.Header().Get("Retry-After"), "hit %d", i)
+				}
+			}
+		})
+	}
+}
+
+func TestNewRateLimitHeaderKey(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		key        string
+		auth       *internal.HostAuth
+		shouldFail bool
+	}{
+		{"api key", "header:X-API-Key", &internal.HostAuth{APIKey: &internal.HostAuthAPIKey{}}, false},
+		{
+			"custom api key header",
+			"header:x-token",
+			&internal.HostAuth{APIKey: &internal.HostAuthAPIKey{Header: "X-Token"}},
+			false,
+		},
+		{"authorization", "header:Authorization", &internal.HostAuth{JWT: &internal.HostAuthJWT{}}, false},
+		{"without authentication", "header:X-API-Key", nil, true},
+		{"not a authentication header", "header:X-Tenant", &internal.HostAuth{JWT: &internal.HostAuthJWT{}}, true},
+		{
+			"authorization without a method that use it",
+			"header:Authorization",
+			&internal.HostAuth{APIKey: &internal.HostAuthAPIKey{}},
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := newRateLimit(
+				"example.com",
+				internal.HostRateLimit{Limit: 1, Window: time.Minute, Key: tt.key},
+				tt.auth,
+				newRateLimitMemoryStore(),
+				nil,
+			)
+			require.Equal(t, tt.shouldFail, err != nil)
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+
+	"github.com/pipehub/pipehub/internal/infra/log"
+)
+
+const recoveryDefaultWindow = time.Minute
+
+// ServerConfigRecovery has the configuration of the pipes panic recovery. The recovery is always
+// enabled, the pipes are only disabled if 'DisableAfter' is set.
+type ServerConfigRecovery struct {
+	// DisableAfter is the number of panics, inside the window, needed to disable a pipe. A disabled
+	// pipe answer with 503 until it's enabled again at the admin API. Zero never disable a pipe.
+	DisableAfter int
+	Window       time.Duration
+}
+
+// nolint: gochecknoglobals
+var (
+	// The panics by pipe are published at the expvar, it's global, so it's shared between servers.
+	recoveryPanics     = new(expvar.Map).Init()
+	recoveryPanicsOnce sync.Once
+)
+
+// recoveryContextKey is unique by pipe middleware, this way the nested pipes don't share the state.
+type recoveryContextKey struct {
+	pipe string
+}
+
+// recoveryPanicStack is implemented by the panics propagated from other goroutines, like the ones
+// from the pipes with timeout, they carry the stack of the goroutine that panicked.
+type recoveryPanicStack interface {
+	Value() interface{}
+	Stack() []byte
+}
+
+// recoveryRequest is used to know if a panic happened at the pipe or after it, at the next handler.
+type recoveryRequest struct {
+	downstream bool
+}
+
+type recoveryPipe struct {
+	panics   int64
+	recent   []time.Time
+	disabled bool
+}
+
+// recovery wrap the pipes functions to recover their panics. The panic is attributed to the pipe,
+// logged with the stack and counted. The request is answered with 500, or, if there is a panic
+// action, the panic is propagated to it.
+type recovery struct {
+	fetcher      serverHandlerFetcher
+	logger       *log.Logger
+	propagate    bool
+	disableAfter int
+	window       time.Duration
+	now          func() time.Time
+
+	mutex sync.Mutex
+	pipes map[string]*recoveryPipe
+}
+
+// Middleware fetch the pipe middleware and add the recovery. The next handler is wrapped to detect
+// the panics that should not be attributed to the pipe, like the ones from the proxy.
+func (rc *recovery) Middleware(id string) (func(http.Handler) http.Handler, error) {
+	fn, err := rc.fetcher.Middleware(id)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := recoveryPipeName(id)
+	return func(next http.Handler) http.Handler {
+		key := &recoveryContextKey{pipe: pipe}
+		handler := fn(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if v := recover(); v != nil {
+					if state, ok := r.Context().Value(key).(*recoveryRequest); ok {
+						state.downstream = true
+					}
+					panic(v)
+				}
+			}()
+			next.ServeHTTP(w, r)
+		}))
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			state := &recoveryRequest{}
+			r = r.WithContext(context.WithValue(r.Context(), key, state))
+			rc.serve(pipe, state, handler.ServeHTTP, w, r)
+		})
+	}, nil
+}
+
+// Handler fetch the pipe handler and add the recovery.
+func (rc *recovery) Handler(id string) (func(http.ResponseWriter, *http.Request), error) {
+	fn, err := rc.fetcher.Handler(id)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := recoveryPipeName(id)
+	return func(w http.ResponseWriter, r *http.Request) {
+		rc.serve(pipe, &recoveryRequest{}, fn, w, r)
+	}, nil
+}
+
+func (rc *recovery) serve(
+	pipe string, state *recoveryRequest, fn http.HandlerFunc, w http.ResponseWriter, r *http.Request,
+) {
+	if rc.disabled(pipe) {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+
+	rw := &responseWriter{ResponseWriter: w}
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+
+		stack := debug.Stack()
+		if p, ok := v.(recoveryPanicStack); ok {
+			v, stack = p.Value(), p.Stack()
+		}
+
+		// The abort is used by the handlers to stop the response on purpose and the panics after the
+		// pipe are handled by who catch them.
+		if (v == http.ErrAbortHandler) || state.downstream { // nolint: goerr113
+			panic(v)
+		}
+
+		rc.record(pipe, v, stack, r)
+		if rc.propagate {
+			panic(v)
+		}
+		if rw.status == 0 {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+	}()
+	fn(rw, r)
+}
+
+func (rc *recovery) record(pipe string, value interface{}, stack []byte, r *http.Request) {
+	recoveryPanics.Add(pipe, 1)
+
+	rc.mutex.Lock()
+	state := rc.pipe(pipe)
+	state.panics++
+
+	var disabled bool
+	if (rc.disableAfter > 0) && !state.disabled {
+		now := rc.now()
+		recent := state.recent[:0]
+		for _, at := range state.recent {
+			if now.Sub(at) < rc.window {
+				recent = append(recent, at)
+			}
+		}
+		state.recent = append(recent, now)
+
+		if len(state.recent) >= rc.disableAfter {
+			state.disabled = true
+			disabled = true
+		}
+	}
+	rc.mutex.Unlock()
+
+	rc.logger.Error(
+		"pipe panic",
+		"pipe", pipe,
+		"panic", fmt.Sprint(value),
+		"host", r.Host,
+		"path", r.URL.Path,
+		"request_id", requestIDFromContext(r.Context()),
+		"stack", string(stack),
+	)
+	if disabled {
+		rc.logger.Error("pipe disabled after repeated panics", "pipe", pipe, "panics", rc.disableAfter, "window", rc.window)
+	}
+}
+
+func (rc *recovery) disabled(pipe string) bool {
+	if rc.disableAfter == 0 {
+		return false
+	}
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	state, ok := rc.pipes[pipe]
+	return ok && state.disabled
+}
+
+// pipe return the state of the pipe, it should be called with the mutex locked.
+func (rc *recovery) pipe(pipe string) *recoveryPipe {
+	state, ok := rc.pipes[pipe]
+	if !ok {
+		state = &recoveryPipe{}
+		rc.pipes[pipe] = state
+	}
+	return state
+}
+
+// reset enable the pipe again and clear the recent panics, it return false if the pipe never
+// panicked.
+func (rc *recovery) reset(pipe string) bool {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	state, ok := rc.pipes[pipe]
+	if !ok {
+		return false
+	}
+	state.disabled = false
+	state.recent = nil
+	return true
+}
+
+func (rc *recovery) state() map[string]interface{} {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	result := make(map[string]interface{}, len(rc.pipes))
+	for pipe, state := range rc.pipes {
+		result[pipe] = map[string]interface{}{
+			"panics":   state.panics,
+			"disabled": state.disabled,
+		}
+	}
+	return result
+}
+
+// adminRecoveryList return the panics and the state of the pipes that panicked.
+func (s *Server) adminRecoveryList(w http.ResponseWriter, _ *http.Request) {
+	payload, err := json.Marshal(s.recovery.state())
+	if err != nil {
+		s.config.Logger.Error("recovery list error", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(payload) // nolint: errcheck
+}
+
+// adminRecoveryReset enable again a pipe disabled after repeated panics.
+func (s *Server) adminRecoveryReset(w http.ResponseWriter, r *http.Request) {
+	pipe := chi.URLParam(r, "pipe")
+	if !s.recovery.reset(pipe) {
+		http.Error(w, fmt.Sprintf("pipe '%s' not found", pipe), http.StatusNotFound)
+		return
+	}
+
+	s.config.Logger.Info("pipe enabled", "pipe", pipe)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// recoveryPipeName extract the pipe from the function id, 'auth@internal.Check' return
+// 'auth@internal'.
+func recoveryPipeName(id string) string {
+	if i := strings.LastIndex(id, "."); i >= 0 {
+		return id[:i]
+	}
+	return id
+}
+
+func newRecovery(
+	config ServerConfigRecovery, fetcher serverHandlerFetcher, propagate bool, logger *log.Logger,
+) (*recovery, error) {
+	if config.DisableAfter < 0 {
+		return nil, fmt.Errorf("invalid disable after '%d', it can't be negative", config.DisableAfter)
+	}
+	if config.Window < 0 {
+		return nil, errors.New("invalid window, it can't be negative")
+	}
+	if config.Window == 0 {
+		config.Window = recoveryDefaultWindow
+	}
+
+	recoveryPanicsOnce.Do(func() {
+		expvar.Publish("pipe_panics", recoveryPanics)
+	})
+
+	return &recovery{
+		fetcher:      fetcher,
+		logger:       logger,
+		propagate:    propagate,
+		disableAfter: config.DisableAfter,
+		window:       config.Window,
+		now:          time.Now,
+		pipes:        make(map[string]*recoveryPipe),
+	}, nil
+}
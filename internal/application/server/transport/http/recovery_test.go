@@ -0,0 +1,173 @@
+package http
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipehub/pipehub/internal/infra/log"
+)
+
+// recoveryAsyncPanic mimic a panic propagated from the goroutine of a pipe with timeout.
+type recoveryAsyncPanic struct{}
+
+func (recoveryAsyncPanic) Value() interface{} { return "faulty" }
+func (recoveryAsyncPanic) Stack() []byte      { return []byte("goroutine 7 [running]:\nfaulty.Check()") }
+
+type recoveryFetcher struct{}
+
+func (recoveryFetcher) Middleware(id string) (func(http.Handler) http.Handler, error) {
+	switch id {
+	case "faulty.Middleware":
+		return func(http.Handler) http.Handler {
+			return http.HandlerFunc(func(http.ResponseWriter, *http.Request) { panic("faulty") })
+		}, nil
+	case "async.Middleware":
+		return func(http.Handler) http.Handler {
+			return http.HandlerFunc(func(http.ResponseWriter, *http.Request) { panic(recoveryAsyncPanic{}) })
+		}, nil
+	case "base.Middleware":
+		return func(next http.Handler) http.Handler { return next }, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func (recoveryFetcher) Handler(string) (func(http.ResponseWriter, *http.Request), error) {
+	return func(http.ResponseWriter, *http.Request) { panic("faulty") }, nil
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		id        string
+		next      http.HandlerFunc
+		propagate bool
+		status    int
+		panics    map[string]interface{}
+		panic     bool
+	}{
+		{
+			name:   "pipe panic",
+			id:     "faulty.Middleware",
+			status: http.StatusInternalServerError,
+			panics: map[string]interface{}{
+				"faulty": map[string]interface{}{"panics": int64(1), "disabled": false},
+			},
+		},
+		{
+			name:      "pipe panic propagated to the panic action",
+			id:        "faulty.Middleware",
+			propagate: true,
+			panics: map[string]interface{}{
+				"faulty": map[string]interface{}{"panics": int64(1), "disabled": false},
+			},
+			panic: true,
+		},
+		{
+			name:   "panic after the pipe",
+			id:     "base.Middleware",
+			next:   func(http.ResponseWriter, *http.Request) { panic("upstream") },
+			panics: map[string]interface{}{},
+			panic:  true,
+		},
+		{
+			name:   "abort",
+			id:     "base.Middleware",
+			next:   func(http.ResponseWriter, *http.Request) { panic(http.ErrAbortHandler) },
+			panics: map[string]interface{}{},
+			panic:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rc, err := newRecovery(ServerConfigRecovery{}, recoveryFetcher{}, tt.propagate, nil)
+			require.NoError(t, err)
+			middleware, err := rc.Middleware(tt.id)
+			require.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			serve := func() { middleware(tt.next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil)) }
+			if tt.panic {
+				require.Panics(t, serve)
+			} else {
+				require.NotPanics(t, serve)
+				require.Equal(t, tt.status, w.Code)
+			}
+			require.Equal(t, tt.panics, rc.state())
+		})
+	}
+}
+
+func TestRecoveryDisable(t *testing.T) {
+	t.Parallel()
+
+	rc, err := newRecovery(
+		ServerConfigRecovery{DisableAfter: 2, Window: time.Minute}, recoveryFetcher{}, false, nil,
+	)
+	require.NoError(t, err)
+	now := time.Now()
+	rc.now = func() time.Time { return now }
+
+	handler, err := rc.Handler("faulty.Handler")
+	require.NoError(t, err)
+	serve := func() int {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusInternalServerError, serve())
+	now = now.Add(2 * time.Minute)
+	require.Equal(t, http.StatusInternalServerError, serve())
+	require.False(t, rc.disabled("faulty"))
+
+	require.Equal(t, http.StatusInternalServerError, serve())
+	require.True(t, rc.disabled("faulty"))
+	require.Equal(t, http.StatusServiceUnavailable, serve())
+
+	require.False(t, rc.reset("base"))
+	require.True(t, rc.reset("faulty"))
+	require.Equal(t, http.StatusInternalServerError, serve())
+}
+
+func TestRecoveryPanicStack(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "pipehub-recovery-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	logger, err := log.NewLogger(log.LoggerConfig{Output: filepath.Join(dir, "pipehub.log")})
+	require.NoError(t, err)
+	defer logger.Close() // nolint: errcheck
+
+	rc, err := newRecovery(ServerConfigRecovery{}, recoveryFetcher{}, true, logger)
+	require.NoError(t, err)
+	middleware, err := rc.Middleware("async.Middleware")
+	require.NoError(t, err)
+
+	// The original value is propagated to the panic action and the stack of the pipe is logged.
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(contextWithValue(r.Context(), contextKeyRequestID, "abc"))
+	require.PanicsWithValue(t, "faulty", func() { middleware(nil).ServeHTTP(httptest.NewRecorder(), r) })
+	payload, err := ioutil.ReadFile(filepath.Join(dir, "pipehub.log"))
+	require.NoError(t, err)
+	require.Contains(t, string(payload), "faulty.Check()")
+	require.Contains(t, string(payload), "request_id=abc")
+	require.Equal(t, map[string]interface{}{
+		"async": map[string]interface{}{"panics": int64(1), "disabled": false},
+	}, rc.state())
+}
@@ -0,0 +1,167 @@
+package http
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+// ServerConfigHTTPSRedirect has the configuration needed to redirect the plain HTTP traffic to the
+// TLS listener.
+type ServerConfigHTTPSRedirect struct {
+	// Port of the plain HTTP listener. The redirect is enabled when it's set and the TLS is
+	// configured.
+	Port int
+
+	// Status can be 301, 302, 303, 307 or 308, the default is 308.
+	Status int
+}
+
+type redirectRule struct {
+	match  *regexp.Regexp
+	target string
+	status int
+}
+
+// redirect answer the requests that match the rules of its host before the request is dispatched to
+// the pipes.
+type redirect struct {
+	hosts map[string][]redirectRule
+}
+
+func (rd redirect) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rules, ok := rd.hosts[strings.ToLower(r.Host)]
+		if !ok {
+			rules = rd.hosts["*"]
+		}
+
+		for _, rule := range rules {
+			location, ok := rule.location(r)
+			if !ok {
+				continue
+			}
+			http.Redirect(w, r, location, rule.status)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// location return the redirect target if the rule match the request.
+func (rule redirectRule) location(r *http.Request) (string, bool) {
+	path := r.URL.Path
+	if rule.match == nil {
+		return redirectAppendQuery(rule.target, r), true
+	}
+
+	match := rule.match.FindStringSubmatchIndex(path)
+	if match == nil {
+		return "", false
+	}
+	target := string(rule.match.ExpandString(nil, rule.target, path, match))
+	return redirectAppendQuery(target, r), true
+}
+
+// redirectAppendQuery keep the request query string if the target don't have one.
+func redirectAppendQuery(target string, r *http.Request) string {
+	if (r.URL.RawQuery == "") || strings.Contains(target, "?") {
+		return target
+	}
+	return target + "?" + r.URL.RawQuery
+}
+
+// httpsRedirect send the plain HTTP requests to the TLS listener.
+type httpsRedirect struct {
+	port   int
+	status int
+}
+
+func (hr httpsRedirect) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if hr.port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(hr.port))
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, hr.status)
+	})
+}
+
+func newRedirect(hosts []internal.Host) (redirect, error) {
+	var (
+		rd      = redirect{hosts: make(map[string][]redirectRule)}
+		enabled bool
+	)
+	for _, host := range hosts {
+		// The hosts without rules are kept at the map, the "*" rules are only used by the hosts that
+		// aren't configured.
+		endpoint := strings.ToLower(host.Endpoint)
+		if _, ok := rd.hosts[endpoint]; !ok {
+			rd.hosts[endpoint] = nil
+		}
+
+		for i, config := range host.Redirect {
+			rule := redirectRule{target: config.Target, status: config.Status}
+			if rule.target == "" {
+				return redirect{}, fmt.Errorf("missing target at rule %d of host '%s'", i, host.Endpoint)
+			}
+
+			var err error
+			if rule.status, err = redirectStatus(config.Status, http.StatusMovedPermanently); err != nil {
+				return redirect{}, errors.Wrapf(err, "rule %d of host '%s' error", i, host.Endpoint)
+			}
+
+			if config.Match != "" {
+				rule.match, err = regexp.Compile(config.Match)
+				if err != nil {
+					return redirect{}, errors.Wrapf(err, "rule %d of host '%s' match compile error", i, host.Endpoint)
+				}
+			}
+
+			rd.hosts[endpoint] = append(rd.hosts[endpoint], rule)
+			enabled = true
+		}
+	}
+
+	if !enabled {
+		return redirect{}, nil
+	}
+	return rd, nil
+}
+
+func newHTTPSRedirect(config ServerConfigHTTPSRedirect, tlsPort int) (*httpsRedirect, error) {
+	status, err := redirectStatus(config.Status, http.StatusPermanentRedirect)
+	if err != nil {
+		return nil, err
+	}
+	return &httpsRedirect{port: tlsPort, status: status}, nil
+}
+
+func redirectStatus(status, fallback int) (int, error) {
+	switch status {
+	case 0:
+		return fallback, nil
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect,
+		http.StatusPermanentRedirect:
+		return status, nil
+	default:
+		return 0, fmt.Errorf("invalid status '%d'", status)
+	}
+}
@@ -0,0 +1,96 @@
+package http
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+func TestRedirectMiddleware(t *testing.T) {
+	t.Parallel()
+
+	rd, err := newRedirect([]internal.Host{
+		{
+			Endpoint: "example.com",
+			Redirect: []internal.HostRedirect{
+				{Match: "^/blog/(.*)$", Target: "https://blog.example.com/$1"},
+				{Match: "^/old$", Target: "/new?source=old", Status: http.StatusFound},
+			},
+		},
+		{Endpoint: "api.example.com"},
+		{
+			Endpoint: "*",
+			Redirect: []internal.HostRedirect{{Match: "^/legacy", Target: "https://example.com/"}},
+		},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		target   string
+		status   int
+		location string
+	}{
+		{"capture", "http://example.com/blog/post?page=2", http.StatusMovedPermanently, "https://blog.example.com/post?page=2"},
+		{"target with query", "http://example.com/old?page=2", http.StatusFound, "/new?source=old"},
+		{"not matched", "http://example.com/users", http.StatusOK, ""},
+		{"default host", "http://example.org/legacy", http.StatusMovedPermanently, "https://example.com/"},
+		{"rules of other host", "http://example.org/blog/post", http.StatusOK, ""},
+		{"configured host without rules", "http://api.example.com/legacy", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			rd.middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(w, r)
+			require.Equal(t, tt.status, w.Code)
+			require.Equal(t, tt.location, w.Header().Get("Location"))
+		})
+	}
+}
+
+func TestHTTPSRedirectMiddleware(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		port     int
+		target   string
+		tls      bool
+		status   int
+		location string
+	}{
+		{"plain", 443, "http://example.com:80/users?id=1", false, http.StatusPermanentRedirect, "https://example.com/users?id=1"},
+		{"custom port", 8443, "http://example.com/users", false, http.StatusPermanentRedirect, "https://example.com:8443/users"},
+		{"tls", 443, "https://example.com/users", true, http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			hr, err := newHTTPSRedirect(ServerConfigHTTPSRedirect{Port: 80}, tt.port)
+			require.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			} else {
+				r.TLS = nil
+			}
+			hr.middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(w, r)
+			require.Equal(t, tt.status, w.Code)
+			require.Equal(t, tt.location, w.Header().Get("Location"))
+		})
+	}
+}
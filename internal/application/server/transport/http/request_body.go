@@ -0,0 +1,175 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/pipehub/pipehub/internal"
+	"github.com/pipehub/pipehub/internal/infra/log"
+)
+
+// requestBodyDefaultBufferMemory is the amount of bytes kept in memory while buffering a request
+// body, the remaining is written to a temporary file.
+const requestBodyDefaultBufferMemory = 1024 * 1024
+
+// errRequestBodyTooLarge is returned by the body reader when the limit is exceeded.
+var errRequestBodyTooLarge = errors.New("request body too large") // nolint: gochecknoglobals
+
+type requestBodyReaderKey struct{}
+
+// requestBodyReader limit the amount of bytes read from the request body. It's stored at the request
+// context, this way the proxy error handler can tell if the upstream request failed because of the
+// limit.
+type requestBodyReader struct {
+	io.ReadCloser
+	remaining int64
+	exceeded  bool
+}
+
+func (rb *requestBodyReader) Read(p []byte) (int, error) {
+	if rb.exceeded {
+		return 0, errRequestBodyTooLarge
+	}
+
+	// Read one byte more than the remaining to detect if the limit was exceeded.
+	if int64(len(p)) > rb.remaining+1 {
+		p = p[:rb.remaining+1]
+	}
+	n, err := rb.ReadCloser.Read(p)
+	if int64(n) > rb.remaining {
+		rb.exceeded = true
+		return int(rb.remaining), errRequestBodyTooLarge
+	}
+	rb.remaining -= int64(n)
+	return n, err
+}
+
+func requestBodyExceeded(ctx context.Context) bool {
+	rb, ok := ctx.Value(requestBodyReaderKey{}).(*requestBodyReader)
+	return ok && rb.exceeded
+}
+
+// requestBody limit the request body size and, if configured, buffer the body before the request
+// is passed to the pipes and upstream.
+type requestBody struct {
+	maxSize      int64
+	buffer       bool
+	bufferMemory int64
+	bufferPath   string
+	logger       *log.Logger
+}
+
+func (rb requestBody) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Body == nil) || (r.Body == http.NoBody) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if (rb.maxSize > 0) && (r.ContentLength > rb.maxSize) {
+			rb.tooLarge(w)
+			return
+		}
+
+		if rb.maxSize > 0 {
+			reader := &requestBodyReader{ReadCloser: r.Body, remaining: rb.maxSize}
+			r.Body = reader
+			r = r.WithContext(context.WithValue(r.Context(), requestBodyReaderKey{}, reader))
+		}
+
+		if !rb.buffer || (r.Header.Get("Upgrade") != "") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, size, err := rb.read(r.Body)
+		if err != nil {
+			if body != nil {
+				body.Close() // nolint: errcheck, gosec
+			}
+			if errors.Cause(err) == errRequestBodyTooLarge {
+				rb.tooLarge(w)
+				return
+			}
+			rb.logger.Debug("request body read error", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		defer body.Close() // nolint: errcheck
+
+		// The body now has a known size, so it's sent to the upstream with a 'Content-Length' instead
+		// of chunked.
+		r.Body = body
+		r.ContentLength = size
+		r.TransferEncoding = nil
+		r.Header.Set("Content-Length", strconv.FormatInt(size, 10))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// read the whole body into memory until the memory limit is reached, the remaining is written to a
+// temporary file that is removed when the returned body is closed.
+func (rb requestBody) read(src io.Reader) (io.ReadCloser, int64, error) {
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(src, rb.bufferMemory+1))
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "read error")
+	}
+	if n <= rb.bufferMemory {
+		return ioutil.NopCloser(&buf), n, nil
+	}
+
+	f, err := ioutil.TempFile(rb.bufferPath, "pipehub-body-")
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "create temporary file error")
+	}
+	body := &requestBodyFile{File: f}
+
+	size, err := io.Copy(f, io.MultiReader(&buf, src))
+	if err != nil {
+		return body, 0, errors.Wrap(err, "write temporary file error")
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return body, 0, errors.Wrap(err, "seek temporary file error")
+	}
+	return body, size, nil
+}
+
+func (requestBody) tooLarge(w http.ResponseWriter) {
+	w.Header().Set("Connection", "close")
+	http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+}
+
+// requestBodyFile is a temporary file that is removed when closed.
+type requestBodyFile struct {
+	*os.File
+}
+
+func (f *requestBodyFile) Close() error {
+	err := f.File.Close()
+	if rerr := os.Remove(f.Name()); (rerr != nil) && (err == nil) {
+		err = rerr
+	}
+	return err
+}
+
+func newRequestBody(config internal.HostRequestBody, logger *log.Logger) requestBody {
+	rb := requestBody{
+		maxSize:      config.MaxSize,
+		buffer:       config.Buffer,
+		bufferMemory: config.BufferMemory,
+		bufferPath:   config.BufferPath,
+		logger:       logger,
+	}
+	if rb.bufferMemory <= 0 {
+		rb.bufferMemory = requestBodyDefaultBufferMemory
+	}
+	return rb
+}
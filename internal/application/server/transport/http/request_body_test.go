@@ -0,0 +1,105 @@
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+func TestRequestBodyMiddleware(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		config        internal.HostRequestBody
+		body          string
+		contentLength int64
+		status        int
+		received      string
+	}{
+		{
+			"streamed",
+			internal.HostRequestBody{MaxSize: 10},
+			"pipehub",
+			-1,
+			http.StatusOK,
+			"pipehub",
+		},
+		{
+			"streamed above the limit",
+			internal.HostRequestBody{MaxSize: 4},
+			"pipehub",
+			-1,
+			http.StatusInternalServerError,
+			"",
+		},
+		{
+			"content length above the limit",
+			internal.HostRequestBody{MaxSize: 4},
+			"pipehub",
+			7,
+			http.StatusRequestEntityTooLarge,
+			"",
+		},
+		{
+			"buffered in memory",
+			internal.HostRequestBody{Buffer: true},
+			"pipehub",
+			-1,
+			http.StatusOK,
+			"pipehub",
+		},
+		{
+			"buffered at file",
+			internal.HostRequestBody{Buffer: true, BufferMemory: 2},
+			"pipehub",
+			-1,
+			http.StatusOK,
+			"pipehub",
+		},
+		{
+			"buffered above the limit",
+			internal.HostRequestBody{MaxSize: 4, Buffer: true, BufferMemory: 2},
+			"pipehub",
+			-1,
+			http.StatusRequestEntityTooLarge,
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				payload, err := ioutil.ReadAll(r.Body)
+				if err != nil {
+					require.True(t, requestBodyExceeded(r.Context()))
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				if tt.config.Buffer {
+					require.Equal(t, int64(len(payload)), r.ContentLength)
+				}
+				w.Write(payload) // nolint: errcheck
+			})
+
+			r := httptest.NewRequest(http.MethodPost, "/", ioutil.NopCloser(strings.NewReader(tt.body)))
+			r.ContentLength = tt.contentLength
+			w := httptest.NewRecorder()
+			newRequestBody(tt.config, nil).middleware(handler).ServeHTTP(w, r)
+
+			require.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusOK {
+				require.Equal(t, tt.received, w.Body.String())
+			}
+		})
+	}
+}
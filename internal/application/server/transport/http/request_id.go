@@ -0,0 +1,151 @@
+package http
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/pipehub/pipehub/internal/infra/log"
+)
+
+// Formats supported by the request ID generator.
+const (
+	requestIDFormatUUID = "uuid"
+	requestIDFormatULID = "ulid"
+)
+
+// Request IDs received from the client are only accepted if they're smaller than this size.
+const requestIDMaxSize = 128
+
+// ServerConfigRequestID has the configuration needed to generate and propagate the request ID. An
+// empty header disable the request ID.
+type ServerConfigRequestID struct {
+	Header string
+
+	// Format can be 'uuid' or 'ulid'.
+	Format string
+}
+
+// requestID accept the ID sent by the client or generate a new one. The ID is stored at the request
+// context and header, which is forwarded to the upstream, and returned at the response.
+type requestID struct {
+	header   string
+	generate func() (string, error)
+	logger   *log.Logger
+}
+
+func (rid requestID) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(rid.header)
+		if !validRequestID(id) {
+			var err error
+			id, err = rid.generate()
+			if err != nil {
+				rid.logger.Error("request id generation error", "error", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			r.Header.Set(rid.header, id)
+		}
+		w.Header().Set(rid.header, id)
+
+		if record := accessLogRecordFromContext(r.Context()); record != nil {
+			record.requestID = id
+		}
+
+		ctx := contextWithValue(r.Context(), contextKeyRequestID, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// validRequestID only accept visible ASCII characters to avoid any kind of injection at the logs.
+func validRequestID(id string) bool {
+	if (id == "") || (len(id) > requestIDMaxSize) {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if (id[i] < '!') || (id[i] > '~') {
+			return false
+		}
+	}
+	return true
+}
+
+// genUUID generate a random UUID, version 4.
+func genUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", errors.Wrap(err, "random read error")
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	var buf [36]byte
+	hex.Encode(buf[0:8], b[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], b[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], b[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], b[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], b[10:])
+	return string(buf[:]), nil
+}
+
+// genULID generate a ULID, a lexicographically sortable ID composed by 48 bits of the timestamp in
+// milliseconds followed by 80 random bits, encoded with the Crockford's base32.
+func genULID() (string, error) {
+	var b [16]byte
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> uint(40-8*i))
+	}
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", errors.Wrap(err, "random read error")
+	}
+
+	// The 128 bits are encoded into 26 characters of 5 bits, the first character only use 3 bits.
+	const alphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	var (
+		buf   [26]byte
+		value uint64
+		bits  uint
+		pos   = len(buf) - 1
+	)
+	for i := len(b) - 1; i >= 0; i-- {
+		value |= uint64(b[i]) << bits
+		bits += 8
+		for bits >= 5 {
+			buf[pos] = alphabet[value&0x1f]
+			pos--
+			value >>= 5
+			bits -= 5
+		}
+	}
+	buf[pos] = alphabet[value&0x1f]
+	return string(buf[:]), nil
+}
+
+func newRequestID(config ServerConfigRequestID, logger *log.Logger) (*requestID, error) {
+	rid := requestID{
+		header: config.Header,
+		logger: logger,
+	}
+
+	switch config.Format {
+	case "", requestIDFormatUUID:
+		rid.generate = genUUID
+	case requestIDFormatULID:
+		rid.generate = genULID
+	default:
+		return nil, fmt.Errorf("invalid format '%s'", config.Format)
+	}
+
+	return &rid, nil
+}
@@ -0,0 +1,66 @@
+package http
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenUUID(t *testing.T) {
+	t.Parallel()
+
+	pattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	for i := 0; i < 100; i++ {
+		id, err := genUUID()
+		require.NoError(t, err)
+		require.Regexp(t, pattern, id)
+	}
+}
+
+func TestGenULID(t *testing.T) {
+	t.Parallel()
+
+	const alphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	start := time.Now().Add(-time.Millisecond)
+	id, err := genULID()
+	require.NoError(t, err)
+	require.Len(t, id, 26)
+
+	// The first 10 characters hold the timestamp.
+	var ms int64
+	for _, c := range id[:10] {
+		i := strings.IndexRune(alphabet, c)
+		require.NotEqual(t, -1, i, "invalid character '%c'", c)
+		ms = (ms << 5) | int64(i)
+	}
+	timestamp := time.Unix(0, ms*int64(time.Millisecond))
+	require.WithinDuration(t, start, timestamp, time.Second)
+}
+
+func TestValidRequestID(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		id        string
+		assertion require.BoolAssertionFunc
+	}{
+		{"valid", "01E4Z7Y2Q3C8V6T1K9N5M0P4R2", require.True},
+		{"empty", "", require.False},
+		{"with space", "request id", require.False},
+		{"with new line", "id\nfake=entry", require.False},
+		{"too big", strings.Repeat("a", requestIDMaxSize+1), require.False},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.assertion(t, validRequestID(tt.id))
+		})
+	}
+}
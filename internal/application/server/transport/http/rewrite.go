@@ -0,0 +1,155 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+type rewriteMatchesKey struct{}
+
+type rewriteRule struct {
+	match           *regexp.Regexp
+	requestHeader   internal.HostRewriteValues
+	responseHeader  internal.HostRewriteValues
+	query           internal.HostRewriteValues
+	stripPrefix     string
+	pathRegex       *regexp.Regexp
+	pathReplacement string
+	addPrefix       string
+	host            string
+}
+
+// rewrite apply the declarative rules to the upstream request and response. The request changes
+// are done at the reverse proxy director and the response changes at the response modifier.
+type rewrite struct {
+	rules []rewriteRule
+}
+
+// request apply the rules to the upstream request. The matched rules are stored at the request
+// context, this way the response is changed by the same rules even if the path was rewritten.
+func (rw rewrite) request(req *http.Request) {
+	var matches []int
+	for i, rule := range rw.rules {
+		if (rule.match != nil) && !rule.match.MatchString(req.URL.Path) {
+			continue
+		}
+		matches = append(matches, i)
+
+		rewriteValues(req.Header, rule.requestHeader)
+		rw.path(req.URL, rule)
+		if (len(rule.query.Set) > 0) || (len(rule.query.Add) > 0) || (len(rule.query.Remove) > 0) {
+			query := req.URL.Query()
+			rewriteValues(query, rule.query)
+			req.URL.RawQuery = query.Encode()
+		}
+		if rule.host != "" {
+			req.Host = rule.host
+		}
+	}
+
+	if len(matches) > 0 {
+		*req = *req.WithContext(context.WithValue(req.Context(), rewriteMatchesKey{}, matches))
+	}
+}
+
+func (rewrite) path(u *url.URL, rule rewriteRule) {
+	path := u.Path
+	if rule.stripPrefix != "" {
+		path = strings.TrimPrefix(path, rule.stripPrefix)
+	}
+	if rule.pathRegex != nil {
+		path = rule.pathRegex.ReplaceAllString(path, rule.pathReplacement)
+	}
+	path = rule.addPrefix + path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	if path != u.Path {
+		u.Path = path
+		u.RawPath = ""
+	}
+}
+
+// response apply the rules matched by the request to the upstream response.
+func (rw rewrite) response(resp *http.Response) error {
+	if resp.Request == nil {
+		return nil
+	}
+
+	matches, _ := resp.Request.Context().Value(rewriteMatchesKey{}).([]int) // nolint: errcheck
+	for _, i := range matches {
+		rewriteValues(resp.Header, rw.rules[i].responseHeader)
+	}
+	return nil
+}
+
+// rewriteValues works with headers and query parameters as both are a map of string slices. The
+// header names must be already canonical.
+func rewriteValues(values map[string][]string, changes internal.HostRewriteValues) {
+	for _, key := range changes.Remove {
+		delete(values, key)
+	}
+	for key, value := range changes.Set {
+		values[key] = []string{value}
+	}
+	for key, value := range changes.Add {
+		values[key] = append(values[key], value)
+	}
+}
+
+func newRewrite(config []internal.HostRewrite) (*rewrite, error) {
+	var rw rewrite
+	for i, rule := range config {
+		r := rewriteRule{
+			requestHeader:   canonicalRewriteHeader(rule.RequestHeader),
+			responseHeader:  canonicalRewriteHeader(rule.ResponseHeader),
+			query:           rule.Query,
+			stripPrefix:     rule.StripPrefix,
+			pathReplacement: rule.PathReplacement,
+			addPrefix:       rule.AddPrefix,
+			host:            rule.Host,
+		}
+
+		var err error
+		if rule.Match != "" {
+			r.match, err = regexp.Compile(rule.Match)
+			if err != nil {
+				return nil, errors.Wrapf(err, "rule %d match compile error", i)
+			}
+		}
+		if rule.PathRegex != "" {
+			r.pathRegex, err = regexp.Compile(rule.PathRegex)
+			if err != nil {
+				return nil, errors.Wrapf(err, "rule %d path regex compile error", i)
+			}
+		}
+		rw.rules = append(rw.rules, r)
+	}
+	return &rw, nil
+}
+
+// canonicalRewriteHeader convert the header names, this way they match the keys at http.Header.
+func canonicalRewriteHeader(values internal.HostRewriteValues) internal.HostRewriteValues {
+	result := internal.HostRewriteValues{
+		Set: make(map[string]string, len(values.Set)),
+		Add: make(map[string]string, len(values.Add)),
+	}
+	for _, key := range values.Remove {
+		result.Remove = append(result.Remove, http.CanonicalHeaderKey(key))
+	}
+	for key, value := range values.Set {
+		result.Set[http.CanonicalHeaderKey(key)] = value
+	}
+	for key, value := range values.Add {
+		result.Add[http.CanonicalHeaderKey(key)] = value
+	}
+	return result
+}
@@ -0,0 +1,123 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+func TestRewrite(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		rules          []internal.HostRewrite
+		target         string
+		header         http.Header
+		expectedURL    string
+		expectedHost   string
+		expectedHeader http.Header
+		responseHeader http.Header
+	}{
+		{
+			"no rules",
+			nil,
+			"http://example.com/users?id=1",
+			http.Header{},
+			"http://example.com/users?id=1",
+			"example.com",
+			http.Header{},
+			http.Header{"Server": {"upstream"}},
+		},
+		{
+			"prefix",
+			[]internal.HostRewrite{{Match: "^/api/", StripPrefix: "/api", AddPrefix: "/v1"}},
+			"http://example.com/api/users",
+			http.Header{},
+			"http://example.com/v1/users",
+			"example.com",
+			http.Header{},
+			http.Header{"Server": {"upstream"}},
+		},
+		{
+			"not matched",
+			[]internal.HostRewrite{{Match: "^/api/", StripPrefix: "/api", Host: "internal"}},
+			"http://example.com/users",
+			http.Header{},
+			"http://example.com/users",
+			"example.com",
+			http.Header{},
+			http.Header{"Server": {"upstream"}},
+		},
+		{
+			"regex",
+			[]internal.HostRewrite{{PathRegex: "^/users/([0-9]+)$", PathReplacement: "/u/$1"}},
+			"http://example.com/users/10",
+			http.Header{},
+			"http://example.com/u/10",
+			"example.com",
+			http.Header{},
+			http.Header{"Server": {"upstream"}},
+		},
+		{
+			"query and host",
+			[]internal.HostRewrite{{
+				Query: internal.HostRewriteValues{
+					Set:    map[string]string{"page": "1"},
+					Remove: []string{"debug"},
+				},
+				Host: "internal",
+			}},
+			"http://example.com/users?debug=true&page=2",
+			http.Header{},
+			"http://example.com/users?page=1",
+			"internal",
+			http.Header{},
+			http.Header{"Server": {"upstream"}},
+		},
+		{
+			"headers",
+			[]internal.HostRewrite{{
+				RequestHeader: internal.HostRewriteValues{
+					Set:    map[string]string{"x-role": "admin"},
+					Add:    map[string]string{"x-tag": "b"},
+					Remove: []string{"cookie"},
+				},
+				ResponseHeader: internal.HostRewriteValues{
+					Set:    map[string]string{"x-frame-options": "DENY"},
+					Remove: []string{"server"},
+				},
+			}},
+			"http://example.com/users",
+			http.Header{"Cookie": {"session=1"}, "X-Role": {"user"}, "X-Tag": {"a"}},
+			"http://example.com/users",
+			"example.com",
+			http.Header{"X-Role": {"admin"}, "X-Tag": {"a", "b"}},
+			http.Header{"X-Frame-Options": {"DENY"}},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			rw, err := newRewrite(tt.rules)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.Header = tt.header
+			rw.request(req)
+			require.Equal(t, tt.expectedURL, req.URL.String())
+			require.Equal(t, tt.expectedHost, req.Host)
+			require.Equal(t, tt.expectedHeader, req.Header)
+
+			resp := &http.Response{Request: req, Header: http.Header{"Server": {"upstream"}}}
+			require.NoError(t, rw.response(resp))
+			require.Equal(t, tt.responseHeader, resp.Header)
+		})
+	}
+}
@@ -2,9 +2,11 @@ package http
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"net/http/httputil"
+	"strings"
 	"sync"
 
 	"github.com/go-chi/chi"
@@ -12,6 +14,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/pipehub/pipehub/internal"
+	"github.com/pipehub/pipehub/internal/infra/log"
 )
 
 type serverHandlerFetcher interface {
@@ -19,17 +22,48 @@ type serverHandlerFetcher interface {
 	Handler(id string) (func(http.ResponseWriter, *http.Request), error)
 }
 
+type serverPipeHealth interface {
+	Health(ctx context.Context) map[string]error
+}
+
+type serverStore interface {
+	Get(namespace, key string) ([]byte, bool, error)
+	Delete(namespace, key string) error
+	Keys(namespace string) ([]string, error)
+	Namespaces() ([]string, error)
+}
+
 // ServerConfig has all the configuration needed to start a server.
 type ServerConfig struct {
 	// At the HTTP server a error can occur in a async manner. This function is used track this kind
 	// of error and allow actions to be taken.
 	AsyncErrorHandler func(error)
 
-	Port           int
-	Host           []internal.Host
-	DefaultAction  ServerConfigDefaultAction
+	Logger        *log.Logger
+	Port          int
+	TLS           ServerConfigTLS
+	HTTPSRedirect ServerConfigHTTPSRedirect
+
+	// TrustedProxies are the networks allowed to set the client IP with the 'X-Forwarded-For' header.
+	TrustedProxies []string
+
+	Host          []internal.Host
+	DefaultAction ServerConfigDefaultAction
+	AccessLog     ServerConfigAccessLog
+	RequestID     ServerConfigRequestID
+	Admin         ServerConfigAdmin
+	Recovery      ServerConfigRecovery
+
+	// RateLimitStore is used by the hosts with rate limit, if not set, the state is kept in memory.
+	RateLimitStore RateLimitStore
 	HandlerFetcher serverHandlerFetcher
 	RoundTripper   http.RoundTripper
+
+	// PipeHealth is used by the admin API to report the health of the pipes.
+	PipeHealth serverPipeHealth
+
+	// Store is the pipes store, it's inspected at the admin API.
+	Store serverStore
 }
 
 // ServerConfigDefaultAction has the configuration needed to set the default actions at the server.
@@ -40,8 +74,28 @@ type ServerConfigDefaultAction struct {
 
 // Server expose a HTTP server.
 type Server struct {
-	config ServerConfig
-	base   *http.Server
+	config    ServerConfig
+	base      *http.Server
+	admin     *http.Server
+	adminMux  *chi.Mux
+	accessLog *accessLog
+	requestID *requestID
+	caches    map[string]*cache
+	tls       *tls.Config
+	tlsCert   *tlsCertificate
+
+	trustedProxies *trustedProxies
+	accessControls []*accessControl
+	redirect       redirect
+	httpsRedirect  *httpsRedirect
+	plain          *http.Server
+	maintenance    *maintenance
+	mirrors        map[string]*mirror
+	splits         map[string]*split
+
+	// recovery fetch the pipes functions with the panic recovery, only the panic action is fetched
+	// directly from the handler fetcher.
+	recovery *recovery
 }
 
 // Start the server.
@@ -49,6 +103,16 @@ func (s *Server) Start() error {
 	// Initialize the mux with its default handlers.
 	mux := chi.NewRouter()
 
+	// The client IP is resolved before the access log, this way the real IP is logged.
+	if s.trustedProxies != nil {
+		mux.Use(s.trustedProxies.middleware)
+	}
+
+	// The access log must be the first middleware to measure the whole request.
+	if s.accessLog != nil {
+		mux.Use(s.accessLog.middleware)
+	}
+
 	if err := s.initHandlerNotFound(mux); err != nil {
 		return errors.Wrap(err, "not found middleware initialization error")
 	}
@@ -57,6 +121,18 @@ func (s *Server) Start() error {
 		return errors.Wrap(err, "panic middleware initialization error")
 	}
 
+	if (s.tls != nil) && (s.tls.ClientAuth != tls.NoClientCert) {
+		mux.Use(tlsClientIdentity)
+	}
+
+	// The redirects are answered before the request is dispatched to the hosts.
+	if s.httpsRedirect != nil {
+		mux.Use(s.httpsRedirect.middleware)
+	}
+	if len(s.redirect.hosts) > 0 {
+		mux.Use(s.redirect.middleware)
+	}
+
 	// Initialize all needed logic to direct the traffic to a pipe.
 	pipeMux, err := s.genPipeMux()
 	if err != nil {
@@ -66,26 +142,107 @@ func (s *Server) Start() error {
 
 	// At this step, the mux is ready to receive requests.
 	s.base = &http.Server{
-		Addr:    fmt.Sprintf(":%d", s.config.Port),
-		Handler: mux,
+		Addr:      fmt.Sprintf(":%d", s.config.Port),
+		Handler:   mux,
+		TLSConfig: s.tls,
 	}
 
 	// Note that we're using the async error handler to catch any kind of listen errors. This is
 	// needed because the listen call blocks, to avoid this issue, the whole call is inside a
 	// goroutine. The async error handler is the only way to expose the error a listen may have.
+	s.config.Logger.Info("http server listening", "addr", s.base.Addr, "tls", s.tls != nil)
 	go func() {
-		if err := s.base.ListenAndServe(); err != http.ErrServerClosed {
+		listen := s.base.ListenAndServe
+		if s.tls != nil {
+			// The certificate is already at the TLS config.
+			listen = func() error { return s.base.ListenAndServeTLS("", "") }
+		}
+
+		if err := listen(); err != http.ErrServerClosed {
 			err = errors.Wrapf(err, "server listen error at addr '%s'", s.base.Addr)
 			s.config.AsyncErrorHandler(err)
 		}
 	}()
 
+	// The plain HTTP listener share the mux with the TLS one, the requests are redirected by the
+	// https redirect middleware.
+	if s.httpsRedirect != nil {
+		s.plain = &http.Server{
+			Addr:    fmt.Sprintf(":%d", s.config.HTTPSRedirect.Port),
+			Handler: mux,
+		}
+		s.config.Logger.Info("http redirect server listening", "addr", s.plain.Addr)
+		go func() {
+			if err := s.plain.ListenAndServe(); err != http.ErrServerClosed {
+				err = errors.Wrapf(err, "redirect server listen error at addr '%s'", s.plain.Addr)
+				s.config.AsyncErrorHandler(err)
+			}
+		}()
+	}
+
+	s.startAdmin()
 	return nil
 }
 
 // Stop the server.
 func (s *Server) Stop(ctx context.Context) error {
-	return s.base.Shutdown(ctx)
+	if err := s.base.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	if s.plain != nil {
+		if err := s.plain.Shutdown(ctx); err != nil {
+			return errors.Wrap(err, "redirect server shutdown error")
+		}
+	}
+
+	if s.admin != nil {
+		if err := s.admin.Shutdown(ctx); err != nil {
+			return errors.Wrap(err, "admin server shutdown error")
+		}
+	}
+
+	for host, mirror := range s.mirrors {
+		if err := mirror.wait(ctx); err != nil {
+			return errors.Wrapf(err, "mirror of host '%s' wait error", host)
+		}
+	}
+
+	if s.accessLog != nil {
+		if err := s.accessLog.writer.Close(); err != nil {
+			return errors.Wrap(err, "access log close error")
+		}
+	}
+	return nil
+}
+
+// Reopen the log files and reload the TLS certificate and the access control files. It should be
+// called after the files are rotated or changed. A failure at one of them don't stop the others,
+// the errors are combined.
+func (s *Server) Reopen() error {
+	var errs []string
+	if s.accessLog != nil {
+		if err := s.accessLog.writer.Reopen(); err != nil {
+			errs = append(errs, errors.Wrap(err, "access log reopen error").Error())
+		}
+	}
+
+	if s.tlsCert != nil {
+		if err := s.tlsCert.load(); err != nil {
+			errs = append(errs, errors.Wrap(err, "tls certificate reload error").Error())
+		}
+	}
+
+	for _, accessControl := range s.accessControls {
+		if err := accessControl.reload(); err != nil {
+			errs = append(errs, errors.Wrap(err, "access control reload error").Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
 }
 
 func (s *Server) init() error {
@@ -93,6 +250,76 @@ func (s *Server) init() error {
 		return errors.New("missing 'AsyncErrorHandler'")
 	}
 
+	if s.config.AccessLog.Format != "" {
+		var err error
+		s.accessLog, err = newAccessLog(s.config.AccessLog, s.config.Logger)
+		if err != nil {
+			return errors.Wrap(err, "access log initialization error")
+		}
+	}
+
+	if (s.config.TLS.Cert != "") || (s.config.TLS.Key != "") {
+		var err error
+		s.tls, s.tlsCert, err = newServerTLSConfig(s.config.TLS)
+		if err != nil {
+			return errors.Wrap(err, "tls initialization error")
+		}
+	}
+
+	if len(s.config.TrustedProxies) > 0 {
+		var err error
+		s.trustedProxies, err = newTrustedProxies(s.config.TrustedProxies)
+		if err != nil {
+			return errors.Wrap(err, "trusted proxies initialization error")
+		}
+	}
+
+	if s.config.HTTPSRedirect.Port > 0 {
+		if s.tls == nil {
+			return errors.New("the https redirect requires the tls to be configured")
+		}
+
+		var err error
+		s.httpsRedirect, err = newHTTPSRedirect(s.config.HTTPSRedirect, s.config.Port)
+		if err != nil {
+			return errors.Wrap(err, "https redirect initialization error")
+		}
+	}
+
+	var err error
+	s.redirect, err = newRedirect(s.config.Host)
+	if err != nil {
+		return errors.Wrap(err, "redirect initialization error")
+	}
+
+	s.maintenance, err = newMaintenance(s.config.Host)
+	if err != nil {
+		return errors.Wrap(err, "maintenance initialization error")
+	}
+
+	propagate := s.config.DefaultAction.Panic != ""
+	s.recovery, err = newRecovery(s.config.Recovery, s.config.HandlerFetcher, propagate, s.config.Logger)
+	if err != nil {
+		return errors.Wrap(err, "recovery initialization error")
+	}
+
+	s.caches = make(map[string]*cache)
+	s.mirrors = make(map[string]*mirror)
+	s.splits = make(map[string]*split)
+	s.initAdmin()
+
+	if s.config.RateLimitStore == nil {
+		s.config.RateLimitStore = newRateLimitMemoryStore()
+	}
+
+	if s.config.RequestID.Header != "" {
+		var err error
+		s.requestID, err = newRequestID(s.config.RequestID, s.config.Logger)
+		if err != nil {
+			return errors.Wrap(err, "request id initialization error")
+		}
+	}
+
 	return nil
 }
 
@@ -102,7 +329,7 @@ func (s *Server) initHandlerNotFound(mux *chi.Mux) error {
 		return nil
 	}
 
-	fn, err := s.config.HandlerFetcher.Handler(fnName)
+	fn, err := s.recovery.Handler(fnName)
 	if err != nil {
 		return errors.Wrapf(err, "fetch handler '%s' error", fnName)
 	}
@@ -127,7 +354,7 @@ func (s *Server) initHandlerPanic(mux *chi.Mux) error {
 func (s *Server) genPipeMux() (map[string]*chi.Mux, error) {
 	pipes := make(map[string]*chi.Mux)
 	for _, host := range s.config.Host {
-		proxy, err := s.initProxy(host.Handler)
+		proxy, err := s.initProxy(host)
 		if err != nil {
 			return nil, errors.Wrapf(err, "init proxy error for handler '%s'", host.Endpoint)
 		}
@@ -144,13 +371,30 @@ func (Server) initPipeMux(mux *chi.Mux, pipeMux map[string]*chi.Mux) {
 	mux.Mount("/", router)
 }
 
-func (s *Server) initProxy(handlerID string) (*chi.Mux, error) {
+func (s *Server) initProxy(host internal.Host) (*chi.Mux, error) {
+	handlerID := host.Handler
+
+	rewrite, err := newRewrite(host.Rewrite)
+	if err != nil {
+		return nil, errors.Wrap(err, "rewrite initialization error")
+	}
+
 	director := func(req *http.Request) {
 		req.Header.Set("X-Forwarded-Host", req.Header.Get("Host"))
+		rewrite.request(req)
+
+		if record := accessLogRecordFromContext(req.Context()); record != nil {
+			record.upstream = req.URL.Host
+			if req.URL.Scheme != "" {
+				record.upstream = req.URL.Scheme + "://" + req.URL.Host
+			}
+		}
 	}
 	proxy := &httputil.ReverseProxy{
-		Director:  director,
-		Transport: s.config.RoundTripper,
+		Director:       director,
+		Transport:      s.config.RoundTripper,
+		ErrorHandler:   s.proxyErrorHandler,
+		ModifyResponse: rewrite.response,
 		BufferPool: &bufferPool{
 			pool: sync.Pool{
 				New: func() interface{} {
@@ -159,23 +403,169 @@ func (s *Server) initProxy(handlerID string) (*chi.Mux, error) {
 			},
 		},
 	}
-	proxyHandler := http.HandlerFunc(proxy.ServeHTTP)
+	var proxyHandler http.Handler = http.HandlerFunc(proxy.ServeHTTP)
+	if host.Static != nil {
+		static, err := newStatic(*host.Static)
+		if err != nil {
+			return nil, errors.Wrap(err, "static initialization error")
+		}
+		proxyHandler = static
+	}
+	if host.Mirror != nil {
+		mirror, err := newMirror(*host.Mirror, s.config.RoundTripper, s.config.Logger.With("host", host.Endpoint))
+		if err != nil {
+			return nil, errors.Wrap(err, "mirror initialization error")
+		}
+		s.mirrors[host.Endpoint] = mirror
+		proxyHandler = mirror.handler(proxyHandler)
+	}
+	if host.Cache != nil {
+		if err := s.initCache(host); err != nil {
+			return nil, errors.Wrap(err, "cache initialization error")
+		}
+		proxyHandler = s.caches[host.Endpoint].handler(proxyHandler)
+	}
 
-	pipeHandler, err := s.config.HandlerFetcher.Middleware(handlerID)
-	if err != nil {
-		return nil, errors.Wrapf(err, "fetch handler '%s' error", handlerID)
+	// The handler is optional when the files are served by the static handler or the traffic is split
+	// between variants.
+	var pipeHandler func(http.Handler) http.Handler
+	if handlerID != "" {
+		pipeHandler, err = s.recovery.Middleware(handlerID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fetch handler '%s' error", handlerID)
+		}
+	}
+
+	var split *split
+	if host.Split != nil {
+		split, err = newSplit(*host.Split, s.recovery)
+		if err != nil {
+			return nil, errors.Wrap(err, "split initialization error")
+		}
+		s.splits[host.Endpoint] = split
+	}
+
+	var rateLimit *rateLimit
+	if host.RateLimit != nil {
+		rateLimit, err = newRateLimit(
+			host.Endpoint, *host.RateLimit, host.Auth, s.config.RateLimitStore, s.config.Logger,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "rate limit initialization error")
+		}
+	}
+
+	var accessControl *accessControl
+	if host.AccessControl != nil {
+		accessControl, err = newAccessControl(*host.AccessControl, s.recovery)
+		if err != nil {
+			return nil, errors.Wrap(err, "access control initialization error")
+		}
+		s.accessControls = append(s.accessControls, accessControl)
+	}
+
+	var cors *cors
+	if host.CORS != nil {
+		c, err := newCORS(*host.CORS)
+		if err != nil {
+			return nil, errors.Wrap(err, "cors initialization error")
+		}
+		cors = &c
+	}
+
+	var auth *auth
+	if host.Auth != nil {
+		auth, err = newAuth(*host.Auth, s.config.Logger)
+		if err != nil {
+			return nil, errors.Wrap(err, "auth initialization error")
+		}
+	}
+
+	var requestBody *requestBody
+	if host.RequestBody != nil {
+		rb := newRequestBody(*host.RequestBody, s.config.Logger)
+		requestBody = &rb
+	}
+
+	var compression *compression
+	if host.Compression != nil {
+		compression, err = newCompression(*host.Compression)
+		if err != nil {
+			return nil, errors.Wrap(err, "compression initialization error")
+		}
 	}
 
 	mux := chi.NewRouter()
 	if err := s.initHandlerPanic(mux); err != nil {
 		return nil, errors.Wrap(err, "init panic handler error")
 	}
-	mux.Use(pipeHandler)
+	mux.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if record := accessLogRecordFromContext(r.Context()); record != nil {
+				record.handler = handlerID
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	if s.requestID != nil {
+		mux.Use(s.requestID.middleware)
+	}
+	mux.Use(s.maintenance.middleware(host.Endpoint))
+	if accessControl != nil {
+		mux.Use(accessControl.middleware)
+	}
+	if cors != nil {
+		mux.Use(cors.middleware)
+	}
+	if (rateLimit != nil) && !rateLimit.afterAuth() && !rateLimit.afterPipes() {
+		mux.Use(rateLimit.middleware)
+	}
+	if auth != nil {
+		mux.Use(auth.middleware)
+	}
+	if (rateLimit != nil) && rateLimit.afterAuth() {
+		mux.Use(rateLimit.middleware)
+	}
+	if requestBody != nil {
+		mux.Use(requestBody.middleware)
+	}
+	if compression != nil {
+		mux.Use(compression.middleware)
+	}
+	if pipeHandler != nil {
+		mux.Use(pipeHandler)
+	}
+	if split != nil {
+		mux.Use(split.middleware)
+	}
+	if (rateLimit != nil) && rateLimit.afterPipes() {
+		mux.Use(rateLimit.middleware)
+	}
 	mux.Mount("/", proxyHandler)
 
 	return mux, nil
 }
 
+// proxyErrorHandler is called when the upstream request fails. The request body limit is checked
+// because, when the body is streamed, it's only detected while the proxy send the body.
+func (s *Server) proxyErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	if requestBodyExceeded(r.Context()) {
+		w.Header().Set("Connection", "close")
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if r.Context().Err() == context.Canceled {
+		// The client gave up, there is nothing to answer.
+		return
+	}
+
+	s.config.Logger.Error(
+		"proxy error", "error", err, "host", r.Host, "request_id", requestIDFromContext(r.Context()),
+	)
+	w.WriteHeader(http.StatusBadGateway)
+}
+
 // NewServer return a configured server.
 // nolint: gocritic
 func NewServer(config ServerConfig) (Server, error) {
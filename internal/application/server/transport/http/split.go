@@ -0,0 +1,285 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+type splitVariant struct {
+	name      string
+	handler   string
+	upstreams []*url.URL
+	next      uint64
+	pipe      func(http.Handler) http.Handler
+}
+
+// middleware send the request to the variant pipe or point it to one of the variant upstreams.
+func (sv *splitVariant) middleware(next http.Handler) http.Handler {
+	if sv.pipe != nil {
+		return sv.pipe(next)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream := sv.upstreams[atomic.AddUint64(&sv.next, 1)%uint64(len(sv.upstreams))]
+		r.URL.Scheme = upstream.Scheme
+		r.URL.Host = upstream.Host
+		next.ServeHTTP(w, r)
+	})
+}
+
+// split distribute the requests of a host between the variants by their weights.
+type split struct {
+	cookie         string
+	header         string
+	overrideHeader string
+	variants       []*splitVariant
+
+	mutex   sync.RWMutex
+	weights []int
+	random  func(int64) int64
+}
+
+func (sp *split) middleware(next http.Handler) http.Handler {
+	handlers := make([]http.Handler, len(sp.variants))
+	for i, variant := range sp.variants {
+		handlers[i] = variant.middleware(next)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i, sticky := sp.choose(r)
+		variant := sp.variants[i]
+		if (sp.cookie != "") && !sticky {
+			http.SetCookie(w, &http.Cookie{Name: sp.cookie, Value: variant.name, Path: "/", HttpOnly: true})
+		}
+
+		if record := accessLogRecordFromContext(r.Context()); (record != nil) && (variant.handler != "") {
+			record.handler = variant.handler
+		}
+		handlers[i].ServeHTTP(w, r)
+	})
+}
+
+// choose return the index of the variant and if the choice came from the override header or the
+// cookie. A variant without weight is only chosen by the override header, this way a rollback also
+// move the clients with the cookie.
+func (sp *split) choose(r *http.Request) (int, bool) {
+	weights := sp.getWeights()
+
+	if sp.overrideHeader != "" {
+		if i, ok := sp.index(r.Header.Get(sp.overrideHeader)); ok {
+			return i, true
+		}
+	}
+
+	if sp.cookie != "" {
+		if cookie, err := r.Cookie(sp.cookie); err == nil {
+			if i, ok := sp.index(cookie.Value); ok && (weights[i] > 0) {
+				return i, true
+			}
+		}
+	}
+
+	var total int64
+	for _, weight := range weights {
+		total += int64(weight)
+	}
+
+	var n int64
+	if value := r.Header.Get(sp.header); (sp.header != "") && (value != "") {
+		hash := fnv.New32a()
+		hash.Write([]byte(value)) // nolint: errcheck
+		n = int64(hash.Sum32()) % total
+	} else {
+		n = sp.random(total)
+	}
+
+	for i, weight := range weights {
+		if n < int64(weight) {
+			return i, false
+		}
+		n -= int64(weight)
+	}
+	return len(weights) - 1, false
+}
+
+func (sp *split) index(name string) (int, bool) {
+	if name == "" {
+		return 0, false
+	}
+	for i, variant := range sp.variants {
+		if variant.name == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (sp *split) getWeights() []int {
+	sp.mutex.RLock()
+	defer sp.mutex.RUnlock()
+	return sp.weights
+}
+
+// setWeights replace the weights by variant name, the variants not present keep their weights.
+func (sp *split) setWeights(changes map[string]int) error {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+
+	weights := make([]int, len(sp.weights))
+	copy(weights, sp.weights)
+	for name, weight := range changes {
+		i, ok := sp.index(name)
+		if !ok {
+			return fmt.Errorf("variant '%s' not found", name)
+		}
+		weights[i] = weight
+	}
+	if err := splitValidWeights(weights); err != nil {
+		return err
+	}
+
+	sp.weights = weights
+	return nil
+}
+
+// state return the weights by variant name.
+func (sp *split) state() map[string]int {
+	weights := sp.getWeights()
+	state := make(map[string]int, len(weights))
+	for i, variant := range sp.variants {
+		state[variant.name] = weights[i]
+	}
+	return state
+}
+
+// adminSplitGet return the weights of the host variants.
+func (s *Server) adminSplitGet(w http.ResponseWriter, r *http.Request) {
+	host := chi.URLParam(r, "host")
+	sp, ok := s.splits[host]
+	if !ok {
+		http.Error(w, fmt.Sprintf("host '%s' don't have split", host), http.StatusNotFound)
+		return
+	}
+	s.adminSplitWrite(w, sp)
+}
+
+// adminSplitSet change the weights of the host variants. The body is a JSON object with the variant
+// names as keys and the weights as values.
+func (s *Server) adminSplitSet(w http.ResponseWriter, r *http.Request) {
+	host := chi.URLParam(r, "host")
+	sp, ok := s.splits[host]
+	if !ok {
+		http.Error(w, fmt.Sprintf("host '%s' don't have split", host), http.StatusNotFound)
+		return
+	}
+
+	var changes map[string]int
+	if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+		http.Error(w, fmt.Sprintf("invalid payload: %s", err), http.StatusBadRequest)
+		return
+	}
+	if err := sp.setWeights(changes); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.config.Logger.Info("split weights changed", "host", host, "weights", sp.state())
+	s.adminSplitWrite(w, sp)
+}
+
+func (s *Server) adminSplitWrite(w http.ResponseWriter, sp *split) {
+	payload, err := json.Marshal(sp.state())
+	if err != nil {
+		s.config.Logger.Error("split weights error", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(payload) // nolint: errcheck
+}
+
+func splitValidWeights(weights []int) error {
+	var total int
+	for _, weight := range weights {
+		if weight < 0 {
+			return fmt.Errorf("invalid weight '%d', it can't be negative", weight)
+		}
+		total += weight
+	}
+	if total == 0 {
+		return errors.New("at least one variant must have weight")
+	}
+	return nil
+}
+
+func newSplit(config internal.HostSplit, fetcher serverHandlerFetcher) (*split, error) {
+	if len(config.Variants) == 0 {
+		return nil, errors.New("missing variants")
+	}
+
+	sp := &split{
+		cookie:         config.Cookie,
+		header:         config.Header,
+		overrideHeader: config.OverrideHeader,
+		random:         rand.Int63n, // nolint: gosec
+	}
+
+	names := make(map[string]struct{}, len(config.Variants))
+	for _, variantConfig := range config.Variants {
+		if variantConfig.Name == "" {
+			return nil, errors.New("missing variant name")
+		}
+		if _, ok := names[variantConfig.Name]; ok {
+			return nil, fmt.Errorf("duplicated variant '%s'", variantConfig.Name)
+		}
+		names[variantConfig.Name] = struct{}{}
+
+		variant := &splitVariant{name: variantConfig.Name, handler: variantConfig.Handler}
+		switch {
+		case (variantConfig.Handler != "") && (len(variantConfig.Upstream) > 0):
+			return nil, fmt.Errorf("variant '%s' can't have both handler and upstream", variant.name)
+		case variantConfig.Handler != "":
+			var err error
+			variant.pipe, err = fetcher.Middleware(variantConfig.Handler)
+			if err != nil {
+				return nil, errors.Wrapf(err, "fetch handler '%s' of variant '%s' error", variant.handler, variant.name)
+			}
+		case len(variantConfig.Upstream) > 0:
+			for _, rawUpstream := range variantConfig.Upstream {
+				upstream, err := url.Parse(rawUpstream)
+				if err != nil {
+					return nil, errors.Wrapf(err, "parse upstream '%s' of variant '%s' error", rawUpstream, variant.name)
+				}
+				if (upstream.Scheme != "http") && (upstream.Scheme != "https") {
+					return nil, fmt.Errorf(
+						"invalid upstream '%s' of variant '%s', expected an absolute http or https url",
+						rawUpstream, variant.name,
+					)
+				}
+				variant.upstreams = append(variant.upstreams, upstream)
+			}
+		default:
+			return nil, fmt.Errorf("variant '%s' must have a handler or an upstream", variant.name)
+		}
+
+		sp.variants = append(sp.variants, variant)
+		sp.weights = append(sp.weights, variantConfig.Weight)
+	}
+
+	if err := splitValidWeights(sp.weights); err != nil {
+		return nil, err
+	}
+	return sp, nil
+}
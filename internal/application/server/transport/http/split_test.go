@@ -0,0 +1,116 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+func TestSplit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		weights        map[string]int
+		random         int64
+		header         http.Header
+		expectedHost   string
+		expectedCookie string
+	}{
+		{
+			name:           "weighted first variant",
+			random:         94,
+			header:         http.Header{},
+			expectedHost:   "stable",
+			expectedCookie: "stable",
+		},
+		{
+			name:           "weighted second variant",
+			random:         95,
+			header:         http.Header{},
+			expectedHost:   "canary",
+			expectedCookie: "canary",
+		},
+		{
+			name:         "cookie",
+			random:       0,
+			header:       http.Header{"Cookie": {"variant=canary"}},
+			expectedHost: "canary",
+		},
+		{
+			name:           "cookie of a variant without weight",
+			weights:        map[string]int{"canary": 0},
+			random:         50,
+			header:         http.Header{"Cookie": {"variant=canary"}},
+			expectedHost:   "stable",
+			expectedCookie: "stable",
+		},
+		{
+			name:         "override",
+			weights:      map[string]int{"canary": 0},
+			random:       0,
+			header:       http.Header{"X-Variant": {"canary"}},
+			expectedHost: "canary",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sp, err := newSplit(internal.HostSplit{
+				Cookie:         "variant",
+				OverrideHeader: "X-Variant",
+				Variants: []internal.HostSplitVariant{
+					{Name: "stable", Upstream: []string{"http://stable"}, Weight: 95},
+					{Name: "canary", Upstream: []string{"http://canary"}, Weight: 5},
+				},
+			}, nil)
+			require.NoError(t, err)
+			sp.random = func(int64) int64 { return tt.random }
+			if tt.weights != nil {
+				require.NoError(t, sp.setWeights(tt.weights))
+			}
+
+			var host string
+			next := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) { host = r.URL.Host })
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header = tt.header
+			sp.middleware(next).ServeHTTP(w, r)
+			require.Equal(t, tt.expectedHost, host)
+
+			var cookie string
+			for _, c := range w.Result().Cookies() {
+				cookie = c.Value
+			}
+			require.Equal(t, tt.expectedCookie, cookie)
+		})
+	}
+}
+
+func TestSplitSetWeights(t *testing.T) {
+	t.Parallel()
+
+	sp, err := newSplit(internal.HostSplit{
+		Variants: []internal.HostSplitVariant{
+			{Name: "stable", Upstream: []string{"http://stable"}, Weight: 100},
+			{Name: "canary", Upstream: []string{"http://canary"}},
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	require.Error(t, sp.setWeights(map[string]int{"beta": 10}))
+	require.Error(t, sp.setWeights(map[string]int{"canary": -1}))
+	require.Error(t, sp.setWeights(map[string]int{"stable": 0}))
+	require.Equal(t, map[string]int{"stable": 100, "canary": 0}, sp.state())
+
+	require.NoError(t, sp.setWeights(map[string]int{"stable": 90, "canary": 10}))
+	require.Equal(t, map[string]int{"stable": 90, "canary": 10}, sp.state())
+}
@@ -0,0 +1,169 @@
+package http
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+// staticPrecompressed are the precompressed file extensions by encoding, in order of preference.
+var staticPrecompressed = []struct { // nolint: gochecknoglobals
+	encoding  string
+	extension string
+}{
+	{compressionBrotli, ".br"},
+	{compressionGzip, ".gz"},
+}
+
+// static serve the files from a directory. The directories are never listed and the hidden files and
+// directories, the ones starting with a dot, like '.env' and '.git', are never served.
+type static struct {
+	root          http.Dir
+	index         []string
+	spaFallback   string
+	cacheControl  string
+	precompressed bool
+}
+
+func (st static) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if (r.Method != http.MethodGet) && (r.Method != http.MethodHead) {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := path.Clean("/" + r.URL.Path)
+	if staticHidden(name) {
+		http.NotFound(w, r)
+		return
+	}
+
+	name, ok := st.resolve(name)
+	if !ok && (st.spaFallback != "") {
+		name, ok = st.resolve(path.Clean("/" + st.spaFallback))
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if st.cacheControl != "" {
+		w.Header().Set("Cache-Control", st.cacheControl)
+	}
+	st.serve(w, r, name)
+}
+
+// resolve return the name of the file to be served. The directories are resolved to its index file.
+func (st static) resolve(name string) (string, bool) {
+	info, ok := st.stat(name)
+	if !ok {
+		return "", false
+	}
+	if !info.IsDir() {
+		return name, true
+	}
+
+	for _, index := range st.index {
+		indexName := path.Join(name, index)
+		if info, ok := st.stat(indexName); ok && !info.IsDir() {
+			return indexName, true
+		}
+	}
+	return "", false
+}
+
+func (st static) stat(name string) (os.FileInfo, bool) {
+	f, err := st.root.Open(name)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close() // nolint: errcheck
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, false
+	}
+	return info, true
+}
+
+// serve write the file, or its precompressed version, to the response. The content type is set from
+// the original file extension, otherwise it would be detected from the compressed content.
+func (st static) serve(w http.ResponseWriter, r *http.Request, name string) {
+	header := w.Header()
+	if contentType := mime.TypeByExtension(filepath.Ext(name)); contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	target := name
+	if st.precompressed {
+		header.Add("Vary", "Accept-Encoding")
+		for _, precompressed := range staticPrecompressed {
+			c := compression{algorithms: []string{precompressed.encoding}}
+			if c.negotiate(r.Header.Get("Accept-Encoding")) == "" {
+				continue
+			}
+			if info, ok := st.stat(name + precompressed.extension); ok && !info.IsDir() {
+				target = name + precompressed.extension
+				header.Set("Content-Encoding", precompressed.encoding)
+				break
+			}
+		}
+	}
+
+	f, err := st.root.Open(target)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close() // nolint: errcheck
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// staticHidden check if any segment of the path starts with a dot.
+func staticHidden(name string) bool {
+	for _, segment := range strings.Split(name, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+func newStatic(config internal.HostStatic) (*static, error) {
+	if config.Root == "" {
+		return nil, errors.New("missing root")
+	}
+
+	info, err := os.Stat(config.Root)
+	if err != nil {
+		return nil, errors.Wrapf(err, "root '%s' error", config.Root)
+	}
+	if !info.IsDir() {
+		return nil, errors.Errorf("root '%s' is not a directory", config.Root)
+	}
+
+	st := &static{
+		root:          http.Dir(config.Root),
+		index:         config.Index,
+		spaFallback:   strings.TrimSpace(config.SPAFallback),
+		cacheControl:  config.CacheControl,
+		precompressed: config.Precompressed,
+	}
+	if len(st.index) == 0 {
+		st.index = []string{"index.html"}
+	}
+	return st, nil
+}
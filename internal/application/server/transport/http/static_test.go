@@ -0,0 +1,193 @@
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipehub/pipehub/internal"
+)
+
+func TestStatic(t *testing.T) {
+	t.Parallel()
+
+	root, err := ioutil.TempDir("", "pipehub-static")
+	require.NoError(t, err)
+	defer os.RemoveAll(root) // nolint: errcheck
+
+	files := map[string]string{
+		"index.html":        "index",
+		"app.js":            "app",
+		"app.js.gz":         "app gzip",
+		"docs/default.html": "docs",
+		"assets/.keep":      "",
+		".env":              "secret",
+		".git/config":       "secret",
+	}
+	for name, content := range files {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(name), 0o755))
+		require.NoError(t, ioutil.WriteFile(name, []byte(content), 0o600))
+	}
+
+	tests := []struct {
+		name            string
+		config          internal.HostStatic
+		method          string
+		target          string
+		acceptEncoding  string
+		status          int
+		body            string
+		contentType     string
+		contentEncoding string
+	}{
+		{
+			"file",
+			internal.HostStatic{},
+			http.MethodGet, "/app.js", "", http.StatusOK, "app", "text/javascript; charset=utf-8", "",
+		},
+		{
+			"index",
+			internal.HostStatic{},
+			http.MethodGet, "/", "", http.StatusOK, "index", "text/html; charset=utf-8", "",
+		},
+		{
+			"custom index",
+			internal.HostStatic{Index: []string{"default.html"}},
+			http.MethodGet, "/docs/", "", http.StatusOK, "docs", "text/html; charset=utf-8", "",
+		},
+		{
+			"directory without index",
+			internal.HostStatic{},
+			http.MethodGet, "/assets/", "", http.StatusNotFound, "404 page not found\n", "text/plain; charset=utf-8", "",
+		},
+		{
+			"not found",
+			internal.HostStatic{},
+			http.MethodGet, "/users/10", "", http.StatusNotFound, "404 page not found\n", "text/plain; charset=utf-8", "",
+		},
+		{
+			"spa fallback",
+			internal.HostStatic{SPAFallback: "index.html"},
+			http.MethodGet, "/users/10", "", http.StatusOK, "index", "text/html; charset=utf-8", "",
+		},
+		{
+			"traversal",
+			internal.HostStatic{},
+			http.MethodGet, "/../../etc/passwd", "", http.StatusNotFound, "404 page not found\n", "text/plain; charset=utf-8", "",
+		},
+		{
+			"hidden file",
+			internal.HostStatic{},
+			http.MethodGet, "/.env", "", http.StatusNotFound, "404 page not found\n", "text/plain; charset=utf-8", "",
+		},
+		{
+			"hidden directory",
+			internal.HostStatic{SPAFallback: "index.html"},
+			http.MethodGet, "/.git/config", "", http.StatusNotFound, "404 page not found\n", "text/plain; charset=utf-8", "",
+		},
+		{
+			"hidden file inside a directory",
+			internal.HostStatic{},
+			http.MethodGet, "/assets/.keep", "", http.StatusNotFound, "404 page not found\n", "text/plain; charset=utf-8", "",
+		},
+		{
+			"precompressed",
+			internal.HostStatic{Precompressed: true},
+			http.MethodGet, "/app.js", "br, gzip", http.StatusOK, "app gzip", "text/javascript; charset=utf-8", "gzip",
+		},
+		{
+			"precompressed not accepted",
+			internal.HostStatic{Precompressed: true},
+			http.MethodGet, "/app.js", "deflate", http.StatusOK, "app", "text/javascript; charset=utf-8", "",
+		},
+		{
+			"method not allowed",
+			internal.HostStatic{},
+			http.MethodPost, "/app.js", "", http.StatusMethodNotAllowed, "Method Not Allowed\n", "text/plain; charset=utf-8", "",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		// The subtests are not parallel because the root is removed when the test returns.
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Root = root
+			st, err := newStatic(tt.config)
+			require.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			st.ServeHTTP(w, r)
+			require.Equal(t, tt.status, w.Code)
+			require.Equal(t, tt.body, w.Body.String())
+			require.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+			require.Equal(t, tt.contentEncoding, w.Header().Get("Content-Encoding"))
+		})
+	}
+}
+
+func TestStaticPrecompressedRange(t *testing.T) {
+	t.Parallel()
+
+	root, err := ioutil.TempDir("", "pipehub-static")
+	require.NoError(t, err)
+	defer os.RemoveAll(root) // nolint: errcheck
+
+	files := map[string]string{
+		"style.css":    "plain style",
+		"style.css.br": "brotli style",
+		"style.css.gz": "gzip style",
+	}
+	for name, content := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0o600))
+	}
+
+	tests := []struct {
+		name            string
+		acceptEncoding  string
+		rangeHeader     string
+		status          int
+		body            string
+		contentEncoding string
+		contentRange    string
+	}{
+		{"brotli", "gzip, br", "bytes=0-5", http.StatusPartialContent, "brotli", "br", "bytes 0-5/12"},
+		{"gzip", "gzip", "bytes=5-", http.StatusPartialContent, "style", "gzip", "bytes 5-9/10"},
+		{"identity", "", "bytes=-5", http.StatusPartialContent, "style", "", "bytes 6-10/11"},
+		{"unsatisfiable", "br", "bytes=100-", http.StatusRequestedRangeNotSatisfiable, "", "br", "bytes */12"},
+	}
+
+	st, err := newStatic(internal.HostStatic{Root: root, Precompressed: true})
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		tt := tt
+		// The subtests are not parallel because the root is removed when the test returns.
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/style.css", nil)
+			r.Header.Set("Range", tt.rangeHeader)
+			if tt.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			st.ServeHTTP(w, r)
+			require.Equal(t, tt.status, w.Code)
+			require.Equal(t, tt.contentEncoding, w.Header().Get("Content-Encoding"))
+			require.Equal(t, tt.contentRange, w.Header().Get("Content-Range"))
+			require.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+			if tt.status == http.StatusPartialContent {
+				require.Equal(t, tt.body, w.Body.String())
+				require.Equal(t, "text/css; charset=utf-8", w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi"
+)
+
+// adminStoreNamespaces return the namespaces of the pipes store.
+func (s *Server) adminStoreNamespaces(w http.ResponseWriter, _ *http.Request) {
+	namespaces, err := s.config.Store.Namespaces()
+	if err != nil {
+		s.adminStoreError(w, err)
+		return
+	}
+	s.adminStoreWrite(w, struct {
+		Namespaces []string `json:"namespaces"`
+	}{namespaces})
+}
+
+// adminStoreKeys return the keys of a namespace.
+func (s *Server) adminStoreKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := s.config.Store.Keys(chi.URLParam(r, "namespace"))
+	if err != nil {
+		s.adminStoreError(w, err)
+		return
+	}
+	s.adminStoreWrite(w, struct {
+		Keys []string `json:"keys"`
+	}{keys})
+}
+
+// adminStoreGet return the value of a key as it was stored.
+func (s *Server) adminStoreGet(w http.ResponseWriter, r *http.Request) {
+	namespace, key, ok := adminStoreKey(w, r)
+	if !ok {
+		return
+	}
+	value, ok, err := s.config.Store.Get(namespace, key)
+	if err != nil {
+		s.adminStoreError(w, err)
+		return
+	}
+	if !ok {
+		http.Error(w, fmt.Sprintf("key '%s' not found at namespace '%s'", key, namespace), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(value) // nolint: errcheck
+}
+
+// adminStoreDelete remove a key.
+func (s *Server) adminStoreDelete(w http.ResponseWriter, r *http.Request) {
+	namespace, key, ok := adminStoreKey(w, r)
+	if !ok {
+		return
+	}
+	if err := s.config.Store.Delete(namespace, key); err != nil {
+		s.adminStoreError(w, err)
+		return
+	}
+
+	s.config.Logger.Info("store key deleted", "namespace", namespace, "key", key)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminStoreKey return the namespace and the key from the URL. The router match the escaped path when
+// the path has escaped characters, like '%2F', in this case the values are unescaped.
+func adminStoreKey(w http.ResponseWriter, r *http.Request) (namespace, key string, ok bool) {
+	namespace, key = chi.URLParam(r, "namespace"), chi.URLParam(r, "*")
+	if r.URL.RawPath != "" {
+		var errNamespace, errKey error
+		namespace, errNamespace = url.PathUnescape(namespace)
+		key, errKey = url.PathUnescape(key)
+		if (errNamespace != nil) || (errKey != nil) {
+			http.Error(w, "invalid namespace or key escape", http.StatusBadRequest)
+			return "", "", false
+		}
+	}
+
+	if key == "" {
+		http.Error(w, "missing key", http.StatusBadRequest)
+		return "", "", false
+	}
+	return namespace, key, true
+}
+
+func (s *Server) adminStoreWrite(w http.ResponseWriter, value interface{}) {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		s.adminStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(payload) // nolint: errcheck
+}
+
+func (s *Server) adminStoreError(w http.ResponseWriter, err error) {
+	s.config.Logger.Error("store error", "error", err)
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
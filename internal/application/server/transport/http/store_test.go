@@ -0,0 +1,111 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type adminStoreMemory struct {
+	mutex   sync.Mutex
+	entries map[string]map[string][]byte
+}
+
+func (s *adminStoreMemory) Get(namespace, key string) ([]byte, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	value, ok := s.entries[namespace][key]
+	return value, ok, nil
+}
+
+func (s *adminStoreMemory) Delete(namespace, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.entries[namespace], key)
+	return nil
+}
+
+func (s *adminStoreMemory) Keys(namespace string) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	keys := make([]string, 0, len(s.entries[namespace]))
+	for key := range s.entries[namespace] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (s *adminStoreMemory) Namespaces() ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	namespaces := make([]string, 0, len(s.entries))
+	for namespace := range s.entries {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+func TestServerAdminStore(t *testing.T) {
+	t.Parallel()
+
+	store := &adminStoreMemory{entries: map[string]map[string][]byte{
+		"auth@internal": {"session": []byte("alice"), "users/1": []byte("bob"), "a b": []byte("carol")},
+	}}
+	s := &Server{config: ServerConfig{Store: store}}
+	s.initAdmin()
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.adminMux.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		status int
+		body   string
+	}{
+		{"namespaces", http.MethodGet, "/store", http.StatusOK, `{"namespaces":["auth@internal"]}`},
+		{
+			"keys",
+			http.MethodGet, "/store/auth@internal",
+			http.StatusOK, `{"keys":["a b","session","users/1"]}`,
+		},
+		{"key", http.MethodGet, "/store/auth@internal/session", http.StatusOK, "alice"},
+		{"key with slash", http.MethodGet, "/store/auth@internal/users/1", http.StatusOK, "bob"},
+		{"escaped key", http.MethodGet, "/store/auth@internal/a%20b", http.StatusOK, "carol"},
+		{"escaped slash", http.MethodGet, "/store/auth%40internal/users%2F1", http.StatusOK, "bob"},
+		{
+			"unknown key",
+			http.MethodGet, "/store/auth@internal/users",
+			http.StatusNotFound, "key 'users' not found at namespace 'auth@internal'\n",
+		},
+		{"missing key", http.MethodGet, "/store/auth@internal/", http.StatusBadRequest, "missing key\n"},
+	}
+
+	// The subtests are not parallel as the key is deleted after them.
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(tt.method, tt.target)
+			require.Equal(t, tt.status, rec.Code)
+			if rec.Header().Get("Content-Type") == "application/json" {
+				require.JSONEq(t, tt.body, rec.Body.String())
+				return
+			}
+			require.Equal(t, tt.body, rec.Body.String())
+		})
+	}
+
+	require.Equal(t, http.StatusNoContent, serve(http.MethodDelete, "/store/auth@internal/users/1").Code)
+	_, ok, err := store.Get("auth@internal", "users/1")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
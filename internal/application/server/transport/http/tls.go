@@ -0,0 +1,195 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// Client certificate verification modes at the listener.
+const (
+	tlsClientAuthRequest          = "request"
+	tlsClientAuthRequire          = "require"
+	tlsClientAuthVerifyIfGiven    = "verify-if-given"
+	tlsClientAuthRequireAndVerify = "require-and-verify"
+)
+
+// ServerConfigTLS has the configuration needed to serve HTTPS.
+type ServerConfigTLS struct {
+	// Cert and Key are the paths of the PEM encoded certificate and key. The TLS is enabled when
+	// they're set.
+	Cert string
+	Key  string
+
+	// ClientCA is the path of the PEM encoded CA bundle used to verify the client certificates.
+	ClientCA string
+
+	// ClientAuth can be 'request', 'require', 'verify-if-given' or 'require-and-verify'. If not set
+	// and there is a client CA, 'require-and-verify' is used.
+	ClientAuth string
+
+	// MinVersion can be '1.0', '1.1', '1.2' or '1.3', the default is '1.2'.
+	MinVersion string
+}
+
+// ClientConfigTLS has the configuration used to connect to the upstreams.
+type ClientConfigTLS struct {
+	// CA is the path of the PEM encoded CA bundle used to verify the upstreams, if not set, the
+	// system pool is used.
+	CA string
+
+	// Cert and Key are the paths of the PEM encoded certificate and key presented to the upstreams.
+	Cert string
+	Key  string
+
+	ServerName         string
+	MinVersion         string
+	InsecureSkipVerify bool
+}
+
+// NewClientTLSConfig return the TLS configuration used to connect to the upstreams.
+func NewClientTLSConfig(config ClientConfigTLS) (*tls.Config, error) {
+	minVersion, err := parseTLSVersion(config.MinVersion)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse min version error")
+	}
+
+	cfg := &tls.Config{
+		MinVersion:         minVersion,
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify, // nolint: gosec
+	}
+
+	if config.CA != "" {
+		cfg.RootCAs, err = loadCertPool(config.CA)
+		if err != nil {
+			return nil, errors.Wrapf(err, "load ca '%s' error", config.CA)
+		}
+	}
+
+	if (config.Cert != "") || (config.Key != "") {
+		cert, err := tls.LoadX509KeyPair(config.Cert, config.Key)
+		if err != nil {
+			return nil, errors.Wrap(err, "load certificate error")
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// tlsCertificate keep the listener certificate, it can be reloaded without restart the server.
+type tlsCertificate struct {
+	cert  string
+	key   string
+	value atomic.Value
+}
+
+func (c *tlsCertificate) load() error {
+	cert, err := tls.LoadX509KeyPair(c.cert, c.key)
+	if err != nil {
+		return errors.Wrap(err, "load certificate error")
+	}
+	c.value.Store(&cert)
+	return nil
+}
+
+func (c *tlsCertificate) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.value.Load().(*tls.Certificate), nil
+}
+
+func newServerTLSConfig(config ServerConfigTLS) (*tls.Config, *tlsCertificate, error) {
+	minVersion, err := parseTLSVersion(config.MinVersion)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "parse min version error")
+	}
+
+	certificate := &tlsCertificate{cert: config.Cert, key: config.Key}
+	if err := certificate.load(); err != nil {
+		return nil, nil, err
+	}
+
+	cfg := &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: certificate.get,
+	}
+
+	if config.ClientCA != "" {
+		cfg.ClientCAs, err = loadCertPool(config.ClientCA)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "load client ca '%s' error", config.ClientCA)
+		}
+		if config.ClientAuth == "" {
+			config.ClientAuth = tlsClientAuthRequireAndVerify
+		}
+	}
+
+	switch config.ClientAuth {
+	case "":
+	case tlsClientAuthRequest:
+		cfg.ClientAuth = tls.RequestClientCert
+	case tlsClientAuthRequire:
+		cfg.ClientAuth = tls.RequireAnyClientCert
+	case tlsClientAuthVerifyIfGiven:
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	case tlsClientAuthRequireAndVerify:
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, nil, fmt.Errorf("invalid client auth '%s'", config.ClientAuth)
+	}
+
+	if (cfg.ClientAuth >= tls.VerifyClientCertIfGiven) && (cfg.ClientCAs == nil) {
+		return nil, nil, errors.New("the client ca is required to verify the client certificates")
+	}
+
+	return cfg, certificate, nil
+}
+
+// tlsClientIdentity store the verified client certificate at the request context. Certificates that
+// were not verified are ignored, they can't be trusted.
+func tlsClientIdentity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.TLS == nil) || (len(r.TLS.VerifiedChains) == 0) || (len(r.TLS.VerifiedChains[0]) == 0) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cert := r.TLS.VerifiedChains[0][0]
+		ctx := contextWithValue(r.Context(), contextKeyTLSClientCertificate, cert)
+		ctx = contextWithValue(ctx, contextKeyTLSClientSubject, cert.Subject.CommonName)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func parseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("invalid version '%s'", version)
+	}
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	payload, err := ioutil.ReadFile(path) // nolint: gosec
+	if err != nil {
+		return nil, errors.Wrap(err, "read file error")
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(payload) {
+		return nil, errors.New("no certificate found")
+	}
+	return pool, nil
+}
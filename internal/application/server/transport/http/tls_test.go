@@ -0,0 +1,155 @@
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSClientIdentity(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "pipehub-tls-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	ca, caKey := genTLSCertificate(t, dir, "ca", nil, nil)
+	genTLSCertificate(t, dir, "server", ca, caKey)
+	genTLSCertificate(t, dir, "client", ca, caKey)
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	serverTLS, certificate, err := newServerTLSConfig(ServerConfigTLS{
+		Cert:       path("server.pem"),
+		Key:        path("server-key.pem"),
+		ClientCA:   path("ca.pem"),
+		ClientAuth: tlsClientAuthVerifyIfGiven,
+	})
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(tlsClientIdentity(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			subject, _ := r.Context().Value(contextKeyTLSClientSubject).(string) // nolint: errcheck
+			w.Write([]byte(subject))                                             // nolint: errcheck
+		},
+	)))
+	// The test server only use the certificate function when there is no certificate.
+	cert, err := certificate.get(nil)
+	require.NoError(t, err)
+	server.TLS = serverTLS
+	server.TLS.Certificates = []tls.Certificate{*cert}
+	server.StartTLS()
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		config ClientConfigTLS
+		body   string
+	}{
+		{
+			"with client certificate",
+			ClientConfigTLS{CA: path("ca.pem"), Cert: path("client.pem"), Key: path("client-key.pem")},
+			"client",
+		},
+		{
+			"without client certificate",
+			ClientConfigTLS{CA: path("ca.pem")},
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		// The subtests are not parallel because the files are removed when the test function return.
+		t.Run(tt.name, func(t *testing.T) {
+			clientTLS, err := NewClientTLSConfig(tt.config)
+			require.NoError(t, err)
+
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+			resp, err := client.Get(server.URL)
+			require.NoError(t, err)
+			defer resp.Body.Close() // nolint: errcheck
+
+			body, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.Equal(t, tt.body, string(body))
+		})
+	}
+}
+
+// genTLSCertificate write the certificate and key at the directory. The certificate is self signed
+// if there is no parent.
+func genTLSCertificate(
+	t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey,
+) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".pem"), cert, 0600))
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+"-key.pem"), keyPEM, 0600))
+
+	parsed, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return parsed, key
+}
+
+func TestServerReopen(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "pipehub-reopen-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	accessLogPath := filepath.Join(dir, "access.log")
+	accessLog, err := newAccessLog(ServerConfigAccessLog{Format: accessLogFormatJSON, Output: accessLogPath}, nil)
+	require.NoError(t, err)
+	defer accessLog.writer.Close() // nolint: errcheck
+
+	s := Server{
+		accessLog: accessLog,
+		tlsCert:   &tlsCertificate{cert: filepath.Join(dir, "cert.pem"), key: filepath.Join(dir, "key.pem")},
+	}
+
+	// The access log is reopened even if the certificate fails to load.
+	require.NoError(t, os.Rename(accessLogPath, accessLogPath+".1"))
+	err = s.Reopen()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "tls certificate reload error")
+	require.FileExists(t, accessLogPath)
+}
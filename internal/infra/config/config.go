@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/hcl"
@@ -15,6 +16,7 @@ import (
 	"github.com/pipehub/pipehub/internal/application/server"
 	"github.com/pipehub/pipehub/internal/application/server/service/pipe"
 	transportHTTP "github.com/pipehub/pipehub/internal/application/server/transport/http"
+	"github.com/pipehub/pipehub/internal/infra/log"
 )
 
 // Config has the configuration needed by PipeHub.
@@ -28,12 +30,16 @@ type Config struct {
 func (c Config) ToGenerator() generator.ClientConfig {
 	var cfg generator.ClientConfig
 	for _, pipe := range c.Pipe {
-		cfg.Pipes = append(cfg.Pipes, generator.Pipe{
+		p := generator.Pipe{
 			Alias:      pipe.Alias,
 			ImportPath: pipe.Path,
 			Module:     pipe.Module,
 			Version:    pipe.Version,
-		})
+		}
+		for _, instance := range pipe.Instance {
+			p.Instances = append(p.Instances, instance.Name)
+		}
+		cfg.Pipes = append(cfg.Pipes, p)
 	}
 	return cfg
 }
@@ -50,24 +56,218 @@ func (c Config) ToServer() (server.ClientConfig, error) {
 	}
 
 	for _, http := range c.HTTP {
-		cfg.Transport.HTTP.Host = append(cfg.Transport.HTTP.Host, internal.Host{
+		host := internal.Host{
 			Endpoint: http.Endpoint,
 			Handler:  http.Handler,
-		})
+		}
+
+		if len(http.RateLimit) > 0 {
+			rateLimit := http.RateLimit[0]
+			host.RateLimit = &internal.HostRateLimit{
+				Algorithm: rateLimit.Algorithm,
+				Limit:     rateLimit.Limit,
+				Burst:     rateLimit.Burst,
+				Key:       rateLimit.Key,
+			}
+
+			var err error
+			host.RateLimit.Window, err = time.ParseDuration(rateLimit.Window)
+			if err != nil {
+				return cfg, errors.Wrapf(err, "parse duration '%s' error", rateLimit.Window)
+			}
+		}
+
+		if len(http.Cache) > 0 {
+			host.Cache = &internal.HostCache{
+				Store:        http.Cache[0].Store,
+				Path:         http.Cache[0].Path,
+				MaxSize:      http.Cache[0].MaxSize,
+				MaxEntrySize: http.Cache[0].MaxEntrySize,
+				StatusHeader: http.Cache[0].StatusHeader,
+			}
+		}
+
+		if len(http.Compression) > 0 {
+			host.Compression = &internal.HostCompression{
+				Algorithms:       http.Compression[0].Algorithms,
+				Types:            http.Compression[0].Types,
+				MinSize:          http.Compression[0].MinSize,
+				IdentityUpstream: http.Compression[0].IdentityUpstream,
+			}
+		}
+
+		if (http.MaxRequestBody > 0) || (len(http.RequestBuffering) > 0) {
+			host.RequestBody = &internal.HostRequestBody{MaxSize: http.MaxRequestBody}
+			if len(http.RequestBuffering) > 0 {
+				host.RequestBody.Buffer = true
+				host.RequestBody.BufferMemory = http.RequestBuffering[0].Memory
+				host.RequestBody.BufferPath = http.RequestBuffering[0].Path
+			}
+		}
+
+		if len(http.AccessControl) > 0 {
+			host.AccessControl = &internal.HostAccessControl{
+				Allow:   http.AccessControl[0].Allow,
+				Deny:    http.AccessControl[0].Deny,
+				File:    http.AccessControl[0].File,
+				Handler: http.AccessControl[0].Handler,
+			}
+		}
+
+		if len(http.CORS) > 0 {
+			cors := http.CORS[0]
+			host.CORS = &internal.HostCORS{
+				Origins:        cors.Origins,
+				Methods:        cors.Methods,
+				Headers:        cors.Headers,
+				ExposedHeaders: cors.ExposedHeaders,
+				Credentials:    cors.Credentials,
+			}
+
+			if cors.MaxAge != "" {
+				var err error
+				host.CORS.MaxAge, err = time.ParseDuration(cors.MaxAge)
+				if err != nil {
+					return cfg, errors.Wrapf(err, "parse duration '%s' error", cors.MaxAge)
+				}
+			}
+		}
+
+		for _, rewrite := range http.Rewrite {
+			host.Rewrite = append(host.Rewrite, rewrite.toHost())
+		}
+
+		for _, redirect := range http.Redirect {
+			host.Redirect = append(host.Redirect, internal.HostRedirect{
+				Match:  redirect.Match,
+				Target: redirect.Target,
+				Status: redirect.Status,
+			})
+		}
+
+		if len(http.Static) > 0 {
+			host.Static = &internal.HostStatic{
+				Root:          http.Static[0].Root,
+				Index:         http.Static[0].Index,
+				SPAFallback:   http.Static[0].SPAFallback,
+				CacheControl:  http.Static[0].CacheControl,
+				Precompressed: http.Static[0].Precompressed,
+			}
+		}
+
+		if len(http.Maintenance) > 0 {
+			maintenance := http.Maintenance[0]
+			host.Maintenance = &internal.HostMaintenance{
+				Page:    maintenance.Page,
+				Status:  maintenance.Status,
+				Enabled: maintenance.Enabled,
+			}
+
+			if maintenance.RetryAfter != "" {
+				var err error
+				host.Maintenance.RetryAfter, err = time.ParseDuration(maintenance.RetryAfter)
+				if err != nil {
+					return cfg, errors.Wrapf(err, "parse duration '%s' error", maintenance.RetryAfter)
+				}
+			}
+		}
+
+		if len(http.Mirror) > 0 {
+			mirror := http.Mirror[0]
+			host.Mirror = &internal.HostMirror{
+				Upstream:    mirror.Upstream,
+				Percentage:  mirror.Percentage,
+				MaxBodySize: mirror.MaxBodySize,
+				Concurrency: mirror.Concurrency,
+			}
+
+			if mirror.Timeout != "" {
+				var err error
+				host.Mirror.Timeout, err = time.ParseDuration(mirror.Timeout)
+				if err != nil {
+					return cfg, errors.Wrapf(err, "parse duration '%s' error", mirror.Timeout)
+				}
+			}
+		}
+
+		if len(http.Split) > 0 {
+			host.Split = &internal.HostSplit{
+				Cookie:         http.Split[0].Cookie,
+				Header:         http.Split[0].Header,
+				OverrideHeader: http.Split[0].OverrideHeader,
+			}
+			for _, variant := range http.Split[0].Variant {
+				host.Split.Variants = append(host.Split.Variants, internal.HostSplitVariant{
+					Name:     variant.Name,
+					Handler:  variant.Handler,
+					Upstream: variant.Upstream,
+					Weight:   variant.Weight,
+				})
+			}
+		}
+
+		if len(http.Auth) > 0 {
+			var err error
+			host.Auth, err = http.Auth[0].toHost()
+			if err != nil {
+				return cfg, errors.Wrap(err, "auth config error")
+			}
+		}
+		cfg.Transport.HTTP.Host = append(cfg.Transport.HTTP.Host, host)
 
 		cfg.Service.Pipe.HTTP.Entry = append(cfg.Service.Pipe.HTTP.Entry, pipe.HTTPConfigEntry{
 			Endpoint: http.Endpoint,
 			Handler:  http.Handler,
 		})
+
+		// The handlers used by the other features are also resolved at the start.
+		if host.AccessControl != nil {
+			cfg.Service.Pipe.HTTP.Entry = append(cfg.Service.Pipe.HTTP.Entry, pipe.HTTPConfigEntry{
+				Endpoint: http.Endpoint,
+				Handler:  host.AccessControl.Handler,
+			})
+		}
+		if host.Split != nil {
+			for _, variant := range host.Split.Variants {
+				cfg.Service.Pipe.HTTP.Entry = append(cfg.Service.Pipe.HTTP.Entry, pipe.HTTPConfigEntry{
+					Endpoint: http.Endpoint,
+					Handler:  variant.Handler,
+				})
+			}
+		}
+	}
+
+	timeouts, err := c.pipeTimeouts()
+	if err != nil {
+		return cfg, errors.Wrap(err, "pipe timeout error")
 	}
+	cfg.Service.Pipe.HTTP.Timeout = timeouts
 
 	for _, pipe := range c.Pipe {
-		cfg.Pipe = append(cfg.Pipe, internal.Pipe{
+		p := internal.Pipe{
 			ImportPath: pipe.Path,
 			Module:     pipe.Module,
 			Version:    pipe.Version,
 			Config:     pipe.Config,
-		})
+		}
+		for _, instance := range pipe.Instance {
+			p.Instances = append(p.Instances, internal.PipeInstance{Name: instance.Name, Config: instance.Config})
+		}
+
+		if len(pipe.Lifecycle) > 0 {
+			lifecycle := pipe.Lifecycle[0]
+			p.Lifecycle.StartFailure = lifecycle.StartFailure
+			p.Lifecycle.DependsOn = lifecycle.DependsOn
+
+			if lifecycle.StartTimeout != "" {
+				var err error
+				p.Lifecycle.StartTimeout, err = time.ParseDuration(lifecycle.StartTimeout)
+				if err != nil {
+					return cfg, errors.Wrapf(err, "parse duration '%s' error", lifecycle.StartTimeout)
+				}
+			}
+		}
+		cfg.Pipe = append(cfg.Pipe, p)
 	}
 
 	if (len(c.Core) > 0) && (len(c.Core[0].HTTP) > 0) && (len(c.Core[0].HTTP[0].Server) > 0) {
@@ -80,7 +280,77 @@ func (c Config) ToServer() (server.ClientConfig, error) {
 		}
 
 		if len(c.Core[0].HTTP[0].Server[0].Listen) > 0 {
-			cfg.Transport.HTTP.Port = c.Core[0].HTTP[0].Server[0].Listen[0].Port
+			listen := c.Core[0].HTTP[0].Server[0].Listen[0]
+			cfg.Transport.HTTP.Port = listen.Port
+			if len(listen.TLS) > 0 {
+				cfg.Transport.HTTP.TLS = transportHTTP.ServerConfigTLS{
+					Cert:       listen.TLS[0].Cert,
+					Key:        listen.TLS[0].Key,
+					ClientCA:   listen.TLS[0].ClientCA,
+					ClientAuth: listen.TLS[0].ClientAuth,
+					MinVersion: listen.TLS[0].MinVersion,
+				}
+			}
+		}
+
+		cfg.Transport.HTTP.TrustedProxies = c.Core[0].HTTP[0].Server[0].TrustedProxies
+
+		if len(c.Core[0].HTTP[0].Server[0].HTTPSRedirect) > 0 {
+			cfg.Transport.HTTP.HTTPSRedirect.Port = c.Core[0].HTTP[0].Server[0].HTTPSRedirect[0].Port
+			cfg.Transport.HTTP.HTTPSRedirect.Status = c.Core[0].HTTP[0].Server[0].HTTPSRedirect[0].Status
+		}
+
+		if len(c.Core[0].HTTP[0].Server[0].AccessLog) > 0 {
+			accessLog := c.Core[0].HTTP[0].Server[0].AccessLog[0]
+			cfg.Transport.HTTP.AccessLog.Format = accessLog.Format
+			cfg.Transport.HTTP.AccessLog.Fields = accessLog.Fields
+			cfg.Transport.HTTP.AccessLog.Output = accessLog.Output
+			if cfg.Transport.HTTP.AccessLog.Format == "" {
+				cfg.Transport.HTTP.AccessLog.Format = "common"
+			}
+		}
+
+		if len(c.Core[0].HTTP[0].Server[0].RequestID) > 0 {
+			requestID := c.Core[0].HTTP[0].Server[0].RequestID[0]
+			cfg.Transport.HTTP.RequestID.Header = requestID.Header
+			cfg.Transport.HTTP.RequestID.Format = requestID.Format
+			if cfg.Transport.HTTP.RequestID.Header == "" {
+				cfg.Transport.HTTP.RequestID.Header = "X-Request-ID"
+			}
+		}
+
+		if len(c.Core[0].HTTP[0].Server[0].Recovery) > 0 {
+			recovery := c.Core[0].HTTP[0].Server[0].Recovery[0]
+			cfg.Transport.HTTP.Recovery.DisableAfter = recovery.DisableAfter
+			if recovery.Window != "" {
+				window, err := time.ParseDuration(recovery.Window)
+				if err != nil {
+					return cfg, errors.Wrapf(err, "parse duration '%s' error", recovery.Window)
+				}
+				cfg.Transport.HTTP.Recovery.Window = window
+			}
+		}
+	}
+
+	if (len(c.Core) > 0) && (len(c.Core[0].Admin) > 0) {
+		if len(c.Core[0].Admin[0].Listen) > 0 {
+			cfg.Transport.HTTP.Admin.Address = c.Core[0].Admin[0].Listen[0].Address
+			cfg.Transport.HTTP.Admin.Port = c.Core[0].Admin[0].Listen[0].Port
+		}
+		cfg.Transport.HTTP.Admin.Debug = c.Core[0].Admin[0].Debug
+	}
+
+	if (len(c.Core) > 0) && (len(c.Core[0].Store) > 0) {
+		s := c.Core[0].Store[0]
+		cfg.Service.Store.Driver = s.Driver
+		cfg.Service.Store.Path = s.Path
+		cfg.Service.Store.Sync = s.Sync
+		if s.CleanupInterval != "" {
+			var err error
+			cfg.Service.Store.CleanupInterval, err = time.ParseDuration(s.CleanupInterval)
+			if err != nil {
+				return cfg, errors.Wrapf(err, "parse duration '%s' error", s.CleanupInterval)
+			}
 		}
 	}
 
@@ -110,12 +380,37 @@ func (c Config) ToServer() (server.ClientConfig, error) {
 			return cfg, errors.Wrapf(err, "parse duration '%s' error", client.TLSHandshakeTimeout)
 		}
 
+		if len(client.TLS) > 0 {
+			t.TLSClientConfig, err = transportHTTP.NewClientTLSConfig(transportHTTP.ClientConfigTLS{
+				CA:                 client.TLS[0].CA,
+				Cert:               client.TLS[0].Cert,
+				Key:                client.TLS[0].Key,
+				ServerName:         client.TLS[0].ServerName,
+				MinVersion:         client.TLS[0].MinVersion,
+				InsecureSkipVerify: client.TLS[0].InsecureSkipVerify,
+			})
+			if err != nil {
+				return cfg, errors.Wrap(err, "client tls config error")
+			}
+		}
+
 		cfg.Transport.HTTP.RoundTripper = &t
 	}
 
 	return cfg, nil
 }
 
+// ToLogger generate the config struct needed to initialize the logger.
+func (c Config) ToLogger() log.LoggerConfig {
+	var cfg log.LoggerConfig
+	if (len(c.Core) > 0) && (len(c.Core[0].Log) > 0) {
+		cfg.Level = c.Core[0].Log[0].Level
+		cfg.Format = c.Core[0].Log[0].Format
+		cfg.Output = c.Core[0].Log[0].Output
+	}
+	return cfg
+}
+
 // CtxShutdown return a configured context with timeout.
 func (c Config) CtxShutdown() (context.Context, func(), error) {
 	if (len(c.Core) == 0) || (c.Core[0].GracefulShutdown == "") {
@@ -169,25 +464,448 @@ func (c Config) valid() error {
 			return err
 		}
 	}
+
+	for _, http := range c.HTTP {
+		if err := http.valid(); err != nil {
+			return errors.Wrapf(err, "invalid http '%s'", http.Endpoint)
+		}
+	}
+
+	for _, pipe := range c.Pipe {
+		if err := pipe.valid(); err != nil {
+			return errors.Wrapf(err, "invalid pipe '%s'", pipe.Path)
+		}
+	}
 	return nil
 }
 
 type configPipe struct {
-	Path    string
-	Version string
-	Alias   string
-	Module  string
-	Config  map[string]interface{}
+	Path      string
+	Version   string
+	Alias     string
+	Module    string
+	Config    map[string]interface{}
+	Lifecycle []configPipeLifecycle
+	Instance  []configPipeInstance
+	Timeout   []configPipeTimeout
+}
+
+// handlers return the handlers of a pipe function, one per instance if the pipe has instances.
+func (c configPipe) handlers(fn string) []string {
+	alias := c.Alias
+	if alias == "" {
+		fragments := strings.Split(c.Path, "/")
+		alias = fragments[len(fragments)-1]
+	}
+
+	if len(c.Instance) == 0 {
+		return []string{alias + "." + fn}
+	}
+	handlers := make([]string, 0, len(c.Instance))
+	for _, instance := range c.Instance {
+		handlers = append(handlers, alias+"@"+instance.Name+"."+fn)
+	}
+	return handlers
+}
+
+func (c configPipe) valid() error {
+	// Each instance has its own config, the pipe config would be silently ignored.
+	if (len(c.Instance) > 0) && (c.Config != nil) {
+		return errors.New("the config should be set at the instances when the pipe has instances")
+	}
+
+	names := make(map[string]struct{}, len(c.Instance))
+	for _, instance := range c.Instance {
+		if instance.Name == "" {
+			return errors.New("missing instance name")
+		}
+		if strings.ContainsAny(instance.Name, ".@") {
+			return fmt.Errorf("invalid instance name '%s', it can't have '.' or '@'", instance.Name)
+		}
+		if _, ok := names[instance.Name]; ok {
+			return fmt.Errorf("duplicated instance '%s'", instance.Name)
+		}
+		names[instance.Name] = struct{}{}
+	}
+
+	functions := make(map[string]struct{}, len(c.Timeout))
+	for _, timeout := range c.Timeout {
+		if _, ok := functions[timeout.Function]; ok {
+			return fmt.Errorf("duplicated timeout of function '%s'", timeout.Function)
+		}
+		functions[timeout.Function] = struct{}{}
+
+		if timeout.Duration == "" {
+			return fmt.Errorf("missing duration at the timeout of function '%s'", timeout.Function)
+		}
+	}
+	return nil
+}
+
+type configPipeTimeout struct {
+	Function string `mapstructure:"-"`
+	Duration string `mapstructure:"duration"`
+	Fallback string `mapstructure:"fallback"`
+}
+
+type configPipeInstance struct {
+	Name   string
+	Config map[string]interface{}
+}
+
+type configPipeLifecycle struct {
+	StartTimeout string   `mapstructure:"start-timeout"`
+	StartFailure string   `mapstructure:"start-failure"`
+	DependsOn    []string `mapstructure:"depends-on"`
 }
 
 type configHTTP struct {
-	Endpoint string
-	Handler  string
+	Endpoint         string                       `mapstructure:"-"`
+	Handler          string                       `mapstructure:"handler"`
+	MaxRequestBody   int64                        `mapstructure:"max-request-body"`
+	RateLimit        []configHTTPRateLimit        `mapstructure:"rate-limit"`
+	Cache            []configHTTPCache            `mapstructure:"cache"`
+	Compression      []configHTTPCompression      `mapstructure:"compression"`
+	RequestBuffering []configHTTPRequestBuffering `mapstructure:"request-buffering"`
+	Auth             []configHTTPAuth             `mapstructure:"auth"`
+	AccessControl    []configHTTPAccessControl    `mapstructure:"access-control"`
+	CORS             []configHTTPCORS             `mapstructure:"cors"`
+	Rewrite          []configHTTPRewrite          `mapstructure:"rewrite"`
+	Redirect         []configHTTPRedirect         `mapstructure:"redirect"`
+	Static           []configHTTPStatic           `mapstructure:"static"`
+	Maintenance      []configHTTPMaintenance      `mapstructure:"maintenance"`
+	Mirror           []configHTTPMirror           `mapstructure:"mirror"`
+	Split            []configHTTPSplit            `mapstructure:"split"`
+}
+
+func (c configHTTP) valid() error {
+	if len(c.RateLimit) > 1 {
+		return errors.New("more then one 'rate-limit' config block found, only one is allowed")
+	}
+
+	if len(c.Cache) > 1 {
+		return errors.New("more then one 'cache' config block found, only one is allowed")
+	}
+
+	if len(c.Compression) > 1 {
+		return errors.New("more then one 'compression' config block found, only one is allowed")
+	}
+
+	if len(c.RequestBuffering) > 1 {
+		return errors.New("more then one 'request-buffering' config block found, only one is allowed")
+	}
+
+	if len(c.AccessControl) > 1 {
+		return errors.New("more then one 'access-control' config block found, only one is allowed")
+	}
+
+	if len(c.CORS) > 1 {
+		return errors.New("more then one 'cors' config block found, only one is allowed")
+	}
+
+	for _, rewrite := range c.Rewrite {
+		if err := rewrite.valid(); err != nil {
+			return errors.Wrap(err, "rewrite config validation error")
+		}
+	}
+
+	if len(c.Auth) > 1 {
+		return errors.New("more then one 'auth' config block found, only one is allowed")
+	}
+
+	if len(c.Static) > 1 {
+		return errors.New("more then one 'static' config block found, only one is allowed")
+	}
+
+	if len(c.Split) > 1 {
+		return errors.New("more then one 'split' config block found, only one is allowed")
+	}
+
+	if (c.Handler == "") && (len(c.Static) == 0) && (len(c.Split) == 0) {
+		return errors.New("missing 'handler', it's only optional with the 'static' or 'split' config blocks")
+	}
+
+	if len(c.Maintenance) > 1 {
+		return errors.New("more then one 'maintenance' config block found, only one is allowed")
+	}
+
+	if len(c.Mirror) > 1 {
+		return errors.New("more then one 'mirror' config block found, only one is allowed")
+	}
+
+	for _, auth := range c.Auth {
+		if err := auth.valid(); err != nil {
+			return errors.Wrap(err, "auth config validation error")
+		}
+	}
+
+	return nil
+}
+
+type configHTTPRateLimit struct {
+	Algorithm string `mapstructure:"algorithm"`
+	Limit     int    `mapstructure:"limit"`
+	Burst     int    `mapstructure:"burst"`
+	Window    string `mapstructure:"window"`
+	Key       string `mapstructure:"key"`
+}
+
+type configHTTPCache struct {
+	Store        string `mapstructure:"store"`
+	Path         string `mapstructure:"path"`
+	MaxSize      int64  `mapstructure:"max-size"`
+	MaxEntrySize int64  `mapstructure:"max-entry-size"`
+	StatusHeader string `mapstructure:"status-header"`
+}
+
+type configHTTPCompression struct {
+	Algorithms       []string `mapstructure:"algorithms"`
+	Types            []string `mapstructure:"types"`
+	MinSize          int      `mapstructure:"min-size"`
+	IdentityUpstream bool     `mapstructure:"identity-upstream"`
+}
+
+type configHTTPRequestBuffering struct {
+	Memory int64  `mapstructure:"memory"`
+	Path   string `mapstructure:"path"`
+}
+
+type configHTTPAccessControl struct {
+	Allow   []string `mapstructure:"allow"`
+	Deny    []string `mapstructure:"deny"`
+	File    string   `mapstructure:"file"`
+	Handler string   `mapstructure:"handler"`
+}
+
+type configHTTPCORS struct {
+	Origins        []string `mapstructure:"origins"`
+	Methods        []string `mapstructure:"methods"`
+	Headers        []string `mapstructure:"headers"`
+	ExposedHeaders []string `mapstructure:"exposed-headers"`
+	Credentials    bool     `mapstructure:"credentials"`
+	MaxAge         string   `mapstructure:"max-age"`
+}
+
+type configHTTPRedirect struct {
+	Match  string `mapstructure:"match"`
+	Target string `mapstructure:"target"`
+	Status int    `mapstructure:"status"`
+}
+
+type configHTTPStatic struct {
+	Root          string   `mapstructure:"root"`
+	Index         []string `mapstructure:"index"`
+	SPAFallback   string   `mapstructure:"spa-fallback"`
+	CacheControl  string   `mapstructure:"cache-control"`
+	Precompressed bool     `mapstructure:"precompressed"`
+}
+
+type configHTTPMaintenance struct {
+	Page       string `mapstructure:"page"`
+	Status     int    `mapstructure:"status"`
+	RetryAfter string `mapstructure:"retry-after"`
+	Enabled    bool   `mapstructure:"enabled"`
+}
+
+type configHTTPMirror struct {
+	Upstream    string  `mapstructure:"upstream"`
+	Percentage  float64 `mapstructure:"percentage"`
+	MaxBodySize int64   `mapstructure:"max-body-size"`
+	Timeout     string  `mapstructure:"timeout"`
+	Concurrency int     `mapstructure:"concurrency"`
+}
+
+type configHTTPSplit struct {
+	Cookie         string                   `mapstructure:"cookie"`
+	Header         string                   `mapstructure:"header"`
+	OverrideHeader string                   `mapstructure:"override-header"`
+	Variant        []configHTTPSplitVariant `mapstructure:"variant"`
+}
+
+type configHTTPSplitVariant struct {
+	Name     string   `mapstructure:"name"`
+	Handler  string   `mapstructure:"handler"`
+	Upstream []string `mapstructure:"upstream"`
+	Weight   int      `mapstructure:"weight"`
+}
+
+type configHTTPRewrite struct {
+	Match          string                    `mapstructure:"match"`
+	RequestHeader  []configHTTPRewriteValues `mapstructure:"request-header"`
+	ResponseHeader []configHTTPRewriteValues `mapstructure:"response-header"`
+	Query          []configHTTPRewriteValues `mapstructure:"query"`
+	StripPrefix    string                    `mapstructure:"strip-prefix"`
+	AddPrefix      string                    `mapstructure:"add-prefix"`
+	Path           []configHTTPRewritePath   `mapstructure:"path"`
+	Host           string                    `mapstructure:"host"`
+}
+
+func (c configHTTPRewrite) valid() error {
+	if len(c.RequestHeader) > 1 {
+		return errors.New("more then one 'request-header' config block found, only one is allowed")
+	}
+
+	if len(c.ResponseHeader) > 1 {
+		return errors.New("more then one 'response-header' config block found, only one is allowed")
+	}
+
+	if len(c.Query) > 1 {
+		return errors.New("more then one 'query' config block found, only one is allowed")
+	}
+
+	if len(c.Path) > 1 {
+		return errors.New("more then one 'path' config block found, only one is allowed")
+	}
+
+	return nil
+}
+
+func (c configHTTPRewrite) toHost() internal.HostRewrite {
+	rewrite := internal.HostRewrite{
+		Match:       c.Match,
+		StripPrefix: c.StripPrefix,
+		AddPrefix:   c.AddPrefix,
+		Host:        c.Host,
+	}
+
+	if len(c.RequestHeader) > 0 {
+		rewrite.RequestHeader = c.RequestHeader[0].toHost()
+	}
+
+	if len(c.ResponseHeader) > 0 {
+		rewrite.ResponseHeader = c.ResponseHeader[0].toHost()
+	}
+
+	if len(c.Query) > 0 {
+		rewrite.Query = c.Query[0].toHost()
+	}
+
+	if len(c.Path) > 0 {
+		rewrite.PathRegex = c.Path[0].Regex
+		rewrite.PathReplacement = c.Path[0].Replacement
+	}
+
+	return rewrite
+}
+
+// configHTTPRewriteValues has slices of maps because this is how HCL decode the objects.
+type configHTTPRewriteValues struct {
+	Set    []map[string]string `mapstructure:"set"`
+	Add    []map[string]string `mapstructure:"add"`
+	Remove []string            `mapstructure:"remove"`
+}
+
+func (c configHTTPRewriteValues) toHost() internal.HostRewriteValues {
+	values := internal.HostRewriteValues{
+		Set:    make(map[string]string),
+		Add:    make(map[string]string),
+		Remove: c.Remove,
+	}
+	for _, set := range c.Set {
+		for key, value := range set {
+			values.Set[key] = value
+		}
+	}
+	for _, add := range c.Add {
+		for key, value := range add {
+			values.Add[key] = value
+		}
+	}
+	return values
+}
+
+type configHTTPRewritePath struct {
+	Regex       string `mapstructure:"regex"`
+	Replacement string `mapstructure:"replacement"`
+}
+
+type configHTTPAuth struct {
+	Basic  []configHTTPAuthBasic  `mapstructure:"basic"`
+	APIKey []configHTTPAuthAPIKey `mapstructure:"api-key"`
+	JWT    []configHTTPAuthJWT    `mapstructure:"jwt"`
+}
+
+func (c configHTTPAuth) valid() error {
+	if len(c.Basic) > 1 {
+		return errors.New("more then one 'basic' config block found, only one is allowed")
+	}
+
+	if len(c.APIKey) > 1 {
+		return errors.New("more then one 'api-key' config block found, only one is allowed")
+	}
+
+	if len(c.JWT) > 1 {
+		return errors.New("more then one 'jwt' config block found, only one is allowed")
+	}
+
+	return nil
+}
+
+func (c configHTTPAuth) toHost() (*internal.HostAuth, error) {
+	var auth internal.HostAuth
+	if len(c.Basic) > 0 {
+		auth.Basic = &internal.HostAuthBasic{
+			Htpasswd: c.Basic[0].Htpasswd,
+			Realm:    c.Basic[0].Realm,
+		}
+	}
+
+	if len(c.APIKey) > 0 {
+		auth.APIKey = &internal.HostAuthAPIKey{
+			File:   c.APIKey[0].File,
+			Header: c.APIKey[0].Header,
+		}
+	}
+
+	if len(c.JWT) > 0 {
+		jwt := c.JWT[0]
+		auth.JWT = &internal.HostAuthJWT{
+			Keys:       jwt.Keys,
+			Secret:     jwt.Secret,
+			JWKSURL:    jwt.JWKSURL,
+			Algorithms: jwt.Algorithms,
+			Issuer:     jwt.Issuer,
+			Audience:   jwt.Audience,
+		}
+
+		if jwt.JWKSRefresh != "" {
+			var err error
+			auth.JWT.JWKSRefresh, err = time.ParseDuration(jwt.JWKSRefresh)
+			if err != nil {
+				return nil, errors.Wrapf(err, "parse duration '%s' error", jwt.JWKSRefresh)
+			}
+		}
+	}
+
+	return &auth, nil
+}
+
+type configHTTPAuthBasic struct {
+	Htpasswd string `mapstructure:"htpasswd"`
+	Realm    string `mapstructure:"realm"`
+}
+
+type configHTTPAuthAPIKey struct {
+	File   string `mapstructure:"file"`
+	Header string `mapstructure:"header"`
+}
+
+type configHTTPAuthJWT struct {
+	Keys        []string `mapstructure:"keys"`
+	Secret      string   `mapstructure:"secret"`
+	JWKSURL     string   `mapstructure:"jwks-url"`
+	JWKSRefresh string   `mapstructure:"jwks-refresh"`
+	Algorithms  []string `mapstructure:"algorithms"`
+	Issuer      string   `mapstructure:"issuer"`
+	Audience    string   `mapstructure:"audience"`
 }
 
 type configCore struct {
-	GracefulShutdown string           `mapstructure:"graceful-shutdown"`
-	HTTP             []configCoreHTTP `mapstructure:"http"`
+	GracefulShutdown string            `mapstructure:"graceful-shutdown"`
+	HTTP             []configCoreHTTP  `mapstructure:"http"`
+	Log              []configCoreLog   `mapstructure:"log"`
+	Admin            []configCoreAdmin `mapstructure:"admin"`
+	Store            []configCoreStore `mapstructure:"store"`
 }
 
 func (c configCore) valid() error {
@@ -195,6 +913,30 @@ func (c configCore) valid() error {
 		return errors.New("more then one 'core.http' config block found, only one is allowed")
 	}
 
+	if len(c.Log) > 1 {
+		return errors.New("more then one 'core.log' config block found, only one is allowed")
+	}
+
+	if len(c.Admin) > 1 {
+		return errors.New("more then one 'core.admin' config block found, only one is allowed")
+	}
+
+	if len(c.Store) > 1 {
+		return errors.New("more then one 'core.store' config block found, only one is allowed")
+	}
+
+	for _, admin := range c.Admin {
+		if len(admin.Listen) > 1 {
+			return errors.New("more then one 'core.admin.listen' config block found, only one is allowed")
+		}
+
+		for _, listen := range admin.Listen {
+			if len(listen.TLS) > 0 {
+				return errors.New("'core.admin.listen.tls' is not supported")
+			}
+		}
+	}
+
 	for _, http := range c.HTTP {
 		if err := http.valid(); err != nil {
 			return errors.Wrap(err, "core.http invalid")
@@ -204,6 +946,30 @@ func (c configCore) valid() error {
 	return nil
 }
 
+type configCoreLog struct {
+	Level  string `mapstructure:"level"`
+	Format string `mapstructure:"format"`
+	Output string `mapstructure:"output"`
+}
+
+type configCoreAdmin struct {
+	Listen []configCoreAdminListen `mapstructure:"listen"`
+	Debug  bool                    `mapstructure:"debug"`
+}
+
+type configCoreAdminListen struct {
+	Address string                      `mapstructure:"address"`
+	Port    int                         `mapstructure:"port"`
+	TLS     []configServerHTTPListenTLS `mapstructure:"tls"`
+}
+
+type configCoreStore struct {
+	Driver          string `mapstructure:"driver"`
+	Path            string `mapstructure:"path"`
+	Sync            bool   `mapstructure:"sync"`
+	CleanupInterval string `mapstructure:"cleanup-interval"`
+}
+
 type configCoreHTTP struct {
 	Server []configCoreHTTPServer `mapstructure:"server"`
 	Client []configCoreHTTPClient `mapstructure:"client"`
@@ -224,35 +990,93 @@ func (c configCoreHTTP) valid() error {
 		return errors.New("more then one 'core.http.client' config block found, only one is allowed")
 	}
 
+	for _, client := range c.Client {
+		if len(client.TLS) > 1 {
+			return errors.New("more then one 'core.http.client.tls' config block found, only one is allowed")
+		}
+	}
+
 	return nil
 }
 
 type configCoreHTTPServer struct {
-	Listen []configServerHTTPListen `mapstructure:"listen"`
-	Action []configServerHTTPAction `mapstructure:"action"`
+	TrustedProxies []string `mapstructure:"trusted-proxies"`
+
+	Listen    []configServerHTTPListen    `mapstructure:"listen"`
+	Action    []configServerHTTPAction    `mapstructure:"action"`
+	AccessLog []configServerHTTPAccessLog `mapstructure:"access-log"`
+	RequestID []configServerHTTPRequestID `mapstructure:"request-id"`
+	Recovery  []configServerHTTPRecovery  `mapstructure:"recovery"`
+
+	HTTPSRedirect []configServerHTTPSRedirect `mapstructure:"https-redirect"`
 }
 
 func (c configCoreHTTPServer) valid() error {
+	if len(c.Listen) > 1 {
+		return errors.New("more then one 'core.server.http.listen' config block found, only one is allowed")
+	}
+
+	for _, listen := range c.Listen {
+		if len(listen.TLS) > 1 {
+			return errors.New("more then one 'core.server.http.listen.tls' config block found, only one is allowed")
+		}
+	}
+
 	if len(c.Action) > 1 {
 		return errors.New("more then one 'core.server.http.action' config block found, only one is allowed")
 	}
 
+	if len(c.AccessLog) > 1 {
+		return errors.New("more then one 'core.server.http.access-log' config block found, only one is allowed")
+	}
+
+	if len(c.RequestID) > 1 {
+		return errors.New("more then one 'core.server.http.request-id' config block found, only one is allowed")
+	}
+
+	if len(c.HTTPSRedirect) > 1 {
+		return errors.New("more then one 'core.server.http.https-redirect' config block found, only one is allowed")
+	}
+
+	if len(c.Recovery) > 1 {
+		return errors.New("more then one 'core.server.http.recovery' config block found, only one is allowed")
+	}
+
 	return nil
 }
 
 type configCoreHTTPClient struct {
-	DisableKeepAlive      bool   `mapstructure:"disable-keep-alive"`
-	DisableCompression    bool   `mapstructure:"disable-compression"`
-	MaxIdleConns          int    `mapstructure:"max-idle-conns"`
-	MaxIdleConnsPerHost   int    `mapstructure:"max-idle-conns-per-host"`
-	MaxConnsPerHost       int    `mapstructure:"max-conns-per-host"`
-	IdleConnTimeout       string `mapstructure:"idle-conn-timeout"`
-	TLSHandshakeTimeout   string `mapstructure:"tls-handshake-timeout"`
-	ExpectContinueTimeout string `mapstructure:"expect-continue-timeout"`
+	DisableKeepAlive      bool                      `mapstructure:"disable-keep-alive"`
+	DisableCompression    bool                      `mapstructure:"disable-compression"`
+	MaxIdleConns          int                       `mapstructure:"max-idle-conns"`
+	MaxIdleConnsPerHost   int                       `mapstructure:"max-idle-conns-per-host"`
+	MaxConnsPerHost       int                       `mapstructure:"max-conns-per-host"`
+	IdleConnTimeout       string                    `mapstructure:"idle-conn-timeout"`
+	TLSHandshakeTimeout   string                    `mapstructure:"tls-handshake-timeout"`
+	ExpectContinueTimeout string                    `mapstructure:"expect-continue-timeout"`
+	TLS                   []configCoreHTTPClientTLS `mapstructure:"tls"`
+}
+
+type configCoreHTTPClientTLS struct {
+	CA                 string `mapstructure:"ca"`
+	Cert               string `mapstructure:"cert"`
+	Key                string `mapstructure:"key"`
+	ServerName         string `mapstructure:"server-name"`
+	MinVersion         string `mapstructure:"min-version"`
+	InsecureSkipVerify bool   `mapstructure:"insecure-skip-verify"`
 }
 
 type configServerHTTPListen struct {
-	Port int `mapstructure:"port"`
+	Port int                         `mapstructure:"port"`
+	TLS  []configServerHTTPListenTLS `mapstructure:"tls"`
+}
+
+type configServerHTTPListenTLS struct {
+	Cert       string `mapstructure:"cert"`
+	Key        string `mapstructure:"key"`
+	ClientCA   string `mapstructure:"client-ca"`
+	ClientAuth string `mapstructure:"client-auth"`
+	MinVersion string `mapstructure:"min-version"`
 }
 
 type configServerHTTPAction struct {
@@ -260,6 +1084,48 @@ type configServerHTTPAction struct {
 	Panic    string `mapstructure:"panic"`
 }
 
+type configServerHTTPAccessLog struct {
+	Format string   `mapstructure:"format"`
+	Fields []string `mapstructure:"fields"`
+	Output string   `mapstructure:"output"`
+}
+
+type configServerHTTPSRedirect struct {
+	Port   int `mapstructure:"port"`
+	Status int `mapstructure:"status"`
+}
+
+type configServerHTTPRequestID struct {
+	Header string `mapstructure:"header"`
+	Format string `mapstructure:"format"`
+}
+
+type configServerHTTPRecovery struct {
+	DisableAfter int    `mapstructure:"disable-after"`
+	Window       string `mapstructure:"window"`
+}
+
+// pipeTimeouts return the pipes timeouts by handler, like 'base.Default', or nil if there is none.
+func (c Config) pipeTimeouts() (map[string]pipe.HTTPConfigTimeout, error) {
+	var result map[string]pipe.HTTPConfigTimeout
+	for _, p := range c.Pipe {
+		for _, timeout := range p.Timeout {
+			duration, err := time.ParseDuration(timeout.Duration)
+			if err != nil {
+				return nil, errors.Wrapf(err, "parse duration '%s' error", timeout.Duration)
+			}
+
+			if result == nil {
+				result = make(map[string]pipe.HTTPConfigTimeout)
+			}
+			for _, handler := range p.handlers(timeout.Function) {
+				result[handler] = pipe.HTTPConfigTimeout{Duration: duration, Fallback: timeout.Fallback}
+			}
+		}
+	}
+	return result, nil
+}
+
 // NewConfig return a configured config.
 func NewConfig(payload []byte) (Config, error) {
 	var c Config
@@ -334,6 +1200,39 @@ func loadConfigPipe(raw interface{}) ([]configPipe, error) {
 							return nil, errors.New("more then one 'config' found at a pipe, only one is allowed")
 						}
 						ch.Config = values[0]
+					case "lifecycle":
+						values, ok := innerEntry.([]map[string]interface{})
+						if !ok {
+							return nil, errors.New("can't type assertion value into map[string]interface{}")
+						}
+						if len(values) > 1 {
+							return nil, errors.New("more then one 'lifecycle' found at a pipe, only one is allowed")
+						}
+
+						var lifecycle configPipeLifecycle
+						decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+							ErrorUnused: true,
+							Result:      &lifecycle,
+						})
+						if err != nil {
+							return nil, errors.Wrap(err, "decoder initialization error")
+						}
+						if err := decoder.Decode(values[0]); err != nil {
+							return nil, errors.Wrapf(err, "pipe '%s' lifecycle decode error", key)
+						}
+						ch.Lifecycle = append(ch.Lifecycle, lifecycle)
+					case "instance":
+						instances, err := loadConfigPipeInstance(innerEntry)
+						if err != nil {
+							return nil, errors.Wrapf(err, "pipe '%s' instance error", key)
+						}
+						ch.Instance = append(ch.Instance, instances...)
+					case "timeout":
+						timeouts, err := loadConfigPipeTimeout(innerEntry)
+						if err != nil {
+							return nil, errors.Wrapf(err, "pipe '%s' timeout error", key)
+						}
+						ch.Timeout = append(ch.Timeout, timeouts...)
 					default:
 						return nil, fmt.Errorf("unknow pipe key '%s'", innerKey)
 					}
@@ -347,6 +1246,101 @@ func loadConfigPipe(raw interface{}) ([]configPipe, error) {
 	return result, nil
 }
 
+// loadConfigPipeInstance expect to receive a interface with this format:
+//
+//	[]map[string]interface {}{
+//		{
+//			"internal": []map[string]interface {}{
+//				{
+//					"config": []map[string]interface {}{
+//						{"host": "internal.example.com"},
+//					},
+//				},
+//			},
+//		},
+//	}
+func loadConfigPipeInstance(raw interface{}) ([]configPipeInstance, error) {
+	rawSliceMap, ok := raw.([]map[string]interface{})
+	if !ok {
+		return nil, errors.New("can't type assertion value into []map[string]interface{} on the first assignment")
+	}
+
+	var result []configPipeInstance
+	for _, rawMap := range rawSliceMap {
+		for name, rawMapEntry := range rawMap {
+			rawSliceMapInner, ok := rawMapEntry.([]map[string]interface{})
+			if !ok {
+				return nil, errors.New("can't type assertion value into []map[string]interface{} on the second assignment")
+			}
+
+			for _, rawSliceMapInnerEntry := range rawSliceMapInner {
+				instance := configPipeInstance{Name: name}
+				for innerKey, innerEntry := range rawSliceMapInnerEntry {
+					if innerKey != "config" {
+						return nil, fmt.Errorf("unknow instance key '%s'", innerKey)
+					}
+
+					values, ok := innerEntry.([]map[string]interface{})
+					if !ok {
+						return nil, errors.New("can't type assertion value into map[string]interface{}")
+					}
+					if len(values) != 1 {
+						return nil, errors.New("expected one 'config' block at a instance")
+					}
+					instance.Config = values[0]
+				}
+				result = append(result, instance)
+			}
+		}
+	}
+	return result, nil
+}
+
+// loadConfigPipeTimeout expect to receive a interface with this format:
+//
+//	[]map[string]interface {}{
+//		{
+//			"Default": []map[string]interface {}{
+//				{
+//					"duration": "2s",
+//					"fallback": "base.Timeout",
+//				},
+//			},
+//		},
+//	}
+func loadConfigPipeTimeout(raw interface{}) ([]configPipeTimeout, error) {
+	rawSliceMap, ok := raw.([]map[string]interface{})
+	if !ok {
+		return nil, errors.New("can't type assertion value into []map[string]interface{} on the first assignment")
+	}
+
+	var result []configPipeTimeout
+	for _, rawMap := range rawSliceMap {
+		for function, rawMapEntry := range rawMap {
+			rawSliceMapInner, ok := rawMapEntry.([]map[string]interface{})
+			if !ok {
+				return nil, errors.New("can't type assertion value into []map[string]interface{} on the second assignment")
+			}
+
+			for _, rawSliceMapInnerEntry := range rawSliceMapInner {
+				timeout := configPipeTimeout{Function: function}
+				decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+					ErrorUnused: true,
+					Result:      &timeout,
+				})
+				if err != nil {
+					return nil, errors.Wrap(err, "decoder initialization error")
+				}
+				if err := decoder.Decode(rawSliceMapInnerEntry); err != nil {
+					return nil, errors.Wrapf(err, "function '%s' decode error", function)
+				}
+				result = append(result, timeout)
+			}
+		}
+	}
+	return result, nil
+}
+
 // loadConfigHTTP expect to receive a interface with this format:
 //
 // []map[string]interface {}{
@@ -382,18 +1376,18 @@ func loadConfigHTTP(raw interface{}) ([]configHTTP, error) {
 					Endpoint: key,
 				}
 
-				for innerKey, innerEntry := range rawSliceMapInnerEntry {
-					value, ok := innerEntry.(string)
-					if !ok {
-						return nil, errors.New("can't type assertion value into string")
-					}
+				// The http entries have nested blocks, so, instead of handling each key, the entry is
+				// decoded and any unknown key is reported as an error.
+				decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+					ErrorUnused: true,
+					Result:      &ch,
+				})
+				if err != nil {
+					return nil, errors.Wrap(err, "decoder initialization error")
+				}
 
-					switch innerKey {
-					case "handler":
-						ch.Handler = value
-					default:
-						return nil, fmt.Errorf("unknow http key '%s'", innerKey)
-					}
+				if err := decoder.Decode(rawSliceMapInnerEntry); err != nil {
+					return nil, errors.Wrapf(err, "http '%s' decode error", key)
 				}
 
 				result = append(result, ch)
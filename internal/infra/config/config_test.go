@@ -89,9 +89,60 @@ func TestConfigValid(t *testing.T) {
 			},
 			require.Error,
 		},
+		{
+			"duplicated pipe instance",
+			Config{
+				Pipe: []configPipe{
+					{
+						Path:     "github.com/pipehub/auth",
+						Instance: []configPipeInstance{{Name: "internal"}, {Name: "internal"}},
+					},
+				},
+			},
+			require.Error,
+		},
+		{
+			"invalid pipe instance name",
+			Config{
+				Pipe: []configPipe{
+					{
+						Path:     "github.com/pipehub/auth",
+						Instance: []configPipeInstance{{Name: "internal.v2"}},
+					},
+				},
+			},
+			require.Error,
+		},
+		{
+			"empty pipe instance name",
+			Config{
+				Pipe: []configPipe{
+					{
+						Path:     "github.com/pipehub/auth",
+						Instance: []configPipeInstance{{Name: ""}},
+					},
+				},
+			},
+			require.Error,
+		},
+		{
+			"pipe config with instances",
+			Config{
+				Pipe: []configPipe{
+					{
+						Path:     "github.com/pipehub/auth",
+						Config:   map[string]interface{}{"realm": "default"},
+						Instance: []configPipeInstance{{Name: "internal"}},
+					},
+				},
+			},
+			require.Error,
+		},
 	}
 
 	for _, tt := range tests {
+		tt := tt
+
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 			tt.assertion(t, tt.config.valid())
@@ -146,6 +197,8 @@ func TestConfigToGenerator(t *testing.T) {
 	}
 
 	for _, tt := range tests {
+		tt := tt
+
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 			actual := tt.config.ToGenerator().Pipes
@@ -236,6 +289,8 @@ func TestConfigToServer(t *testing.T) {
 	}
 
 	for _, tt := range tests {
+		tt := tt
+
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 
@@ -246,6 +301,37 @@ func TestConfigToServer(t *testing.T) {
 	}
 }
 
+func TestConfigPipeTimeouts(t *testing.T) {
+	t.Parallel()
+
+	c := Config{
+		Pipe: []configPipe{
+			{
+				Path:    "github.com/pipehub/sample",
+				Timeout: []configPipeTimeout{{Function: "Default", Duration: "2s", Fallback: "sample.Timeout"}},
+			},
+			{
+				Path:     "github.com/pipehub/auth",
+				Alias:    "login",
+				Instance: []configPipeInstance{{Name: "internal"}, {Name: "public"}},
+				Timeout:  []configPipeTimeout{{Function: "Check", Duration: "500ms"}},
+			},
+		},
+	}
+
+	timeouts, err := c.pipeTimeouts()
+	require.NoError(t, err)
+	require.Equal(t, map[string]pipe.HTTPConfigTimeout{
+		"sample.Default":       {Duration: 2 * time.Second, Fallback: "sample.Timeout"},
+		"login@internal.Check": {Duration: 500 * time.Millisecond},
+		"login@public.Check":   {Duration: 500 * time.Millisecond},
+	}, timeouts)
+
+	timeouts, err = Config{}.pipeTimeouts()
+	require.NoError(t, err)
+	require.Nil(t, timeouts)
+}
+
 func TestConfigCtxShutdown(t *testing.T) {
 	t.Parallel()
 
@@ -276,6 +362,8 @@ func TestConfigCtxShutdown(t *testing.T) {
 	}
 
 	for _, tt := range tests {
+		tt := tt
+
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 
@@ -354,6 +442,45 @@ func TestNewConfig(t *testing.T) {
 			},
 			require.NoError,
 		},
+		{
+			"success #3",
+			"newConfig.success.3.hcl",
+			Config{
+				HTTP: []configHTTP{
+					{
+						Endpoint: "google",
+						Handler:  "base.Default",
+						RateLimit: []configHTTPRateLimit{
+							{
+								Algorithm: "sliding-window",
+								Limit:     100,
+								Window:    "1m",
+								Key:       "header:X-API-Key",
+							},
+						},
+					},
+				},
+			},
+			require.NoError,
+		},
+		{
+			"success #4",
+			"newConfig.success.4.hcl",
+			Config{
+				Pipe: []configPipe{
+					{
+						Path:    "github.com/pipehub/auth",
+						Version: "v0.2.0",
+						Alias:   "auth",
+						Instance: []configPipeInstance{
+							{Name: "internal", Config: map[string]interface{}{"realm": "internal"}},
+							{Name: "public", Config: map[string]interface{}{"realm": "public"}},
+						},
+					},
+				},
+			},
+			require.NoError,
+		},
 		{
 			"invalid hcl",
 			"newConfig.fail.1.hcl",
@@ -366,9 +493,17 @@ func TestNewConfig(t *testing.T) {
 			Config{},
 			require.Error,
 		},
+		{
+			"unknown http key",
+			"newConfig.fail.3.hcl",
+			Config{},
+			require.Error,
+		},
 	}
 
 	for _, tt := range tests {
+		tt := tt
+
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 
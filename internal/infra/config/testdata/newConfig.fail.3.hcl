@@ -0,0 +1,4 @@
+http "google" {
+  handler = "base.Default"
+  unknown = "value"
+}
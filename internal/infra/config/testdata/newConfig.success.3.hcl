@@ -0,0 +1,10 @@
+http "google" {
+  handler = "base.Default"
+
+  rate-limit {
+    algorithm = "sliding-window"
+    limit     = 100
+    window    = "1m"
+    key       = "header:X-API-Key"
+  }
+}
@@ -0,0 +1,16 @@
+pipe "github.com/pipehub/auth" {
+  version = "v0.2.0"
+  alias   = "auth"
+
+  instance "internal" {
+    config {
+      realm = "internal"
+    }
+  }
+
+  instance "public" {
+    config {
+      realm = "public"
+    }
+  }
+}
@@ -0,0 +1,92 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Field is a key value pair written at a log entry.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// EncodeJSON write the fields as a JSON object at the buffer. The fields order is preserved.
+func EncodeJSON(buf *bytes.Buffer, fields []Field) {
+	buf.WriteByte('{')
+	for i, field := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeJSONValue(buf, field.Key)
+		buf.WriteByte(':')
+		writeJSONValue(buf, jsonValue(field.Value))
+	}
+	buf.WriteByte('}')
+}
+
+// EncodeLogfmt write the fields at the logfmt format, 'key=value' pairs separated by spaces.
+func EncodeLogfmt(buf *bytes.Buffer, fields []Field) {
+	for i, field := range fields {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(field.Key)
+		buf.WriteByte('=')
+		buf.WriteString(logfmtValue(field.Value))
+	}
+}
+
+func writeJSONValue(buf *bytes.Buffer, value interface{}) {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		payload, _ = json.Marshal(fmt.Sprintf("%v", value)) // nolint: errcheck
+	}
+	buf.Write(payload)
+}
+
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return v
+	}
+}
+
+func logfmtValue(value interface{}) string {
+	var raw string
+	switch v := value.(type) {
+	case nil:
+		return `""`
+	case string:
+		raw = v
+	case error:
+		raw = v.Error()
+	case time.Time:
+		raw = v.Format(time.RFC3339Nano)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		raw = fmt.Sprintf("%v", v)
+	}
+
+	if raw == "" || strings.ContainsAny(raw, " =\"\t\n") {
+		return strconv.Quote(raw)
+	}
+	return raw
+}
@@ -0,0 +1,87 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeJSON(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		fields   []Field
+		expected string
+	}{
+		{
+			"empty",
+			nil,
+			`{}`,
+		},
+		{
+			"multiple fields",
+			[]Field{
+				{Key: "status", Value: 200},
+				{Key: "latency", Value: time.Second},
+				{Key: "error", Value: errors.New("failed")},
+				{Key: "path", Value: `/"quoted"`},
+			},
+			`{"status":200,"latency":"1s","error":"failed","path":"/\"quoted\""}`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			EncodeJSON(&buf, tt.fields)
+			require.Equal(t, tt.expected, buf.String())
+		})
+	}
+}
+
+func TestEncodeLogfmt(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		fields   []Field
+		expected string
+	}{
+		{
+			"empty",
+			nil,
+			``,
+		},
+		{
+			"multiple fields",
+			[]Field{
+				{Key: "status", Value: 200},
+				{Key: "latency", Value: time.Second},
+				{Key: "message", Value: "request done"},
+				{Key: "empty", Value: ""},
+				{Key: "nil", Value: nil},
+			},
+			`status=200 latency=1s message="request done" empty="" nil=""`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			EncodeLogfmt(&buf, tt.fields)
+			require.Equal(t, tt.expected, buf.String())
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Level is the severity of a log entry.
+type Level int
+
+// Levels supported by the logger.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+}
+
+// ParseLevel convert the level name into a level.
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "", "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, fmt.Errorf("invalid level '%s'", name)
+	}
+}
+
+// Formats supported by the logger.
+const (
+	FormatJSON   = "json"
+	FormatLogfmt = "logfmt"
+)
+
+// LoggerConfig has the configuration needed to initialize the logger.
+type LoggerConfig struct {
+	// Level can be 'debug', 'info', 'warn' or 'error', the default is 'info'.
+	Level string
+
+	// Format can be 'json' or 'logfmt', the default is 'logfmt'.
+	Format string
+
+	// Output is 'stdout', 'stderr' or a file path, the default is 'stdout'.
+	Output string
+}
+
+// Logger is a leveled and structured logger. The fields are informed as a list of key value pairs,
+// like: logger.Info("pipe started", "pipe", "base", "latency", time.Second).
+//
+// A nil logger is valid and discard all the entries.
+type Logger struct {
+	level  Level
+	format string
+	writer Writer
+	fields []Field
+}
+
+// With return a logger that add the fields to all the entries.
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	if l == nil {
+		return nil
+	}
+
+	nl := *l
+	nl.fields = appendKeyvals(make([]Field, 0, len(l.fields)+len(keyvals)/2), l.fields, keyvals...)
+	return &nl
+}
+
+// Debug log a entry at the debug level.
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.log(LevelDebug, msg, keyvals)
+}
+
+// Info log a entry at the info level.
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.log(LevelInfo, msg, keyvals)
+}
+
+// Warn log a entry at the warn level.
+func (l *Logger) Warn(msg string, keyvals ...interface{}) {
+	l.log(LevelWarn, msg, keyvals)
+}
+
+// Error log a entry at the error level.
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.log(LevelError, msg, keyvals)
+}
+
+// Reopen the output, it's used to support log rotation.
+func (l *Logger) Reopen() error {
+	if l == nil {
+		return nil
+	}
+	return l.writer.Reopen()
+}
+
+// Close the output.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.writer.Close()
+}
+
+func (l *Logger) log(level Level, msg string, keyvals []interface{}) {
+	if (l == nil) || (level < l.level) {
+		return
+	}
+
+	fields := make([]Field, 0, 3+len(l.fields)+len(keyvals)/2)
+	fields = append(fields,
+		Field{Key: "time", Value: time.Now()},
+		Field{Key: "level", Value: level},
+		Field{Key: "msg", Value: msg},
+	)
+	fields = append(fields, l.fields...)
+	fields = appendKeyvals(fields, nil, keyvals...)
+
+	var buf bytes.Buffer
+	if l.format == FormatJSON {
+		EncodeJSON(&buf, fields)
+	} else {
+		EncodeLogfmt(&buf, fields)
+	}
+	buf.WriteByte('\n')
+
+	// There is no place to report a failure to write a log.
+	l.writer.Write(buf.Bytes()) // nolint: errcheck
+}
+
+// appendKeyvals append the fields and the key value pairs to the destination. A key without a value
+// is logged with a empty value.
+func appendKeyvals(dst, fields []Field, keyvals ...interface{}) []Field {
+	dst = append(dst, fields...)
+	for i := 0; i < len(keyvals); i += 2 {
+		key, ok := keyvals[i].(string)
+		if !ok {
+			key = fmt.Sprintf("%v", keyvals[i])
+		}
+
+		var value interface{}
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		dst = append(dst, Field{Key: key, Value: value})
+	}
+	return dst
+}
+
+// NewLogger return a configured logger.
+func NewLogger(config LoggerConfig) (*Logger, error) {
+	level, err := ParseLevel(config.Level)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse level error")
+	}
+
+	switch config.Format {
+	case "":
+		config.Format = FormatLogfmt
+	case FormatJSON, FormatLogfmt:
+	default:
+		return nil, fmt.Errorf("invalid format '%s'", config.Format)
+	}
+
+	writer, err := NewWriter(config.Output)
+	if err != nil {
+		return nil, errors.Wrapf(err, "output '%s' initialization error", config.Output)
+	}
+
+	return &Logger{
+		level:  level,
+		format: config.Format,
+		writer: writer,
+	}, nil
+}
@@ -0,0 +1,164 @@
+package log
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type bufferWriter struct {
+	bytes.Buffer
+}
+
+func (*bufferWriter) Reopen() error { return nil }
+func (*bufferWriter) Close() error  { return nil }
+
+// withoutTime remove the time field, the first one, from each entry.
+func withoutTime(payload string) []string {
+	var entries []string
+	for _, line := range strings.Split(strings.TrimSuffix(payload, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "{") {
+			entries = append(entries, "{"+line[strings.Index(line, `"level"`):])
+			continue
+		}
+		entries = append(entries, line[strings.Index(line, " ")+1:])
+	}
+	return entries
+}
+
+func TestLogger(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		level    Level
+		format   string
+		log      func(*Logger)
+		expected []string
+	}{
+		{
+			name:   "level",
+			level:  LevelWarn,
+			format: FormatLogfmt,
+			log: func(l *Logger) {
+				l.Debug("debug")
+				l.Info("info")
+				l.Warn("warn")
+				l.Error("error", "status", 500)
+			},
+			expected: []string{`level=warn msg=warn`, `level=error msg=error status=500`},
+		},
+		{
+			name:   "with",
+			level:  LevelDebug,
+			format: FormatLogfmt,
+			log: func(l *Logger) {
+				pipe := l.With("pipe", "base")
+				pipe.Debug("started", "latency", "1s")
+				l.Info("ready")
+			},
+			expected: []string{`level=debug msg=started pipe=base latency=1s`, `level=info msg=ready`},
+		},
+		{
+			name:   "key without value",
+			level:  LevelInfo,
+			format: FormatLogfmt,
+			log: func(l *Logger) {
+				l.Info("odd", "key")
+			},
+			expected: []string{`level=info msg=odd key=""`},
+		},
+		{
+			name:   "json",
+			level:  LevelInfo,
+			format: FormatJSON,
+			log: func(l *Logger) {
+				l.With("pipe", "base").Error("failed", "error", "timeout")
+			},
+			expected: []string{`{"level":"error","msg":"failed","pipe":"base","error":"timeout"}`},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			w := &bufferWriter{}
+			tt.log(&Logger{level: tt.level, format: tt.format, writer: w})
+			require.Equal(t, tt.expected, withoutTime(w.String()))
+		})
+	}
+}
+
+func TestLoggerNil(t *testing.T) {
+	t.Parallel()
+
+	var l *Logger
+	require.NotPanics(t, func() {
+		l.With("pipe", "base").Info("discarded")
+		require.NoError(t, l.Reopen())
+		require.NoError(t, l.Close())
+	})
+}
+
+func TestLoggerFile(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "pipehub-log-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	path := filepath.Join(dir, "pipehub.log")
+	l, err := NewLogger(LoggerConfig{Output: path})
+	require.NoError(t, err)
+	l.Info("first")
+
+	// After a rotation, the entries go to a new file.
+	require.NoError(t, os.Rename(path, path+".1"))
+	require.NoError(t, l.Reopen())
+	l.Info("second")
+	require.NoError(t, l.Close())
+
+	payload, err := ioutil.ReadFile(path + ".1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"level=info msg=first"}, withoutTime(string(payload)))
+
+	payload, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, []string{"level=info msg=second"}, withoutTime(string(payload)))
+}
+
+func TestNewLogger(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		config     LoggerConfig
+		shouldFail bool
+	}{
+		{"default", LoggerConfig{}, false},
+		{"json at stderr", LoggerConfig{Level: "debug", Format: FormatJSON, Output: "stderr"}, false},
+		{"invalid level", LoggerConfig{Level: "trace"}, true},
+		{"invalid format", LoggerConfig{Format: "xml"}, true},
+		{"invalid output", LoggerConfig{Output: "/nonexistent/pipehub.log"}, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewLogger(tt.config)
+			require.Equal(t, tt.shouldFail, err != nil)
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// Package log holds the building blocks used by PipeHub to write logs.
+package log
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Writer is the destination of the logs. Reopen is used to support external log rotation, after a
+// rotation the file is moved and a new one should be created.
+type Writer interface {
+	io.Writer
+	Reopen() error
+	Close() error
+}
+
+// NewWriter return a writer to the output. The values 'stdout' and 'stderr' are special and point
+// to the process standard output and error, anything else is treated as a file path.
+func NewWriter(output string) (Writer, error) {
+	switch output {
+	case "", "stdout":
+		return stdWriter{os.Stdout}, nil
+	case "stderr":
+		return stdWriter{os.Stderr}, nil
+	default:
+		f := &file{path: output}
+		if err := f.Reopen(); err != nil {
+			return nil, errors.Wrap(err, "file open error")
+		}
+		return f, nil
+	}
+}
+
+type stdWriter struct {
+	io.Writer
+}
+
+func (stdWriter) Reopen() error { return nil }
+func (stdWriter) Close() error  { return nil }
+
+type file struct {
+	mutex sync.Mutex
+	path  string
+	base  *os.File
+}
+
+// Write is safe to be called concurrently, each call is written at once to the file.
+func (f *file) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.base.Write(p)
+}
+
+// Reopen close the current file, if any, and open it again by its path.
+func (f *file) Reopen() error {
+	base, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644) // nolint: gosec
+	if err != nil {
+		return errors.Wrapf(err, "open file '%s' error", f.path)
+	}
+
+	f.mutex.Lock()
+	previous := f.base
+	f.base = base
+	f.mutex.Unlock()
+
+	if previous == nil {
+		return nil
+	}
+	return errors.Wrap(previous.Close(), "close previous file error")
+}
+
+func (f *file) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.base.Close()
+}
@@ -1,5 +1,7 @@
 package internal
 
+import "time"
+
 // Pipe holds the pipe configuration.
 type Pipe struct {
 	ImportPath      string
@@ -7,10 +9,327 @@ type Pipe struct {
 	Module          string
 	Version         string
 	Config          map[string]interface{}
+	Lifecycle       PipeLifecycle
+
+	// Instances are the named instances of the pipe, each one with its own configuration. When set,
+	// the pipe is only initialized by instance and referenced as 'alias@instance.Function'.
+	Instances []PipeInstance
+}
+
+// PipeInstance holds the configuration of a named pipe instance.
+type PipeInstance struct {
+	Name   string
+	Config map[string]interface{}
+}
+
+// PipeLifecycle control how the optional lifecycle methods of a pipe are called.
+type PipeLifecycle struct {
+	// StartTimeout is the deadline of the 'Start' method, the default is 30 seconds.
+	StartTimeout time.Duration
+
+	// StartFailure is the policy used when 'Start' fails. 'abort', the default, stop the
+	// initialization and 'continue' log the error and keep going.
+	StartFailure string
+
+	// DependsOn are the aliases of the pipes used by this pipe. This pipe is started after and closed
+	// before them. A pipe with named instances can be referenced by its alias, 'auth', meaning all the
+	// instances, or by a single instance, 'auth@internal'.
+	DependsOn []string
 }
 
 // Host holds the configuration of HTTP hosts.
 type Host struct {
-	Endpoint string
+	Endpoint      string
+	Handler       string
+	RateLimit     *HostRateLimit
+	Cache         *HostCache
+	Compression   *HostCompression
+	RequestBody   *HostRequestBody
+	Auth          *HostAuth
+	AccessControl *HostAccessControl
+	CORS          *HostCORS
+	Rewrite       []HostRewrite
+	Redirect      []HostRedirect
+	Static        *HostStatic
+	Maintenance   *HostMaintenance
+	Mirror        *HostMirror
+	Split         *HostSplit
+}
+
+// HostRateLimit holds the rate limit configuration of a host.
+type HostRateLimit struct {
+	// Algorithm can be 'token-bucket' or 'sliding-window'.
+	Algorithm string
+
+	// Limit is the amount of requests allowed per window.
+	Limit int
+
+	// Burst is the token bucket capacity, if not set, the limit is used.
+	Burst int
+
+	Window time.Duration
+
+	// Key identify the client, it can be 'ip', 'header:<name>' or 'context:<key>'. The context key
+	// is a value a pipe stored at the request context using a string as key. The header key is only
+	// accepted for the headers used by the host authentication, like 'Authorization', and the client
+	// is identified by the authenticated identity.
+	Key string
+}
+
+// HostCache holds the response cache configuration of a host.
+type HostCache struct {
+	// Store can be 'memory' or 'disk'.
+	Store string
+
+	// Path is the directory used by the disk store.
+	Path string
+
+	// MaxSize is the maximum amount of bytes the store can hold, the least recently used responses
+	// are evicted when the limit is reached.
+	MaxSize int64
+
+	// MaxEntrySize is the maximum size of a response body that can be cached.
+	MaxEntrySize int64
+
+	// StatusHeader is the response header used to report the cache status.
+	StatusHeader string
+}
+
+// HostCompression holds the response compression configuration of a host.
+type HostCompression struct {
+	// Algorithms are the encodings the server can use, in order of preference. The supported values
+	// are 'br', 'gzip' and 'deflate'.
+	Algorithms []string
+
+	// Types are the MIME types that are compressed, the wildcard can be used at the subtype, like
+	// 'text/*'.
+	Types []string
+
+	// MinSize is the minimum response size in bytes to be compressed.
+	MinSize int
+
+	// IdentityUpstream remove the 'Accept-Encoding' header from the upstream request, this way the
+	// pipes receive the response body uncompressed.
+	IdentityUpstream bool
+}
+
+// HostRequestBody holds the request body limit and buffering configuration of a host.
+type HostRequestBody struct {
+	// MaxSize is the maximum body size in bytes, bigger requests are answered with 413. A zero value
+	// disable the limit.
+	MaxSize int64
+
+	// Buffer read the whole body before pass the request to the pipes and upstream, this way slow
+	// clients don't hold the upstream connections. By default the body is streamed.
+	Buffer bool
+
+	// BufferMemory is the amount of bytes kept in memory, the remaining is written to a temporary
+	// file.
+	BufferMemory int64
+
+	// BufferPath is the directory of the temporary files, the default is the system one.
+	BufferPath string
+}
+
+// HostAuth holds the authentication configuration of a host. When more then one method is set, the
+// request is accepted if any of them succeed.
+type HostAuth struct {
+	Basic  *HostAuthBasic
+	APIKey *HostAuthAPIKey
+	JWT    *HostAuthJWT
+}
+
+// HostAuthBasic holds the basic authentication configuration.
+type HostAuthBasic struct {
+	// Htpasswd is the path of a htpasswd file, the bcrypt and SHA1 hashes are supported.
+	Htpasswd string
+
+	// Realm is sent at the 'WWW-Authenticate' header.
+	Realm string
+}
+
+// HostAuthAPIKey holds the API key authentication configuration.
+type HostAuthAPIKey struct {
+	// File has one key per line, it can be prefixed by a name followed by a colon, like 'name:key'.
+	// Empty lines and lines starting with '#' are ignored.
+	File string
+
+	// Header used to send the key, the default is 'X-API-Key'.
+	Header string
+}
+
+// HostAuthJWT holds the JWT authentication configuration.
+type HostAuthJWT struct {
+	// Keys are paths of PEM encoded public keys.
+	Keys []string
+
+	// Secret is used to validate the tokens signed with HMAC.
+	Secret string
+
+	// JWKSURL is fetched to get the keys. It's fetched again at every JWKSRefresh and when a token
+	// has a unknown key id.
+	JWKSURL     string
+	JWKSRefresh time.Duration
+
+	// Algorithms allowed, the default is all the RSA, ECDSA and, if there is a secret, HMAC ones.
+	Algorithms []string
+
+	// Issuer and Audience are validated when set.
+	Issuer   string
+	Audience string
+}
+
+// HostAccessControl holds the IP access control configuration of a host. The deny list is evaluated
+// first, then, if the allow list is not empty, the client must match it.
+type HostAccessControl struct {
+	// Allow and Deny are lists of networks in the CIDR notation, single addresses are also accepted.
+	Allow []string
+	Deny  []string
+
+	// File has one rule per line, like 'allow 10.0.0.0/8' or 'deny 192.168.0.1'. The rules are
+	// added to the lists and they're reloaded without restart.
+	File string
+
+	// Handler is the pipe handler called when the client is denied, the default is a 403.
+	Handler string
+}
+
+// HostCORS holds the cross-origin resource sharing configuration of a host.
+type HostCORS struct {
+	// Origins allowed, the wildcard can be used at any part of the origin, like
+	// 'https://*.example.com', or alone to allow any origin.
+	Origins []string
+
+	// Methods allowed at the preflight requests, the default is 'GET', 'HEAD' and 'POST'.
+	Methods []string
+
+	// Headers allowed at the preflight requests, a '*' allow any header.
+	Headers []string
+
+	// ExposedHeaders are the response headers the browser expose to the client.
+	ExposedHeaders []string
+
+	Credentials bool
+	MaxAge      time.Duration
+}
+
+// HostRewrite holds a rewrite rule of a host. The rules are applied in order, each change is done
+// over the result of the previous one.
+type HostRewrite struct {
+	// Match is a regex checked against the request path, if not set, the rule is always applied.
+	Match string
+
+	RequestHeader  HostRewriteValues
+	ResponseHeader HostRewriteValues
+	Query          HostRewriteValues
+
+	// StripPrefix is removed from the path, then the PathRegex is replaced by the PathReplacement and
+	// at the end the AddPrefix is added.
+	StripPrefix     string
+	PathRegex       string
+	PathReplacement string
+	AddPrefix       string
+
+	// Host override the 'Host' header sent to the upstream.
+	Host string
+}
+
+// HostRewriteValues holds the changes done to headers or query parameters. The values are removed,
+// then set and added.
+type HostRewriteValues struct {
+	Set    map[string]string
+	Add    map[string]string
+	Remove []string
+}
+
+// HostRedirect holds a redirect rule of a host. The first rule that match the request path is used.
+type HostRedirect struct {
+	// Match is a regex checked against the request path, if not set, any path match.
+	Match string
+
+	// Target is the redirect location, the groups captured by the match can be used, like '$1'. The
+	// query string is kept if the target don't have one.
+	Target string
+
+	// Status can be 301, 302, 303, 307 or 308, the default is 301.
+	Status int
+}
+
+// HostStatic holds the static file serving configuration of a host. The files are served instead of
+// proxy the request to the upstream, the pipes are optional.
+type HostStatic struct {
+	Root string
+
+	// Index are the files served when a directory is requested, the default is 'index.html'.
+	Index []string
+
+	// SPAFallback is the file, relative to the root, served when the requested file don't exist.
+	// It's used by single page applications that handle the routes at the browser.
+	SPAFallback string
+
+	CacheControl string
+
+	// Precompressed serve the '.br' and '.gz' files, when they exist, to the clients that accept
+	// the encoding.
+	Precompressed bool
+}
+
+// HostMaintenance holds the maintenance page of a host. The maintenance mode is toggled at the admin
+// API, while enabled, the page is returned without calling the pipes or the upstream.
+type HostMaintenance struct {
+	// Page is the path of the file returned, if not set, a plain text message is used.
+	Page string
+
+	// Status is the response status code, the default is 503.
+	Status int
+
+	// RetryAfter is sent at the 'Retry-After' header when set.
+	RetryAfter time.Duration
+
+	// Enabled set the maintenance mode at the start.
+	Enabled bool
+}
+
+// HostMirror holds the traffic mirroring configuration of a host. A sample of the requests is sent to
+// a shadow upstream after the response of the primary upstream, the shadow responses are discarded.
+type HostMirror struct {
+	Upstream string
+
+	// Percentage of the requests mirrored, from 0 to 100.
+	Percentage float64
+
+	// MaxBodySize is the largest request body mirrored, the default is 1MB.
+	MaxBodySize int64
+
+	// Timeout of the shadow request, the default is 10 seconds.
+	Timeout time.Duration
+
+	// Concurrency is the maximum amount of shadow requests in flight, the requests above it are
+	// dropped. The default is 16.
+	Concurrency int
+}
+
+// HostSplit holds the weighted traffic splitting between variants of a host, it's used for canary
+// releases. The weights can be changed at the admin API.
+type HostSplit struct {
+	// Cookie keep the client at the same variant, it's not set if empty.
+	Cookie string
+
+	// Header is used to assign the variant by the hash of its value, like a user id, this way the same
+	// value always go to the same variant while the weights don't change.
+	Header string
+
+	// OverrideHeader choose the variant by name, it's used by the testers.
+	OverrideHeader string
+
+	Variants []HostSplitVariant
+}
+
+// HostSplitVariant is a destination of the traffic split. The requests are sent to the handler or to
+// the upstreams, in a round robin, but never both.
+type HostSplitVariant struct {
+	Name     string
 	Handler  string
+	Upstream []string
+	Weight   int
 }